@@ -1,7 +1,10 @@
 package btree
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"sync"
 )
 
 type TraverseMode int
@@ -17,22 +20,190 @@ type BTree struct {
 	length int
 	Root   Pointer
 	pager  Pager
+
+	// txDepth is the number of nested transactions that are started by the tree. Root and length of the tree are saved
+	// when the outermost one starts so that they can be reverted if it aborts.
+	txDepth  int
+	txRoot   Pointer
+	txLength int
+
+	// opLatch, rootLatch and latches synchronize the operations of the tree(see latch.go), and versions are checked by
+	// optimistic readers(see olc.go). metaMu guards Root and length while operations that crab latches run together.
+	// recounts counts the paths that are counted again(see recountPath).
+	opLatch   sync.RWMutex
+	rootLatch sync.RWMutex
+	latches   latchTable
+	latchMode LatchMode
+	versions  versionTable
+	metaMu    sync.Mutex
+	recounts  recountCounter
 }
 
+// MinDegree is the smallest degree NewBtreeWithMaxDegree accepts.
+const MinDegree = 3
+
+var ErrDegreeTooLarge = errors.New("nodes of the tree do not fit in a page")
+
+var (
+	ErrKeyExists   = errors.New("key already exists")
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+// MaxDegree returns the largest degree of a tree whose nodes fit in pages of the given size. A node is split when its
+// key count reaches degree, hence a leaf node should have room for degree keys and values and an internal node should
+// have room for degree keys and degree+1 pointers. Both have room for their high key as well.
+func MaxDegree(pageSize int, keySerializer KeySerializer, valSerializer ValueSerializer) int {
+	if isSlotted(keySerializer, valSerializer) {
+		// slotted nodes are split by the bytes they use, degree is not used
+		return math.MaxInt16
+	}
+
+	leaf := (pageSize - PersistentNodeHeaderSize - keySerializer.Size()) / (keySerializer.Size() + valSerializer.Size())
+	internal := (pageSize - PersistentNodeHeaderSize - InternalChildSize - keySerializer.Size()) / (keySerializer.Size() + InternalChildSize)
+
+	degree := leaf
+	if internal < degree {
+		degree = internal
+	}
+	// KeyLen in the node header is an int16
+	if degree > math.MaxInt16 {
+		degree = math.MaxInt16
+	}
+	return degree
+}
+
+// NewBtreeWithMaxDegree creates a tree with the largest degree its nodes can have in the pages of the pager. It
+// returns ErrDegreeTooLarge if a node with MinDegree cannot fit in a page.
+func NewBtreeWithMaxDegree(pager Pager) (*BTree, error) {
+	degree := MaxDegree(pager.GetPageSize(), pager.GetKeySerializer(), pager.GetValueSerializer())
+	if degree < MinDegree {
+		return nil, fmt.Errorf("%w: at most %v keys fit in a %v bytes page", ErrDegreeTooLarge, degree, pager.GetPageSize())
+	}
+	return NewBtreeWithPager(degree, pager), nil
+}
+
+// NewBtreeWithPager creates a tree with the given degree. It panics with ErrDegreeTooLarge if nodes with that degree do
+// not fit in the pages of the pager(see MaxDegree).
 func NewBtreeWithPager(degree int, pager Pager) *BTree {
+	if max := MaxDegree(pager.GetPageSize(), pager.GetKeySerializer(), pager.GetValueSerializer()); degree > max {
+		panic(fmt.Errorf("%w: degree is %v, at most %v keys fit in a %v bytes page", ErrDegreeTooLarge, degree, max, pager.GetPageSize()))
+	}
+
+	tree := &BTree{
+		degree: degree,
+		length: 0,
+		pager:  pager,
+	}
+	tree.beginTx()
+	defer tree.endTx()
+
 	l := pager.NewLeafNode()
 	root := pager.NewInternalNode(l.GetPageId())
 	defer pager.Unpin(root, true)
 	defer pager.Unpin(l, true)
 
+	tree.Root = root.GetPageId()
+	tree.writeMeta()
+
+	return tree
+}
+
+// OpenBtree opens the tree that was previously created on the pager by reading its metadata page. It returns
+// ErrTreeNotFound if pager does not have a tree in it and ErrIncompatibleTree if the tree was created with a different
+// page size or serializers.
+func OpenBtree(pager Pager) (*BTree, error) {
+	page := pager.GetMetaPage()
+	defer pager.UnpinByPointer(MetaPageId, false)
+
+	meta := readTreeMeta(page.GetData())
+	if err := meta.validate(pager, len(page.GetData())); err != nil {
+		return nil, err
+	}
+
 	return &BTree{
-		degree: degree,
-		length: 0,
-		Root:   root.GetPageId(),
+		degree: int(meta.Degree),
+		length: int(meta.Length),
+		Root:   meta.Root,
 		pager:  pager,
+	}, nil
+}
+
+// beginTx starts a transaction if pager of the tree is a TxPager. Every method that modifies the tree calls it and
+// defers endTx, so that the modification is atomic.
+func (tree *BTree) beginTx() {
+	if tree.txDepth == 0 {
+		tree.txRoot, tree.txLength = tree.Root, tree.length
+	}
+	tree.txDepth++
+	if txPager, ok := tree.pager.(TxPager); ok {
+		txPager.BeginTx()
 	}
 }
 
+// endTx commits the transaction started by beginTx. It should be deferred right after beginTx is called, so that it
+// can recover from a panic, in which case it aborts the transaction and panics again.
+func (tree *BTree) endTx() {
+	if r := recover(); r != nil {
+		tree.abortTx()
+		panic(r)
+	}
+
+	tree.txDepth--
+	txPager, ok := tree.pager.(TxPager)
+	if !ok {
+		return
+	}
+	if tree.txDepth == 0 {
+		// pager aborts the transaction itself if it cannot commit, tree should be reverted as well
+		defer func() {
+			if r := recover(); r != nil {
+				tree.Root, tree.length = tree.txRoot, tree.txLength
+				panic(r)
+			}
+		}()
+	}
+	txPager.CommitTx()
+}
+
+// splitTx commits the outermost transaction and starts another one if the transaction uses half of the pages the pager
+// can keep for a transaction. It is called between the steps of an operation which can be committed in parts, like
+// BulkLoad, so that the operation commits as few transactions as the pager allows. It returns true if the transaction
+// is committed.
+func (tree *BTree) splitTx() bool {
+	pager, ok := tree.pager.(boundedTxPager)
+	if !ok || tree.txDepth != 1 {
+		return false
+	}
+	if used, limit := pager.txPages(); used < limit/2 {
+		return false
+	}
+	tree.endTx()
+	tree.beginTx()
+	return true
+}
+
+// abortTx reverts the tree to its state before the outermost transaction is started.
+func (tree *BTree) abortTx() {
+	if tree.txDepth == 0 {
+		return
+	}
+
+	tree.Root, tree.length = tree.txRoot, tree.txLength
+	tree.txDepth = 0
+	if txPager, ok := tree.pager.(TxPager); ok {
+		txPager.AbortTx()
+	}
+}
+
+// writeMeta persists root, degree and number of keys of the tree to the metadata page.
+func (tree *BTree) writeMeta() {
+	tree.metaMu.Lock()
+	defer tree.metaMu.Unlock()
+	page := tree.pager.GetMetaPage()
+	writeTreeMeta(newTreeMeta(tree, len(page.GetData())), page.GetData())
+	tree.pager.UnpinByPointer(MetaPageId, true)
+}
+
 func (tree *BTree) GetRoot() Node {
 	return tree.pager.GetNode(tree.Root)
 }
@@ -41,212 +212,350 @@ func (tree *BTree) GetPager() Pager {
 	return tree.pager
 }
 
-func (tree *BTree) Insert(key Key, value interface{}) {
-	pager := tree.pager
-	var stack = make([]NodeIndexPair, 0)
-	var i interface{}
-	root := tree.GetRoot()
-	i, stack = tree.findAndGetStack(root, key, stack, Insert)
-	defer tree.pager.Unpin(root, false)
-	if i != nil {
-		panic(fmt.Sprintf("key already exists:  %v", key))
+// recoverErr recovers from a panic and sets err to its value. Errors of serializers and pagers are panicked deep in
+// nodes(see CheckErr), methods that return errors defer it before starting a transaction, so that the transaction is
+// aborted before the panic is converted to an error.
+func recoverErr(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if e, ok := r.(error); ok {
+		*err = e
+	} else {
+		*err = fmt.Errorf("%v", r)
 	}
+}
 
-	var rightNod = value
-	var rightKey = key
+// Insert is the same as TryInsert, but it panics if key already exists or if any other error occurs.
+func (tree *BTree) Insert(key Key, value interface{}) {
+	CheckErr(tree.TryInsert(key, value))
+}
 
-	for len(stack) > 0 {
-		popped := tree.pager.GetNode(stack[len(stack)-1].Node)
-		stack = stack[:len(stack)-1]
-		i, _ := popped.findKey(key)
-		popped.InsertAt(i, rightKey, rightNod)
-		//topOfStack.PrintNode()
-
-		if popped.IsOverFlow(tree.degree) {
-			rightNod, _, rightKey = popped.SplitNode((tree.degree) / 2)
-			tree.pager.Unpin(popped, true)
-			tree.pager.Unpin(tree.pager.GetNode(rightNod.(Pointer)), true)
-
-			if popped.GetPageId() == tree.Root {
-				leftNode := popped
-
-				newRoot := pager.NewInternalNode(leftNode.GetPageId())
-				newRoot.InsertAt(0, rightKey, rightNod.(Pointer))
-				tree.Root = newRoot.GetPageId()
-				tree.pager.Unpin(newRoot, true)
-			}
-		} else {
-			tree.pager.Unpin(popped, true)
-			break
-		}
+// TryInsert inserts the key and the value to the tree. It returns ErrKeyExists if the key is already in the tree, and
+// errors of serializers and the pager, in which case the tree is not modified.
+func (tree *BTree) TryInsert(key Key, value interface{}) (err error) {
+	defer recoverErr(&err)
+	if err := checkEntrySize(tree.pager, key, value); err != nil {
+		return err
+	}
+	exclusive := tree.lock(true)
+	defer tree.unlock(exclusive)
+	if exclusive {
+		tree.beginTx()
+		defer tree.endTx()
+	}
+
+	latches := tree.newHeldLatches(true)
+	defer latches.release()
+	stack := tree.crabDown(latches, key, Insert, 1)
+
+	top := stack[len(stack)-1]
+	leaf := tree.pager.GetNode(top.Node)
+	if _, found := leaf.findKey(key); found {
+		tree.pager.Unpin(leaf, false)
+		tree.recounts.started.Add(1)
+		latches.release()
+		tree.recountPath(key)
+		return fmt.Errorf("%w: %v", ErrKeyExists, key)
 	}
+	latches.write(top.Node)
+	leaf.InsertAt(top.Index, key, value)
+	tree.splitUp(leaf, stack[:len(stack)-1], latches)
+	tree.addLength(1)
+	return nil
 }
 
-func (tree *BTree) InsertOrReplace(key Key, value interface{}) (isInserted bool) {
-	pager := tree.pager
-	var stack = make([]NodeIndexPair, 0)
-	var i interface{}
-	root := tree.GetRoot()
-	i, stack = tree.findAndGetStack(root, key, stack, Insert)
-	defer tree.pager.Unpin(root, false)
-	if i != nil {
-		// top of stack is the leaf Node
-		topOfStack := stack[len(stack)-1]
-		leafNode := tree.pager.GetNode(topOfStack.Node)
-		leafNode.setValueAt(topOfStack.Index, value)
-		return false
+// addCount adds delta to the subtree counts of the children on the stack, which is the path to a leaf that a key is
+// inserted to or deleted from.
+func (tree *BTree) addCount(stack []NodeIndexPair, delta int) {
+	for _, pair := range stack[:len(stack)-1] {
+		node := tree.pager.GetNode(pair.Node)
+		node.setCountAt(pair.Index, node.getCountAt(pair.Index)+delta)
+		tree.pager.Unpin(node, true)
 	}
+}
 
-	var rightNod = value
-	var rightKey = key
+// splitUp splits the node if it overflows and inserts the key separating the split nodes to its parent, which is
+// at the top of the stack, and goes on with the parent as long as nodes overflow. A new root is created if the root
+// is split. node should be pinned, and it is unpinned as dirty. Subtree counts of the parents should already include
+// the keys of the node. Nodes on the stack should be latched by latches, which is nil if the operation runs alone, and
+// the bottom of the stack should be the root if the node at the bottom can be split.
+func (tree *BTree) splitUp(node Node, stack []NodeIndexPair, latches *heldLatches) {
+	for node.IsOverFlow(tree.degree) {
+		count := subtreeCount(node)
+		next := latches.lockNext(node)
+		latches.write(node.GetPageId())
+		right, _, rightKey := node.SplitNode(node.splitIndex(tree.degree))
+		latches.publish(right)
+		latches.unlock(next)
+		leftCount := subtreeCount(node)
+		tree.pager.Unpin(node, true)
 
-	for len(stack) > 0 {
-		topOfStack := tree.pager.GetNode(stack[len(stack)-1].Node)
-		i, _ := topOfStack.findKey(key)
-		topOfStack.InsertAt(i, rightKey, rightNod)
+		if len(stack) == 0 {
+			newRoot := tree.pager.NewInternalNode(node.GetPageId())
+			newRoot.setCountAt(0, leftCount)
+			newRoot.InsertAt(0, rightKey, right)
+			newRoot.setCountAt(1, count-leftCount)
+			latches.publish(newRoot.GetPageId())
+			latches.writeRoot()
+			tree.setRoot(newRoot.GetPageId())
+			tree.pager.Unpin(newRoot, true)
+			// root could be split without inserting a key when a value is replaced, hence meta is written here
+			tree.writeMeta()
+			return
+		}
 
-		popped := tree.pager.GetNode(stack[len(stack)-1].Node)
+		node = tree.pager.GetNode(stack[len(stack)-1].Node)
 		stack = stack[:len(stack)-1]
-		if popped.IsOverFlow(tree.degree) {
-			rightNod, _, rightKey = popped.SplitNode((tree.degree) / 2)
-			if popped.GetPageId() == tree.Root {
-				leftNode := popped
-
-				newRoot := pager.NewInternalNode(leftNode.GetPageId())
-				newRoot.InsertAt(0, rightKey, rightNod.(Pointer))
-				tree.Root = newRoot.GetPageId()
-			}
-		} else {
-			break
-		}
+		latches.write(node.GetPageId())
+		i, _ := node.findKey(rightKey)
+		node.setCountAt(i, leftCount)
+		node.InsertAt(i, rightKey, right)
+		node.setCountAt(i+1, count-leftCount)
 	}
+	tree.pager.Unpin(node, true)
+}
 
-	return true
+// InsertOrReplace is the same as TryInsertOrReplace, but it panics if an error occurs.
+func (tree *BTree) InsertOrReplace(key Key, value interface{}) (isInserted bool) {
+	isInserted, err := tree.TryInsertOrReplace(key, value)
+	CheckErr(err)
+	return isInserted
+}
+
+// TryInsertOrReplace inserts the key and the value to the tree or replaces the value if the key already exists.
+// isInserted is false if the value is replaced. Errors of serializers and the pager are returned, in which case the
+// tree is not modified.
+func (tree *BTree) TryInsertOrReplace(key Key, value interface{}) (isInserted bool, err error) {
+	defer recoverErr(&err)
+	if err := checkEntrySize(tree.pager, key, value); err != nil {
+		return false, err
+	}
+	exclusive := tree.lock(true)
+	defer tree.unlock(exclusive)
+	if exclusive {
+		tree.beginTx()
+		defer tree.endTx()
+	}
+
+	latches := tree.newHeldLatches(true)
+	defer latches.release()
+	stack := tree.crabDown(latches, key, Insert, 1)
+
+	// top of stack is the leaf Node
+	top := stack[len(stack)-1]
+	leaf := tree.pager.GetNode(top.Node)
+	latches.write(top.Node)
+	if _, found := leaf.findKey(key); found {
+		leaf.setValueAt(top.Index, value)
+		// a longer value could overflow a slotted leaf
+		tree.splitUp(leaf, stack[:len(stack)-1], latches)
+		tree.recounts.started.Add(1)
+		latches.release()
+		tree.recountPath(key)
+		return false, nil
+	}
+	leaf.InsertAt(top.Index, key, value)
+	tree.splitUp(leaf, stack[:len(stack)-1], latches)
+	tree.addLength(1)
+
+	return true, nil
 }
 
+// Find returns the value of the key, or nil if the key does not exist. It panics if an error occurs.
 func (tree *BTree) Find(key Key) interface{} {
-	root := tree.GetRoot()
-	res, stack := tree.findAndGetStack(root, key, []NodeIndexPair{}, Read)
-	for _, pair := range stack {
-		tree.pager.UnpinByPointer(pair.Node, false)
+	res, err := tree.TryFind(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil
 	}
+	CheckErr(err)
 	return res
 }
 
-func (tree *BTree) Height() int {
-	pager := tree.pager
-	var currentNode Node = tree.pager.GetNode(tree.Root)
-	acc := 0
-	for {
-		if currentNode.IsLeaf() {
-			return acc + 1
-		} else {
-			currentNode = pager.GetNode(currentNode.GetValueAt(0).(Pointer))
-		}
-		acc++
+// TryFind returns the value of the key. It returns ErrKeyNotFound if the key does not exist, and errors of
+// serializers and the pager.
+func (tree *BTree) TryFind(key Key) (value interface{}, err error) {
+	defer recoverErr(&err)
+	res, ok := tree.findOptimistic(key)
+	if !ok {
+		defer tree.unlockRead(tree.lockRead())
+		res = tree.find(key)
 	}
+	if res == nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyNotFound, key)
+	}
+	return res, nil
+}
+
+func (tree *BTree) Height() int {
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	return len(tree.descend(latches, func(node Node) int { return 0 }))
 }
 
+// Print writes the nodes of the tree level by level to stdout. ExportDOT and ExportJSON are easier to read for large
+// trees.
 func (tree *BTree) Print() {
+	defer tree.unlockRead(tree.lockRead())
 	pager := tree.pager
-	queue := make([]Pointer, 0, 2)
-	queue = append(queue, tree.Root)
-	queue = append(queue, 0)
-	for i := 0; i < len(queue); i++ {
-		node := tree.pager.GetNode(queue[i])
-		if node != nil && node.IsLeaf() {
-			break
-		}
-		if node == nil {
-			queue = append(queue, 0)
-			continue
-		}
-
-		pointers := make([]Pointer, 0)
-		vals := node.GetValues()
-		for _, val := range vals {
-			pointers = append(pointers, val.(Pointer))
-		}
-		queue = append(queue, pointers...)
-	}
-	for _, n := range queue {
-		if n != 0 {
-			currNode := pager.GetNode(n)
-			currNode.PrintNode()
-		} else {
-			fmt.Print("\n ### \n")
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+
+	// every level is printed from its first node by following the Right links. First node of a level is not freed
+	// when nodes are merged, hence it is latched after the first node of the level above is released.
+	latches.lockRoot()
+	first := latches.lock(tree.Root)
+	for first != 0 {
+		var next Pointer
+		for p := first; p != 0; {
+			node := pager.GetNode(p)
+			if p == first && !node.IsLeaf() {
+				next = node.GetValueAt(0).(Pointer)
+			}
+			node.PrintNode()
+			right := node.GetRight()
+			pager.Unpin(node, false)
+			if right != 0 {
+				latches.lock(right)
+				latches.unlock(p)
+			}
+			p = right
 		}
+		fmt.Print("\n ### \n")
+		first = latches.lock(next)
+		latches.releaseAncestors()
 	}
 }
 
+// Delete is the same as TryDelete, but it returns false if the key does not exist and panics if any other error
+// occurs.
 func (tree *BTree) Delete(key Key) bool {
-	var stack = make([]NodeIndexPair, 0)
-	var i interface{}
-	root := tree.GetRoot()
-	defer tree.pager.Unpin(root, false)
-	i, stack = tree.findAndGetStack(root, key, stack, Delete)
-	if i == nil {
+	err := tree.TryDelete(key)
+	if errors.Is(err, ErrKeyNotFound) {
 		return false
 	}
+	CheckErr(err)
+	return true
+}
+
+// TryDelete deletes the key from the tree. It returns ErrKeyNotFound if the key does not exist, and errors of
+// serializers and the pager, in which case the tree is not modified.
+func (tree *BTree) TryDelete(key Key) (err error) {
+	defer recoverErr(&err)
+	exclusive := tree.lock(true)
+	defer tree.unlock(exclusive)
+	if exclusive {
+		tree.beginTx()
+		defer tree.endTx()
+	}
 
+	latches := tree.newHeldLatches(true)
+	defer latches.release()
+	stack := tree.crabDown(latches, key, Delete, -1)
+
+	leaf := tree.pager.GetNode(stack[len(stack)-1].Node)
+	_, found := leaf.findKey(key)
+	tree.pager.Unpin(leaf, false)
+	if !found {
+		tree.recounts.started.Add(1)
+		latches.release()
+		tree.recountPath(key)
+		return fmt.Errorf("%w: %v", ErrKeyNotFound, key)
+	}
+	tree.deleteAt(key, stack, latches)
+	tree.addLength(-1)
+	return nil
+}
+
+// deleteAt deletes the key from the leaf at the top of the stack, which is returned by findAndGetStack, and merges or
+// redistributes the nodes on the stack as long as they underflow. It returns true if the leaf underflows, in which
+// case the path to the leaf is not valid anymore. Subtree counts on the stack should already exclude the key. Nodes on
+// the stack should be latched by latches, which is nil if the operation runs alone, and the bottom of the stack should
+// be the root if the node at the bottom can underflow.
+func (tree *BTree) deleteAt(key Key, stack []NodeIndexPair, latches *heldLatches) (isRebalanced bool) {
 	for len(stack) > 0 {
 		popped := tree.pager.GetNode(stack[len(stack)-1].Node)
 		isPoppedDirty := false
 		stack = stack[:len(stack)-1]
 		if popped.IsLeaf() {
 			index, _ := popped.findKey(key)
+			latches.write(popped.GetPageId())
 			popped.DeleteAt(index)
 			isPoppedDirty = true
 		}
 
 		if len(stack) == 0 {
-			// if no parent left in stack(this is correct only if popped is root) it is done
-			tree.pager.Unpin(popped, false) // NOTE: this one is tricky. But if root is dirty then previous turn in the loop should have already set it dirty
-			return true
+			// if no parent left in stack(this is correct only if popped is root or it cannot underflow) it is done
+			// NOTE: if root is dirty because of a merge then previous turn in the loop should have already set it dirty,
+			// but root can be a leaf as well when the tree is small
+			tree.pager.Unpin(popped, isPoppedDirty)
+			return isRebalanced
 		}
 
 		if popped.IsUnderFlow(tree.degree) {
+			isRebalanced = true
 			indexAtParent := stack[len(stack)-1].Index
 			parent := tree.pager.GetNode(stack[len(stack)-1].Node)
 
 			// get siblings
 			var rightSibling, leftSibling, merged Node
 			if indexAtParent > 0 {
-				leftSibling = tree.pager.GetNode(parent.GetValueAt(indexAtParent - 1).(Pointer)) //leftSibling = parent.Pointers[indexAtParent-1].(*InternalNode)
+				leftSibling = tree.pager.GetNode(latches.lock(parent.GetValueAt(indexAtParent - 1).(Pointer))) //leftSibling = parent.Pointers[indexAtParent-1].(*InternalNode)
 			}
 			if indexAtParent+1 < (parent.Keylen() + 1) { // +1 is the length of pointers
-				rightSibling = tree.pager.GetNode(parent.GetValueAt(indexAtParent + 1).(Pointer)) //rightSibling = parent.Pointers[indexAtParent+1].(*InternalNode)
+				rightSibling = tree.pager.GetNode(latches.lock(parent.GetValueAt(indexAtParent + 1).(Pointer))) //rightSibling = parent.Pointers[indexAtParent+1].(*InternalNode)
 			}
+			latches.write(parent.GetPageId())
+			latches.write(popped.GetPageId())
 
 			//try redistribute
-			if rightSibling != nil &&
-				((popped.IsLeaf() && rightSibling.Keylen() >= (tree.degree/2)+1) ||
-					(!popped.IsLeaf() && rightSibling.Keylen()+1 > (tree.degree+1)/2)) { // TODO: second check is actually different for internal and leaf nodes since internal nodes have one more value than they have keys
+			// separating key in parent is replaced when nodes are redistributed, parent could overflow if the new key
+			// is longer. Node on the right could lose its smallest keys, and the node on the right of a merge is freed.
+			if rightSibling != nil && rightSibling.CanLend(tree.degree) {
+				latches.raiseLow(rightSibling.GetPageId())
 				popped.Redistribute(rightSibling, parent)
 
 				tree.pager.Unpin(popped, true)
 				tree.pager.Unpin(rightSibling, true)
-				tree.pager.Unpin(parent, true)
-				return true
-			} else if leftSibling != nil &&
-				((popped.IsLeaf() && leftSibling.Keylen() >= (tree.degree/2)+1) ||
-					(!popped.IsLeaf() && leftSibling.Keylen()+1 > (tree.degree+1)/2)) {
+				if leftSibling != nil {
+					tree.pager.Unpin(leftSibling, false)
+				}
+				latches.unlockNodes(popped, leftSibling, rightSibling)
+				tree.splitUp(parent, stack[:len(stack)-1], latches)
+				return isRebalanced
+			} else if leftSibling != nil && leftSibling.CanLend(tree.degree) {
+				latches.write(leftSibling.GetPageId())
+				latches.raiseLow(popped.GetPageId())
 				leftSibling.Redistribute(popped, parent)
 
 				tree.pager.Unpin(popped, true)
 				tree.pager.Unpin(leftSibling, true)
-				tree.pager.Unpin(parent, true)
-				return true
+				if rightSibling != nil {
+					tree.pager.Unpin(rightSibling, false)
+				}
+				latches.unlockNodes(popped, leftSibling, rightSibling)
+				tree.splitUp(parent, stack[:len(stack)-1], latches)
+				return isRebalanced
 			}
 
 			// if redistribution is not valid merge
 			if rightSibling != nil {
+				next := latches.lockNext(rightSibling)
+				latches.raiseLow(rightSibling.GetPageId())
 				popped.MergeNodes(rightSibling, parent)
+				latches.unlock(next)
 				merged = popped
 
 				tree.pager.Unpin(popped, true)
-				tree.pager.Unpin(rightSibling, true)
-				tree.pager.Unpin(parent, true)
+				tree.pager.Unpin(rightSibling, false)
+				latches.unlock(rightSibling.GetPageId())
+				tree.freeNode(rightSibling.GetPageId())
+				if leftSibling != nil {
+					tree.pager.Unpin(leftSibling, false)
+				}
+				latches.unlockNodes(popped, leftSibling)
 			} else {
 				if leftSibling == nil {
 					if !popped.IsLeaf() {
@@ -254,25 +563,41 @@ func (tree *BTree) Delete(key Key) bool {
 					}
 
 					// TODO: may be log here? if it is a leaf node its both left and right nodes can be nil
-					return true
+					tree.pager.Unpin(popped, true)
+					tree.pager.Unpin(parent, false)
+					return isRebalanced
 				}
+				next := latches.lockNext(popped)
+				latches.write(leftSibling.GetPageId())
+				latches.raiseLow(popped.GetPageId())
 				leftSibling.MergeNodes(popped, parent)
+				latches.unlock(next)
 				merged = leftSibling
 
-				tree.pager.Unpin(popped, true)
+				tree.pager.Unpin(popped, false)
+				latches.unlock(popped.GetPageId())
+				tree.freeNode(popped.GetPageId())
 				tree.pager.Unpin(leftSibling, true)
-				tree.pager.Unpin(parent, true)
+				latches.unlockNodes(leftSibling)
 			}
-			if parent.GetPageId() == tree.Root && parent.Keylen() == 0 {
-				tree.Root = merged.GetPageId()
+			if len(stack) == 1 && parent.Keylen() == 0 {
+				// root is left with a single child after merge, that child becomes the new root
+				latches.writeRoot()
+				latches.raiseLow(parent.GetPageId())
+				tree.setRoot(merged.GetPageId())
+				tree.pager.Unpin(parent, false)
+				latches.unlock(parent.GetPageId())
+				tree.freeNode(parent.GetPageId())
+				return isRebalanced
 			}
+			tree.pager.Unpin(parent, true)
 		} else {
 			tree.pager.Unpin(popped, isPoppedDirty)
 			break
 		}
 	}
 
-	return true
+	return isRebalanced
 }
 
 // findAndGetStack is used to recursively find the given key and it also passes a stack object recursively to
@@ -293,16 +618,6 @@ func (tree *BTree) findAndGetStack(node Node, key Key, stackIn []NodeIndexPair,
 		stackOut = append(stackIn, NodeIndexPair{node.GetPageId(), i})
 		pointer := node.GetValueAt(i).(Pointer)
 		childNode := tree.pager.GetNode(pointer)
-
-		// if mode == Insert{
-		// 	if childNode.IsSafeForMerge(tree.degree){
-		// 		for _, v := range st {
-
-		// 		}
-		// 		tree.pager.Unpin(node, false)
-		// 	}
-		// }
-
 		defer tree.pager.Unpin(childNode, false)
 		res, stackOut := tree.findAndGetStack(childNode, key, stackOut, mode)
 		return res, stackOut
@@ -310,8 +625,24 @@ func (tree *BTree) findAndGetStack(node Node, key Key, stackIn []NodeIndexPair,
 }
 
 func (tree *BTree) FindAndGetStack(key Key, mode TraverseMode) (value interface{}, stackOut []NodeIndexPair) {
-	root := tree.GetRoot()
-	defer tree.pager.Unpin(root, false)
-	stack := []NodeIndexPair{}
-	return tree.findAndGetStack(root, key, stack, mode)
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	stack := tree.descend(latches, func(node Node) int {
+		i, found := node.findKey(key)
+		if found {
+			i++
+		}
+		return i
+	})
+
+	top := &stack[len(stack)-1]
+	leaf := tree.pager.GetNode(top.Node)
+	defer tree.pager.Unpin(leaf, false)
+	i, found := leaf.findKey(key)
+	top.Index = i
+	if found {
+		value = leaf.GetValueAt(i)
+	}
+	return value, stack
 }
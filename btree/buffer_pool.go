@@ -0,0 +1,185 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultPoolSize is the number of frames a FilePager keeps in memory when no pool size is given.
+const DefaultPoolSize = 1024
+
+var ErrNoFreeFrame = errors.New("all frames in the buffer pool are pinned or have uncommitted changes")
+
+// frame is a slot in the buffer pool which holds a page in memory. node is the decoded node of the page, it is cached
+// so that the same node instance is returned as long as the page stays in the pool. uncommitted is set when the page
+// is used by a transaction which is not committed yet. Such a page cannot be written to disk if it is dirty.
+type frame struct {
+	page        FilePage
+	node        Node
+	pinCount    int
+	isDirty     bool
+	referenced  bool
+	uncommitted bool
+}
+
+// bufferPool keeps a bounded number of pages in memory. Pages are pinned while they are used and only unpinned pages
+// can be evicted. Victims are chosen by the clock algorithm: every access sets the reference bit of a frame and the
+// clock hand gives each referenced frame a second chance before it is evicted. Dirty frames are written back to disk
+// when they are evicted.
+type bufferPool struct {
+	disk      *diskManager
+	frames    []*frame
+	pageTable map[Pointer]*frame
+	hand      int
+}
+
+func newBufferPool(disk *diskManager, size int) *bufferPool {
+	frames := make([]*frame, size)
+	for i := range frames {
+		frames[i] = &frame{page: FilePage{data: make([]byte, disk.pageSize)}}
+	}
+
+	return &bufferPool{
+		disk:      disk,
+		frames:    frames,
+		pageTable: make(map[Pointer]*frame),
+	}
+}
+
+// fetch returns the frame holding the page pinned. If the page is not in the pool it is read from disk into a
+// victim frame.
+func (b *bufferPool) fetch(pageId Pointer) (*frame, error) {
+	if f, ok := b.pageTable[pageId]; ok {
+		f.pinCount++
+		f.referenced = true
+		return f, nil
+	}
+
+	f, err := b.victim()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.disk.readPage(pageId, f.page.data); err != nil {
+		return nil, err
+	}
+	b.place(f, pageId)
+
+	return f, nil
+}
+
+// newPage allocates a new page on disk and returns a pinned frame holding it. Frame is zeroed and marked as dirty
+// since the page does not exist on disk yet.
+func (b *bufferPool) newPage() (*frame, error) {
+	f, err := b.victim()
+	if err != nil {
+		return nil, err
+	}
+	for i := range f.page.data {
+		f.page.data[i] = 0
+	}
+	b.place(f, b.disk.allocatePage())
+	f.isDirty = true
+
+	return f, nil
+}
+
+// unpin decrements pin count of the page. Once pin count drops to zero the frame becomes a candidate for eviction.
+func (b *bufferPool) unpin(pageId Pointer, isDirty bool) error {
+	f, ok := b.pageTable[pageId]
+	if !ok || f.pinCount == 0 {
+		return fmt.Errorf("page %v is not pinned", pageId)
+	}
+	f.pinCount--
+	f.isDirty = f.isDirty || isDirty
+	return nil
+}
+
+// flushAll writes every dirty frame back to disk except the ones that have uncommitted changes.
+func (b *bufferPool) flushAll() error {
+	for _, f := range b.pageTable {
+		if f.uncommitted {
+			continue
+		}
+		if err := b.flush(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bufferPool) flush(f *frame) error {
+	if !f.isDirty {
+		return nil
+	}
+	if err := b.disk.writePage(f.page.pageId, f.page.data); err != nil {
+		return err
+	}
+	f.isDirty = false
+	return nil
+}
+
+// victim finds an unpinned frame, writes it back if it is dirty and removes it from the page table. Dirty frames with
+// uncommitted changes are never chosen.
+func (b *bufferPool) victim() (*frame, error) {
+	// two rounds are enough since the first round clears all reference bits
+	for i := 0; i < 2*len(b.frames); i++ {
+		f := b.frames[b.hand]
+		b.hand = (b.hand + 1) % len(b.frames)
+		if f.pinCount > 0 || (f.isDirty && f.uncommitted) {
+			continue
+		}
+		if f.referenced {
+			f.referenced = false
+			continue
+		}
+
+		if err := b.flush(f); err != nil {
+			return nil, err
+		}
+		if b.pageTable[f.page.pageId] == f {
+			delete(b.pageTable, f.page.pageId)
+		}
+		f.node = nil
+		return f, nil
+	}
+
+	return nil, ErrNoFreeFrame
+}
+
+func (b *bufferPool) place(f *frame, pageId Pointer) {
+	f.page.pageId = pageId
+	f.pinCount = 1
+	f.isDirty = false
+	f.referenced = true
+	f.uncommitted = false
+	b.pageTable[pageId] = f
+}
+
+// drop removes the page from the pool without writing it back.
+func (b *bufferPool) drop(pageId Pointer) {
+	f, ok := b.pageTable[pageId]
+	if !ok {
+		return
+	}
+	delete(b.pageTable, pageId)
+	f.node = nil
+	f.pinCount = 0
+	f.isDirty = false
+	f.uncommitted = false
+}
+
+func (b *bufferPool) isPinned(pageId Pointer) bool {
+	f, ok := b.pageTable[pageId]
+	return ok && f.pinCount > 0
+}
+
+// pinnedCount returns the number of frames that are pinned at least once.
+func (b *bufferPool) pinnedCount() int {
+	n := 0
+	for _, f := range b.pageTable {
+		if f.pinCount > 0 {
+			n++
+		}
+	}
+	return n
+}
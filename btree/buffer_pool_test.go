@@ -0,0 +1,95 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferPool_Tree_Larger_Than_Pool_Should_Keep_All_Items(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	opts := FilePagerOptions{PoolSize: 64}
+	pager, err := NewFilePagerWithOptions(path, &StringKeySerializer{Len: 11}, &StringValueSerializer{Len: 11}, opts)
+	assert.NoError(t, err)
+
+	tree := NewBtreeWithPager(4, pager)
+	n := 5000
+	for _, i := range rand.Perm(n) {
+		tree.Insert(StringKey(fmt.Sprintf("selam_%05d", i)), fmt.Sprintf("value_%05d", i))
+	}
+	assert.Greater(t, int(pager.disk.numPages), opts.PoolSize)
+	assert.Zero(t, pager.pool.pinnedCount())
+
+	for i := 0; i < n; i += 2 {
+		assert.True(t, tree.Delete(StringKey(fmt.Sprintf("selam_%05d", i))))
+	}
+	assert.Zero(t, pager.pool.pinnedCount())
+
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePagerWithOptions(path, &StringKeySerializer{Len: 11}, &StringValueSerializer{Len: 11}, opts)
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	for i := 0; i < n; i++ {
+		val := tree.Find(StringKey(fmt.Sprintf("selam_%05d", i)))
+		if i%2 == 0 {
+			assert.Nil(t, val)
+		} else {
+			assert.Equal(t, fmt.Sprintf("value_%05d", i), val)
+		}
+	}
+
+	it := NewTreeIterator(tree, pager)
+	for val := it.Next(); val != nil; val = it.Next() {
+	}
+	assert.Zero(t, pager.pool.pinnedCount())
+}
+
+func TestBufferPool_Should_Return_Error_When_All_Frames_Are_Pinned(t *testing.T) {
+	disk, err := openDiskManager(filepath.Join(t.TempDir(), "tree.db"), 0)
+	assert.NoError(t, err)
+	defer disk.close()
+
+	pool := newBufferPool(disk, 3)
+	pinned := make([]Pointer, 0)
+	for i := 0; i < 3; i++ {
+		f, err := pool.newPage()
+		assert.NoError(t, err)
+		f.page.GetData()[pageChecksumSize] = byte(i + 1)
+		pinned = append(pinned, f.page.GetPageId())
+	}
+
+	_, err = pool.newPage()
+	assert.ErrorIs(t, err, ErrNoFreeFrame)
+
+	// unpinning any page should make room for a new one
+	assert.NoError(t, pool.unpin(pinned[1], true))
+	f, err := pool.newPage()
+	assert.NoError(t, err)
+	assert.NotEqual(t, pinned[1], f.page.GetPageId())
+
+	// evicted dirty page should be read back from disk
+	assert.NoError(t, pool.unpin(f.page.GetPageId(), false))
+	f, err = pool.fetch(pinned[1])
+	assert.NoError(t, err)
+	assert.Equal(t, byte(2), f.page.GetData()[pageChecksumSize])
+}
+
+func TestBufferPool_Unpin_Should_Fail_When_Page_Is_Not_Pinned(t *testing.T) {
+	disk, err := openDiskManager(filepath.Join(t.TempDir(), "tree.db"), 0)
+	assert.NoError(t, err)
+	defer disk.close()
+
+	pool := newBufferPool(disk, 3)
+	f, err := pool.newPage()
+	assert.NoError(t, err)
+
+	assert.NoError(t, pool.unpin(f.page.GetPageId(), false))
+	assert.Error(t, pool.unpin(f.page.GetPageId(), false))
+}
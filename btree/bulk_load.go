@@ -0,0 +1,344 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultFillFactor is the fill factor of BulkLoad when it is not configured. Nodes are not filled completely so that
+// keys inserted after the load do not split them right away.
+const DefaultFillFactor = 0.9
+
+var (
+	ErrUnsortedKeys      = errors.New("keys are not in ascending order")
+	ErrInvalidFillFactor = errors.New("fill factor should be between 0 and 1")
+)
+
+// BulkLoadSource returns the key-value pairs that are loaded by BulkLoad in ascending order of keys. It returns io.EOF
+// when there is no pair left.
+type BulkLoadSource func() (key Key, value interface{}, err error)
+
+// BulkLoadOptions configures BulkLoad. Zero value of every field means its default.
+type BulkLoadOptions struct {
+	// Degree of the tree. The largest degree that fits in the pages of the pager(see MaxDegree) is used when it is 0.
+	Degree int
+
+	// FillFactor is the fraction of a node that is filled before the next node is started. DefaultFillFactor is used
+	// when it is 0. Nodes are always filled more than a node is allowed to underflow, and slotted nodes are filled
+	// at most up to 5/8 since they should have room for a key of maximum size and for their high key.
+	FillFactor float64
+}
+
+/*
+  BulkLoad builds the tree bottom-up instead of inserting pairs one by one. Pairs are appended to leaf nodes which
+  are started when the previous one is filled up to the fill factor, and every node that is written appends its
+  smallest key and its pointer to the level above in the same way, until a level has a single node, which is the root.
+
+  Every level keeps at most two nodes in memory before they are written, so that the last node of a level can be
+  merged with or redistributed from the one before it when it underflows. Nodes are written in a transaction which is
+  committed whenever it uses half of the pages the pager can keep for a transaction(see splitTx), hence a TxPager does
+  not need to keep every page of the load in memory and a load commits only a few transactions. Tree metadata is
+  written in the last transaction, so a load that fails or crashes never leaves a partial tree behind. Nodes of a load
+  that fails are freed, but the nodes that are committed before a crash are not reachable from any tree and they are
+  never reused, hence a load that crashes should be started again on a new file.
+*/
+
+// BulkLoad creates a tree on the pager with the pairs returned from the source, which should be sorted in ascending
+// order of keys. It returns ErrUnsortedKeys or ErrKeyExists if the source is not sorted or has duplicate keys, and
+// pages written before the error are freed. Pages written before a crash are leaked.
+func BulkLoad(pager Pager, source BulkLoadSource, opts BulkLoadOptions) (tree *BTree, err error) {
+	defer recoverErr(&err)
+
+	max := MaxDegree(pager.GetPageSize(), pager.GetKeySerializer(), pager.GetValueSerializer())
+	degree := opts.Degree
+	if degree == 0 {
+		degree = max
+	}
+	if degree < MinDegree || degree > max {
+		return nil, fmt.Errorf("%w: degree is %v, at most %v keys fit in a %v bytes page", ErrDegreeTooLarge, degree, max, pager.GetPageSize())
+	}
+	if opts.FillFactor == 0 {
+		opts.FillFactor = DefaultFillFactor
+	}
+	if opts.FillFactor < 0 || opts.FillFactor > 1 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFillFactor, opts.FillFactor)
+	}
+
+	l := &bulkLoader{
+		tree:      &BTree{degree: degree, pager: pager},
+		fill:      opts.FillFactor,
+		isSlotted: isSlotted(pager.GetKeySerializer(), pager.GetValueSerializer()),
+	}
+	if err := l.load(source); err != nil {
+		l.free()
+		return nil, err
+	}
+	return l.tree, nil
+}
+
+// bulkEntry is a pair of a leaf node or a key and child pointer of an internal node. Sizes are the bytes the key takes
+// in a leaf and in an internal node, they are 1 for nodes that are not slotted so that nodes are filled by key count.
+// count is the number of keys in the subtree of a child pointer.
+type bulkEntry struct {
+	key          Key
+	value        interface{}
+	size         int
+	internalSize int
+	count        int
+}
+
+type bulkLevel struct {
+	isLeaf      bool
+	pending     [][]bulkEntry
+	written     int
+	lastWritten Pointer
+}
+
+type bulkLoader struct {
+	tree      *BTree
+	fill      float64
+	isSlotted bool
+	levels    []*bulkLevel
+	nodes     []Pointer // written nodes, they are freed if load fails
+	committed int       // number of nodes that are written by the committed transactions
+}
+
+func (l *bulkLoader) load(source BulkLoadSource) (err error) {
+	defer recoverErr(&err)
+	defer func() {
+		if r := recover(); r != nil {
+			// nodes written after the last commit are reverted when the transaction is aborted
+			if _, isTx := l.tree.pager.(TxPager); isTx {
+				l.nodes = l.nodes[:l.committed]
+			}
+			panic(r)
+		}
+	}()
+	l.tree.beginTx()
+	defer l.tree.endTx()
+
+	var prev Key
+	for {
+		key, value, err := source()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if prev != nil && !prev.Less(key) {
+			if !key.Less(prev) {
+				return fmt.Errorf("%w: %v", ErrKeyExists, key)
+			}
+			return fmt.Errorf("%w: %v comes after %v", ErrUnsortedKeys, key, prev)
+		}
+		size, internalSize, err := entrySizes(l.tree.pager, key, value)
+		if err != nil {
+			return err
+		}
+		if !l.isSlotted {
+			size, internalSize = 1, 1
+		}
+
+		l.add(0, bulkEntry{key: key, value: value, size: size, internalSize: internalSize})
+		l.tree.length++
+		prev = key
+	}
+
+	if l.tree.length == 0 {
+		l.write(0, nil)
+	}
+	for i := 0; ; i++ {
+		l.finish(i)
+		if level := l.levels[i]; !level.isLeaf && level.written == 1 {
+			l.tree.Root = level.lastWritten
+			break
+		}
+	}
+	l.tree.writeMeta()
+	return nil
+}
+
+func (l *bulkLoader) level(i int) *bulkLevel {
+	if i == len(l.levels) {
+		l.levels = append(l.levels, &bulkLevel{isLeaf: i == 0})
+	}
+	return l.levels[i]
+}
+
+// used returns the bytes an entry of the level uses in a node, or the number of keys if nodes are not slotted. First
+// entry of an internal node is its first pointer which does not have a key.
+func (l *bulkLoader) used(isLeaf bool, node []bulkEntry) int {
+	used := 0
+	for i, e := range node {
+		if isLeaf {
+			used += e.size
+		} else if i > 0 {
+			used += e.internalSize
+		}
+	}
+	return used
+}
+
+// limits returns the used size after which a node is considered full, the size below which it underflows and the
+// largest size it can have without overflowing.
+func (l *bulkLoader) limits(isLeaf bool) (full int, underflow int, max int) {
+	if !l.isSlotted {
+		degree := l.tree.degree
+		full = int(l.fill * float64(degree-1))
+		if full < degree/2 {
+			full = degree / 2
+		}
+		if full < 1 {
+			full = 1
+		}
+		return full, degree / 2, degree - 1
+	}
+
+	pageSize := l.tree.pager.GetPageSize()
+	capacity := pageSize - PersistentNodeHeaderSize - slottedHeaderSize
+	if !isLeaf {
+		capacity -= InternalChildSize
+	}
+	entry := maxEntrySize(pageSize)
+
+	// a node which is not full should have room for an entry which does not overflow the node, and for its high key
+	full = int(l.fill * float64(capacity))
+	if full > capacity-3*entry {
+		full = capacity - 3*entry
+	}
+	if full < capacity/2 {
+		full = capacity / 2
+	}
+	return full, capacity / 4, capacity - entry
+}
+
+// add appends the entry to the last node of the level, or to a new node if the last one is full.
+func (l *bulkLoader) add(i int, e bulkEntry) {
+	level := l.level(i)
+	full, _, _ := l.limits(level.isLeaf)
+
+	if n := len(level.pending); n == 0 || l.used(level.isLeaf, level.pending[n-1]) >= full {
+		if n == 2 {
+			node := level.pending[0]
+			level.pending = level.pending[1:]
+			l.write(i, node)
+		}
+		level.pending = append(level.pending, nil)
+	}
+	level.pending[len(level.pending)-1] = append(level.pending[len(level.pending)-1], e)
+}
+
+// finish writes the nodes of the level that are not written yet. If the last node underflows, it is merged with the
+// node before it, or entries of both are redistributed evenly.
+func (l *bulkLoader) finish(i int) {
+	level := l.level(i)
+	if len(level.pending) == 2 {
+		_, underflow, max := l.limits(level.isLeaf)
+		left, right := level.pending[0], level.pending[1]
+		merged := append(append([]bulkEntry{}, left...), right...)
+
+		switch {
+		case l.used(level.isLeaf, right) >= underflow:
+		case l.used(level.isLeaf, merged) <= max:
+			level.pending = [][]bulkEntry{merged}
+		default:
+			idx := l.splitIndex(level.isLeaf, merged)
+			level.pending = [][]bulkEntry{merged[:idx], merged[idx:]}
+		}
+	}
+
+	for _, node := range level.pending {
+		l.write(i, node)
+	}
+	level.pending = nil
+}
+
+// splitIndex returns the index which splits entries to two nodes that use the closest sizes.
+func (l *bulkLoader) splitIndex(isLeaf bool, entries []bulkEntry) int {
+	best, bestDiff := 1, -1
+	for idx := 1; idx < len(entries); idx++ {
+		diff := l.used(isLeaf, entries[:idx]) - l.used(isLeaf, entries[idx:])
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff == -1 || diff < bestDiff {
+			best, bestDiff = idx, diff
+		}
+	}
+	return best
+}
+
+// write writes the node and appends its smallest key and its pointer to the level above.
+func (l *bulkLoader) write(i int, node []bulkEntry) {
+	level := l.level(i)
+	p := l.writeNode(level, node)
+	l.nodes = append(l.nodes, p)
+	if l.tree.splitTx() {
+		l.committed = len(l.nodes)
+	}
+	level.written++
+	level.lastWritten = p
+
+	// key of the first entry of an internal node is never used, hence it can be nil when tree is empty
+	parent := bulkEntry{value: p, size: 1, internalSize: 1}
+	if len(node) > 0 {
+		parent.key, parent.internalSize = node[0].key, node[0].internalSize
+	}
+	for _, e := range node {
+		if level.isLeaf {
+			parent.count++
+		} else {
+			parent.count += e.count
+		}
+	}
+	l.add(i+1, parent)
+}
+
+func (l *bulkLoader) writeNode(level *bulkLevel, node []bulkEntry) Pointer {
+	pager := l.tree.pager
+	var n Node
+	if level.isLeaf {
+		n = pager.NewLeafNode()
+		for idx, e := range node {
+			n.InsertAt(idx, e.key, e.value)
+		}
+	} else {
+		n = pager.NewInternalNode(node[0].value.(Pointer))
+		n.setCountAt(0, node[0].count)
+		for idx, e := range node[1:] {
+			n.InsertAt(idx, e.key, e.value)
+			n.setCountAt(idx+1, e.count)
+		}
+	}
+
+	// smallest key of the subtree of the node is its separator from the previous node of the level
+	if level.lastWritten != 0 {
+		prev := pager.GetNode(level.lastWritten)
+		h := prev.GetHeader()
+		h.Right = n.GetPageId()
+		prev.SetHeader(h)
+		prev.setHighKey(node[0].key)
+		pager.Unpin(prev, true)
+
+		h = n.GetHeader()
+		h.Left = level.lastWritten
+		n.SetHeader(h)
+	}
+	pager.Unpin(n, true)
+	return n.GetPageId()
+}
+
+// free frees every node that is written by the load. Errors are ignored since the load has already failed.
+func (l *bulkLoader) free() {
+	defer func() { recover() }()
+	l.tree.beginTx()
+	defer l.tree.endTx()
+
+	for _, p := range l.nodes {
+		freeNodeWithOverflow(l.tree.pager, p)
+		l.tree.splitTx()
+	}
+}
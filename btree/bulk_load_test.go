@@ -0,0 +1,239 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func persistentKeySource(n int) BulkLoadSource {
+	i := 0
+	return func() (Key, interface{}, error) {
+		if i == n {
+			return nil, nil, io.EOF
+		}
+		i++
+		return PersistentKey(i - 1), fmt.Sprintf("value_%v", i-1), nil
+	}
+}
+
+// checkBulkLoadedNodes checks that no node overflows, nodes which have siblings do not underflow and leaves are linked
+// in order.
+func checkBulkLoadedNodes(t *testing.T, tree *BTree) {
+	pager := tree.pager
+	var leaves []Pointer
+	var walk func(p Pointer, hasSiblings bool)
+	walk = func(p Pointer, hasSiblings bool) {
+		node := pager.GetNode(p)
+		defer pager.Unpin(node, false)
+
+		assert.False(t, node.IsOverFlow(tree.degree), "page %v overflows", p)
+		if hasSiblings {
+			assert.False(t, node.IsUnderFlow(tree.degree), "page %v underflows", p)
+		}
+		if node.IsLeaf() {
+			leaves = append(leaves, p)
+			return
+		}
+		children := node.GetValues()
+		for _, child := range children {
+			walk(child.(Pointer), len(children) > 1)
+		}
+	}
+	walk(tree.Root, false)
+
+	for i, p := range leaves {
+		h := pager.GetNode(p).GetHeader()
+		pager.UnpinByPointer(p, false)
+		if i > 0 {
+			assert.Equal(t, leaves[i-1], h.Left)
+		}
+		if i < len(leaves)-1 {
+			assert.Equal(t, leaves[i+1], h.Right)
+		} else {
+			assert.Zero(t, h.Right)
+		}
+	}
+}
+
+func TestBulkLoad_Should_Build_Tree_With_Every_Pair(t *testing.T) {
+	for _, degree := range []int{3, 5, 50} {
+		for _, n := range []int{0, 1, 2, 3, 7, 10, 33, 100, 1000, 5000} {
+			t.Run(fmt.Sprintf("degree_%v_n_%v", degree, n), func(t *testing.T) {
+				pager := NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+				tree, err := BulkLoad(pager, persistentKeySource(n), BulkLoadOptions{Degree: degree})
+				assert.NoError(t, err)
+				assert.Equal(t, n, tree.length)
+				checkBulkLoadedNodes(t, tree)
+
+				it := NewTreeIterator(tree, pager)
+				for i := 0; i < n; i++ {
+					assert.Contains(t, it.Next(), fmt.Sprintf("value_%v", i))
+					assert.Contains(t, tree.Find(PersistentKey(i)), fmt.Sprintf("value_%v", i))
+				}
+				assert.Nil(t, it.Next())
+
+				// tree should be usable like any other tree after it is loaded
+				for i := n; i < n+100; i++ {
+					tree.Insert(PersistentKey(i), "value")
+				}
+				for i := 0; i < n+100; i++ {
+					assert.True(t, tree.Delete(PersistentKey(i)))
+				}
+				assert.Equal(t, 1, pager.PageCount())
+			})
+		}
+	}
+}
+
+func TestBulkLoad_Should_Fill_Nodes_Up_To_Fill_Factor(t *testing.T) {
+	n := 10000
+	pageCount := func(fill float64) int {
+		pager := NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+		tree, err := BulkLoad(pager, persistentKeySource(n), BulkLoadOptions{Degree: 101, FillFactor: fill})
+		assert.NoError(t, err)
+		checkBulkLoadedNodes(t, tree)
+		return pager.PageCount()
+	}
+
+	// at most 100 keys fit in a node with degree 101. With the default fill factor, the last leaf is merged with the
+	// one before it and there are 111 leaves, 2 internal nodes and the root
+	assert.Equal(t, 100+1, pageCount(1))
+	assert.Equal(t, 111+2+1, pageCount(0))
+	// nodes are filled at least half, hence 200 leaves are pointed by 3 internal nodes
+	assert.Equal(t, 200+3+1, pageCount(0.5))
+	assert.Equal(t, 200+3+1, pageCount(0.1))
+
+	_, err := BulkLoad(NewInMemoryPager(&PersistentKeySerializer{}, nil), persistentKeySource(n), BulkLoadOptions{FillFactor: 1.5})
+	assert.ErrorIs(t, err, ErrInvalidFillFactor)
+	_, err = BulkLoad(NewInMemoryPager(&PersistentKeySerializer{}, nil), persistentKeySource(n), BulkLoadOptions{Degree: 1000})
+	assert.ErrorIs(t, err, ErrDegreeTooLarge)
+}
+
+func TestBulkLoad_Should_Build_Slotted_Tree_In_File(t *testing.T) {
+	keys := urlKeys(20000)
+	sort.Strings(keys)
+	i := 0
+	source := func() (Key, interface{}, error) {
+		if i == len(keys) {
+			return nil, nil, io.EOF
+		}
+		i++
+		return StringKey(keys[i-1]), fmt.Sprintf("value_%v", i-1), nil
+	}
+
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePagerWithOptions(path, &VarStringKeySerializer{}, &VarStringValueSerializer{}, FilePagerOptions{PoolSize: 64, EnableWAL: true})
+	assert.NoError(t, err)
+	tree, err := BulkLoad(pager, source, BulkLoadOptions{FillFactor: 1})
+	assert.NoError(t, err)
+	checkBulkLoadedNodes(t, tree)
+	assert.Zero(t, pager.pool.pinnedCount())
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePager(path, &VarStringKeySerializer{}, &VarStringValueSerializer{})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	assert.Equal(t, len(keys), tree.length)
+	for i, key := range keys {
+		assert.Equal(t, fmt.Sprintf("value_%v", i), tree.Find(StringKey(key)))
+	}
+}
+
+func TestBulkLoad_Should_Reject_Unsorted_Or_Duplicate_Keys(t *testing.T) {
+	source := func(keys ...int) BulkLoadSource {
+		i := 0
+		return func() (Key, interface{}, error) {
+			if i == len(keys) {
+				return nil, nil, io.EOF
+			}
+			i++
+			return PersistentKey(keys[i-1]), "value", nil
+		}
+	}
+	unsorted := make([]int, 0)
+	for i := 0; i < 1000; i++ {
+		unsorted = append(unsorted, i)
+	}
+
+	pager := NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	_, err := BulkLoad(pager, source(append(unsorted, 500)...), BulkLoadOptions{Degree: 5})
+	assert.ErrorIs(t, err, ErrUnsortedKeys)
+	assert.Zero(t, pager.PageCount())
+
+	_, err = BulkLoad(pager, source(append(unsorted, 999)...), BulkLoadOptions{Degree: 5})
+	assert.ErrorIs(t, err, ErrKeyExists)
+	assert.Zero(t, pager.PageCount())
+
+	errSource := errors.New("source failed")
+	i := 0
+	_, err = BulkLoad(pager, func() (Key, interface{}, error) {
+		if i == 1000 {
+			return nil, nil, errSource
+		}
+		i++
+		return PersistentKey(i), "value", nil
+	}, BulkLoadOptions{Degree: 5})
+	assert.ErrorIs(t, err, errSource)
+	assert.Zero(t, pager.PageCount())
+
+	filePager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer filePager.Close()
+	_, err = BulkLoad(filePager, source(append(unsorted, 10)...), BulkLoadOptions{Degree: 5})
+	assert.ErrorIs(t, err, ErrUnsortedKeys)
+	_, err = OpenBtree(filePager)
+	assert.ErrorIs(t, err, ErrTreeNotFound)
+	assert.Zero(t, filePager.pool.pinnedCount())
+}
+
+func TestBulkLoad_Should_Write_Nodes_In_Few_Transactions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	opts := FilePagerOptions{PoolSize: 64, EnableWAL: true}
+	pager, err := NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 12}, opts)
+	assert.NoError(t, err)
+	n := 100000
+
+	// nodes of a load that fails are freed, and they are reused by the next loads. Nodes written after the last commit
+	// are reverted instead when the load panics.
+	errSource := errors.New("source failed")
+	for _, panics := range []bool{false, true} {
+		failing := persistentKeySource(n)
+		i := 0
+		_, err = BulkLoad(pager, func() (Key, interface{}, error) {
+			if i++; i > n/2 && panics {
+				panic(errSource)
+			} else if i > n/2 {
+				return nil, nil, errSource
+			}
+			return failing()
+		}, BulkLoadOptions{Degree: 16})
+		assert.ErrorIs(t, err, errSource)
+	}
+	numPages := pager.disk.numPages
+
+	txs := pager.lastTxId
+	tree, err := BulkLoad(pager, persistentKeySource(n), BulkLoadOptions{Degree: 16})
+	assert.NoError(t, err)
+	pages := int(pager.disk.numPages)
+	assert.Less(t, pages, 5*int(numPages)/2)
+	// a transaction is committed when it uses half of the pool, which includes the last node of every level
+	assert.LessOrEqual(t, int(pager.lastTxId-txs), pages/(opts.PoolSize/4))
+	assert.Zero(t, pager.pool.pinnedCount())
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 12}, opts)
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	assert.NoError(t, tree.Verify())
+	assert.Equal(t, n, tree.Len())
+}
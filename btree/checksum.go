@@ -0,0 +1,63 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// pageChecksumSize is the size of the checksum at the beginning of every page in a database file. Every page header
+// (PersistentNodeHeader, freePageHeader, treeMeta and fileHeader) starts with a Checksum field for it.
+const pageChecksumSize = 4
+
+var (
+	castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+	ErrPageCorrupted = errors.New("page is corrupted")
+)
+
+// PageCorruptedError means the content of a page read from disk does not match the checksum written with it, i.e.
+// the page is damaged on disk rather than written wrong by the tree. errors.Is(err, ErrPageCorrupted) is true for it.
+type PageCorruptedError struct {
+	PageId   Pointer
+	Stored   uint32
+	Computed uint32
+}
+
+func (e *PageCorruptedError) Error() string {
+	return fmt.Sprintf("page %v is corrupted: stored checksum is %#08x, computed %#08x", e.PageId, e.Stored, e.Computed)
+}
+
+func (e *PageCorruptedError) Is(target error) bool {
+	return target == ErrPageCorrupted
+}
+
+func pageChecksum(data []byte) uint32 {
+	return crc32.Checksum(data[pageChecksumSize:], castagnoliTable)
+}
+
+// setPageChecksum computes the checksum of the page and writes it to the beginning of the page. It should be called
+// right before a page is written to disk.
+func setPageChecksum(data []byte) {
+	binary.BigEndian.PutUint32(data, pageChecksum(data))
+}
+
+// verifyPageChecksum returns a *PageCorruptedError if the checksum of the page read from disk does not match its
+// content. Pages that are allocated but never written are all zeroes and are accepted.
+func verifyPageChecksum(pageId Pointer, data []byte) error {
+	stored, computed := binary.BigEndian.Uint32(data), pageChecksum(data)
+	if stored == computed || isZeroPage(data) {
+		return nil
+	}
+	return &PageCorruptedError{PageId: pageId, Stored: stored, Computed: computed}
+}
+
+func isZeroPage(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package btree
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func flipByte(t *testing.T, path string, offset int64) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	b := make([]byte, 1)
+	_, err = file.ReadAt(b, offset)
+	assert.NoError(t, err)
+	b[0] ^= 0x10
+	_, err = file.WriteAt(b, offset)
+	assert.NoError(t, err)
+}
+
+func TestChecksum_Corrupted_Page_Should_Be_Reported_With_Its_Page_Id(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+
+	tree := NewBtreeWithPager(4, pager)
+	for i := 0; i < 100; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+	root := tree.Root
+	assert.NoError(t, pager.Close())
+
+	flipByte(t, path, int64(root)*DefaultPageSize+PersistentNodeHeaderSize+5)
+
+	pager, err = NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		assert.True(t, ok)
+		assert.ErrorIs(t, err, ErrPageCorrupted)
+
+		var corrupted *PageCorruptedError
+		assert.True(t, errors.As(err, &corrupted))
+		assert.Equal(t, root, corrupted.PageId)
+		assert.Contains(t, err.Error(), "page")
+	}()
+	tree.Find(PersistentKey(50))
+	t.Fatal("reading a corrupted page should panic")
+}
+
+func TestChecksum_Corrupted_File_Header_Should_Be_Reported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	NewBtreeWithPager(4, pager)
+	assert.NoError(t, pager.Close())
+
+	flipByte(t, path, DefaultPageSize-1)
+
+	_, err = NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	var corrupted *PageCorruptedError
+	assert.True(t, errors.As(err, &corrupted))
+	assert.Equal(t, Pointer(0), corrupted.PageId)
+}
+
+func TestChecksum_Pages_Which_Are_Never_Written_Should_Be_Valid(t *testing.T) {
+	data := make([]byte, DefaultPageSize)
+	assert.NoError(t, verifyPageChecksum(5, data))
+
+	data[100] = 1
+	assert.ErrorIs(t, verifyPageChecksum(5, data), ErrPageCorrupted)
+
+	setPageChecksum(data)
+	assert.NoError(t, verifyPageChecksum(5, data))
+}
@@ -0,0 +1,388 @@
+package btree
+
+/*
+  Range delete:
+
+  Keys of a range are removed without visiting the nodes that are completely in the range. Going down from the root,
+  every internal node on the paths to the first and the last key of the range detaches the children between the
+  children on these paths, and keys of the range are deleted from the two leaves at the edges of the range. Hence only
+  the nodes on the two boundary paths are modified, and they are repaired by merging and redistributing them with
+  their siblings afterwards.
+
+  Keys are counted by the ranks of the bounds before the tree is modified, and the subtree counts on the boundary paths
+  are set after their children are detached. Detached subtrees are freed after the tree is modified, in transactions
+  which are committed whenever they use half of the pages the pager can keep for a transaction(see splitTx), so that a
+  TxPager never has to keep the pages of a large range in its transaction while few transactions are committed. Pages
+  of the detached subtrees are leaked if the process crashes before they are freed, but the tree stays consistent since
+  they are not reachable from the root anymore.
+*/
+
+// RangeBounds tells whether the bounds of a range are in the range. Its zero value is the range from start(inclusive)
+// to end(exclusive).
+type RangeBounds struct {
+	// ExcludeStart excludes start from the range.
+	ExcludeStart bool
+
+	// IncludeEnd includes end in the range.
+	IncludeEnd bool
+}
+
+// keyRange is the range of keys from start to end, whose bounds are in the range as bounds tells. A nil bound means
+// the range is not bounded on that side.
+type keyRange struct {
+	start, end Key
+	bounds     RangeBounds
+}
+
+func (r keyRange) isEmpty() bool {
+	if r.start == nil || r.end == nil {
+		return false
+	}
+	if !r.bounds.ExcludeStart && r.bounds.IncludeEnd {
+		return r.end.Less(r.start)
+	}
+	return !r.start.Less(r.end)
+}
+
+// startIndex returns the index of the first key of a leaf that is in the range, or the index of the child of an
+// internal node that would contain the first key in the range.
+func (r keyRange) startIndex(node Node) int {
+	if r.start == nil {
+		return 0
+	}
+	i, found := node.findKey(r.start)
+	if found && (!node.IsLeaf() || r.bounds.ExcludeStart) {
+		i++
+	}
+	return i
+}
+
+// endIndex returns the index of the first key of a leaf that is after the range, or the index of the child of an
+// internal node that would contain the last key in the range.
+func (r keyRange) endIndex(node Node) int {
+	if r.end == nil {
+		return node.Keylen()
+	}
+	i, found := node.findKey(r.end)
+	if found && r.bounds.IncludeEnd {
+		i++
+	}
+	return i
+}
+
+// DeleteRange is the same as TryDeleteRange, but it panics if an error occurs.
+func (tree *BTree) DeleteRange(start, end Key, bounds RangeBounds) int {
+	n, err := tree.TryDeleteRange(start, end, bounds)
+	CheckErr(err)
+	return n
+}
+
+// TryDeleteRange deletes every key between start and end, and returns the number of deleted keys. start is deleted
+// unless bounds excludes it and end is deleted only if bounds includes it. A nil start or end means the range is not
+// bounded on that side. If an error occurs while the tree is modified, the tree is not modified at all. If an error
+// occurs while pages of the deleted keys are freed, the keys are already deleted and the pages that are not freed yet
+// are leaked.
+func (tree *BTree) TryDeleteRange(start, end Key, bounds RangeBounds) (n int, err error) {
+	defer recoverErr(&err)
+	defer tree.unlock(tree.lock(false))
+	tree.unpublishPages()
+	r := keyRange{start: start, end: end, bounds: bounds}
+	if r.isEmpty() {
+		return 0, nil
+	}
+
+	n = tree.countRange(r)
+	if n == 0 {
+		return 0, nil
+	}
+	tree.freeSubtrees(tree.detachRange(r, n))
+	return n, nil
+}
+
+// countRange returns the number of keys in the range.
+func (tree *BTree) countRange(r keyRange) int {
+	start, end := 0, tree.length
+	if r.start != nil {
+		start = tree.rankAt(r.startIndex)
+	}
+	if r.end != nil {
+		end = tree.rankAt(r.endIndex)
+	}
+	return end - start
+}
+
+// rankAt returns the number of keys before the index of the leaf that is chosen by childIndex, adding up the subtree
+// counts of the children on the left of the path like rank.
+func (tree *BTree) rankAt(childIndex func(node Node) int) int {
+	rank := 0
+	p := tree.Root
+	for {
+		node := tree.pager.GetNode(p)
+		i := childIndex(node)
+		if node.IsLeaf() {
+			tree.pager.Unpin(node, false)
+			return rank + i
+		}
+
+		for j := 0; j < i; j++ {
+			rank += node.getCountAt(j)
+		}
+		p = node.GetValueAt(i).(Pointer)
+		tree.pager.Unpin(node, false)
+	}
+}
+
+// descend follows the children that are chosen by childIndex from the root to a leaf, and returns the nodes on the
+// path with the index of the chosen child. It crabs the latches of latches, which is nil if the operation runs alone,
+// and only the latch of the leaf is held when it returns.
+func (tree *BTree) descend(latches *heldLatches, childIndex func(node Node) int) []NodeIndexPair {
+	stack := make([]NodeIndexPair, 0)
+	latches.lockRoot()
+	p := latches.lock(tree.Root)
+	for {
+		node := tree.pager.GetNode(p)
+		if node.IsLeaf() {
+			tree.pager.Unpin(node, false)
+			return append(stack, NodeIndexPair{p, 0})
+		}
+		i := childIndex(node)
+		stack = append(stack, NodeIndexPair{p, i})
+		p = node.GetValueAt(i).(Pointer)
+		tree.pager.Unpin(node, false)
+		latches.lock(p)
+		latches.releaseAncestors()
+	}
+}
+
+// detachRange deletes the n keys of the range from the tree in a single transaction, and returns the subtrees that
+// are detached from the tree, which are not freed yet.
+func (tree *BTree) detachRange(r keyRange, n int) (detached []Pointer) {
+	tree.beginTx()
+	defer tree.endTx()
+
+	// nodes between the boundary paths are detached on every level below the node where the paths split, nodes on
+	// the paths are linked to each other. Separator of the child on the end path in that node is the smallest key
+	// left on the right of the range, hence it is the high key of the nodes on the start path.
+	first := tree.descend(nil, r.startIndex)
+	last := tree.descend(nil, r.endIndex)
+	var highKey Key
+	for level := range first {
+		left, right := first[level].Node, last[level].Node
+		if left == right {
+			continue
+		}
+		if highKey == nil {
+			split := tree.pager.GetNode(last[level-1].Node)
+			highKey = split.GetKeyAt(last[level-1].Index - 1)
+			tree.pager.Unpin(split, false)
+		}
+
+		leftNode, rightNode := tree.pager.GetNode(left), tree.pager.GetNode(right)
+		h := leftNode.GetHeader()
+		h.Right = right
+		leftNode.SetHeader(h)
+		leftNode.setHighKey(highKey)
+		h = rightNode.GetHeader()
+		h.Left = left
+		rightNode.SetHeader(h)
+		tree.pager.Unpin(leftNode, true)
+		tree.pager.Unpin(rightNode, true)
+	}
+
+	_, detached = tree.detach(tree.Root, r, true, true, nil)
+	tree.repairPaths(r.startIndex, r.endIndex)
+
+	tree.length -= n
+	tree.writeMeta()
+	return detached
+}
+
+// detach deletes keys of the range from the leaves of the subtree of p which are at the edges of the range, and
+// detaches the children of internal nodes which are completely in the range. Only the children on the paths to the
+// edges of the range are kept, a node which is on the path to start keeps its child that would contain start, and
+// a node which is on the path to end keeps its child that would contain the largest key before end. Detached
+// children are appended to detached. It returns the number of keys left in the subtree of p.
+func (tree *BTree) detach(p Pointer, r keyRange, onStartPath, onEndPath bool, detached []Pointer) (int, []Pointer) {
+	node := tree.pager.GetNode(p)
+	i, j := -1, node.Keylen()+1
+	if onStartPath {
+		i = r.startIndex(node)
+	}
+	if onEndPath {
+		j = r.endIndex(node)
+	}
+
+	if node.IsLeaf() {
+		if i < 0 {
+			i = 0
+		}
+		if j > node.Keylen() {
+			j = node.Keylen()
+		}
+		for k := i; k < j; k++ {
+			node.DeleteAt(i)
+		}
+		count := node.Keylen()
+		tree.pager.Unpin(node, j > i)
+		return count, detached
+	}
+
+	// removing the children between i and j leaves the separator of j in front of it, which is still less than every
+	// key of j and larger than every key of i. If i is -1, separator of j is removed with the first child.
+	for k := j - 1; k > i; k-- {
+		detached = append(detached, node.GetValueAt(k).(Pointer))
+		if k > 0 {
+			node.DeleteAt(k - 1)
+		} else {
+			node.setValueAt(0, node.GetValueAt(1))
+			node.DeleteAt(0)
+		}
+	}
+	var first, last Pointer
+	if onStartPath {
+		first = node.GetValueAt(i).(Pointer)
+	}
+	if onEndPath && j > i {
+		last = node.GetValueAt(i + 1).(Pointer)
+	}
+	tree.pager.Unpin(node, j > i+1)
+
+	var firstCount, lastCount int
+	if first != 0 {
+		firstCount, detached = tree.detach(first, r, true, onEndPath && j == i, detached)
+	}
+	if last != 0 {
+		lastCount, detached = tree.detach(last, r, false, true, detached)
+	}
+
+	// the kept children are at i and i+1 after the children between them are detached
+	node = tree.pager.GetNode(p)
+	if first != 0 {
+		node.setCountAt(i, firstCount)
+	}
+	if last != 0 {
+		node.setCountAt(i+1, lastCount)
+	}
+	count := subtreeCount(node)
+	tree.pager.Unpin(node, true)
+	return count, detached
+}
+
+// repairPaths fixes the nodes that overflow or underflow on the paths that are followed by childIndexes, level by
+// level from the leaves up to the root. A fix changes only the nodes of its level and their ancestors, hence the
+// levels below it stay fixed. In a level, every fix either splits a node that overflows, merges two nodes, removes
+// the root or changes the keys of a node that underflows, and nodes are merged only if they fit in one node, so a
+// split never makes a node underflow again and a level is fixed after its nodes are merged or redistributed once.
+func (tree *BTree) repairPaths(childIndexes ...func(node Node) int) {
+	for height := 0; ; height++ {
+		for isFixed := false; !isFixed; {
+			isFixed = true
+			for _, childIndex := range childIndexes {
+				stack := tree.descend(nil, childIndex)
+				level := len(stack) - 1 - height
+				if level < 0 {
+					return
+				}
+				if tree.repairNode(stack, level) {
+					isFixed = false
+				}
+			}
+		}
+	}
+}
+
+// repairNode fixes the node at the given level of the stack if it overflows or underflows, and removes the root if it
+// is an internal node with a single child. A node that underflows but does not have a sibling is fixed by rebalancing
+// its lowest ancestor that has a sibling, or by removing the root above it. It returns false if there is nothing to
+// fix or the node cannot be changed.
+func (tree *BTree) repairNode(stack []NodeIndexPair, level int) bool {
+	node := tree.pager.GetNode(stack[level].Node)
+	if node.IsOverFlow(tree.degree) {
+		tree.splitUp(node, stack[:level], nil)
+		return true
+	}
+	isUnderFlow := node.IsUnderFlow(tree.degree)
+	tree.pager.Unpin(node, false)
+	if !isUnderFlow {
+		return false
+	}
+
+	for ; level > 0; level-- {
+		parent := tree.pager.GetNode(stack[level-1].Node)
+		if parent.Keylen() > 0 {
+			return tree.rebalance(tree.pager.GetNode(stack[level].Node), parent, stack[level-1].Index)
+		}
+		tree.pager.Unpin(parent, false)
+	}
+
+	root := tree.pager.GetNode(stack[0].Node)
+	if !root.IsLeaf() && root.Keylen() == 0 {
+		tree.Root = root.GetValueAt(0).(Pointer)
+		tree.pager.Unpin(root, false)
+		tree.freeNode(root.GetPageId())
+		return true
+	}
+	tree.pager.Unpin(root, false)
+	return false
+}
+
+// rebalance redistributes the keys of node, which is the child of parent at index, with its right sibling or its
+// left sibling if it does not have a right one. The nodes are merged instead if they fit in one node and either the
+// sibling cannot lend or one of them still underflows after they are redistributed, which happens when the node is
+// short of many keys after a range is detached. node and parent should be pinned, and they are unpinned. It returns
+// false if the node is not changed, which happens when the nodes are not merged and the node would still have the
+// same keys after it is redistributed, like internal nodes of even degree with a single key do.
+func (tree *BTree) rebalance(node Node, parent Node, index int) bool {
+	var left, right, sibling Node
+	if index < parent.Keylen() {
+		sibling = tree.pager.GetNode(parent.GetValueAt(index + 1).(Pointer))
+		left, right = node, sibling
+	} else {
+		sibling = tree.pager.GetNode(parent.GetValueAt(index - 1).(Pointer))
+		left, right = sibling, node
+	}
+
+	isChanged, isMerged := true, !sibling.CanLend(tree.degree) && left.canMerge(right, tree.degree)
+	if !isMerged {
+		keyLen := node.Keylen()
+		left.Redistribute(right, parent)
+		isChanged = node.Keylen() != keyLen
+		isUnderFlow := left.IsUnderFlow(tree.degree) || right.IsUnderFlow(tree.degree)
+		isMerged = isUnderFlow && left.canMerge(right, tree.degree)
+	}
+	if isMerged {
+		left.MergeNodes(right, parent)
+		tree.pager.Unpin(right, false)
+		tree.freeNode(right.GetPageId())
+		isChanged = true
+	} else {
+		tree.pager.Unpin(right, true)
+	}
+	tree.pager.Unpin(left, true)
+	tree.pager.Unpin(parent, true)
+	return isChanged
+}
+
+// freeSubtrees frees every page of the subtrees of the pointers, going down from their roots with a stack of the pages
+// that are not freed yet.
+func (tree *BTree) freeSubtrees(roots []Pointer) {
+	tree.beginTx()
+	defer tree.endTx()
+
+	stack := append([]Pointer(nil), roots...)
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := tree.pager.GetNode(p)
+		if !node.IsLeaf() {
+			for _, child := range node.GetValues() {
+				stack = append(stack, child.(Pointer))
+			}
+		}
+		tree.pager.Unpin(node, false)
+
+		tree.versions.unpublish(p)
+		freeNodeWithOverflow(tree.pager, p)
+		tree.splitTx()
+	}
+}
@@ -0,0 +1,306 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkTreeKeys checks that leaves are at the same depth, no node overflows, nodes which have siblings do not
+// underflow, subtree counts of internal nodes are correct and the tree has exactly the given keys in order.
+func checkTreeKeys(t *testing.T, tree *BTree, keys []int) {
+	pager := tree.pager
+	depth := -1
+	var walk func(p Pointer, level int, hasSiblings bool) int
+	walk = func(p Pointer, level int, hasSiblings bool) int {
+		node := pager.GetNode(p)
+		defer pager.Unpin(node, false)
+
+		assert.False(t, node.IsOverFlow(tree.degree), "page %v overflows", p)
+		if hasSiblings {
+			assert.False(t, node.IsUnderFlow(tree.degree), "page %v underflows", p)
+		}
+		if node.IsLeaf() {
+			if depth == -1 {
+				depth = level
+			}
+			assert.Equal(t, depth, level, "leaf %v is not at the same depth as the others", p)
+			return node.Keylen()
+		}
+		children := node.GetValues()
+		count := 0
+		for i, child := range children {
+			n := walk(child.(Pointer), level+1, len(children) > 1)
+			assert.Equal(t, n, node.getCountAt(i), "count of child %v of page %v is wrong", i, p)
+			count += n
+		}
+		return count
+	}
+	assert.Equal(t, len(keys), walk(tree.Root, 0, false))
+
+	assert.Equal(t, len(keys), tree.length)
+	it := NewTreeIterator(tree, pager)
+	for _, key := range keys {
+		assert.Contains(t, it.Next(), fmt.Sprintf("value_%v", key))
+	}
+	assert.Nil(t, it.Next())
+}
+
+func TestDeleteRange_Should_Delete_Keys_From_Start_Until_End(t *testing.T) {
+	for _, degree := range []int{3, 4, 5, 50} {
+		t.Run(fmt.Sprintf("degree_%v", degree), func(t *testing.T) {
+			n := 2000
+			pager := NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+			tree, err := BulkLoad(pager, persistentKeySource(n), BulkLoadOptions{Degree: degree})
+			assert.NoError(t, err)
+
+			exists := make(map[int]bool)
+			for i := 0; i < n; i++ {
+				exists[i] = true
+			}
+			r := rand.New(rand.NewSource(42))
+			for round := 0; round < 50; round++ {
+				start, end := r.Intn(n+10)-5, r.Intn(n+10)-5
+				if end < start {
+					start, end = end, start
+				}
+				end += r.Intn(3) * r.Intn(200)
+
+				var startKey, endKey Key = PersistentKey(start), PersistentKey(end)
+				if round%10 == 0 {
+					startKey, start = nil, -1
+				}
+				if round%10 == 5 {
+					endKey, end = nil, n
+				}
+
+				bounds := RangeBounds{ExcludeStart: r.Intn(2) == 0, IncludeEnd: r.Intn(2) == 0}
+				if bounds.ExcludeStart {
+					start++
+				}
+				if bounds.IncludeEnd {
+					end++
+				}
+
+				expected := 0
+				for i := start; i < end; i++ {
+					if exists[i] {
+						expected++
+						delete(exists, i)
+					}
+				}
+				assert.Equal(t, expected, tree.DeleteRange(startKey, endKey, bounds))
+
+				keys := make([]int, 0, len(exists))
+				for key := range exists {
+					keys = append(keys, key)
+				}
+				sort.Ints(keys)
+				checkTreeKeys(t, tree, keys)
+			}
+
+			// tree should be usable like any other tree after the ranges are deleted
+			for i := 0; i < n; i++ {
+				if !exists[i] {
+					tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+				}
+			}
+			for i := 0; i < n; i++ {
+				assert.Contains(t, tree.Find(PersistentKey(i)), fmt.Sprintf("value_%v", i))
+			}
+			assert.Equal(t, n, tree.DeleteRange(nil, nil, RangeBounds{}))
+			checkTreeKeys(t, tree, nil)
+			assert.Equal(t, 1, pager.PageCount())
+		})
+	}
+}
+
+func TestDeleteRange_Should_Not_Delete_Anything_When_Range_Is_Empty(t *testing.T) {
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	assert.Zero(t, tree.DeleteRange(PersistentKey(50), PersistentKey(50), RangeBounds{}))
+	assert.Zero(t, tree.DeleteRange(PersistentKey(60), PersistentKey(50), RangeBounds{}))
+	assert.Zero(t, tree.DeleteRange(PersistentKey(51), PersistentKey(52), RangeBounds{}))
+	assert.Zero(t, tree.DeleteRange(PersistentKey(100), nil, RangeBounds{}))
+	assert.Equal(t, 50, tree.length)
+
+	// start is inclusive, end is exclusive
+	assert.Equal(t, 1, tree.DeleteRange(PersistentKey(50), PersistentKey(52), RangeBounds{}))
+	assert.Nil(t, tree.Find(PersistentKey(50)))
+	assert.NotNil(t, tree.Find(PersistentKey(52)))
+}
+
+func TestDeleteRange_Should_Include_Or_Exclude_Bounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		bounds   RangeBounds
+		expected []int
+	}{
+		{"[start, end)", RangeBounds{}, []int{100, 102, 104, 106, 108}},
+		{"(start, end)", RangeBounds{ExcludeStart: true}, []int{102, 104, 106, 108}},
+		{"[start, end]", RangeBounds{IncludeEnd: true}, []int{100, 102, 104, 106, 108, 110}},
+		{"(start, end]", RangeBounds{ExcludeStart: true, IncludeEnd: true}, []int{102, 104, 106, 108, 110}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := NewBtreeWithPager(5, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+			for i := 0; i < 200; i += 2 {
+				tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+			}
+
+			assert.Equal(t, len(test.expected), tree.DeleteRange(PersistentKey(100), PersistentKey(110), test.bounds))
+			deleted := make(map[int]bool)
+			for _, key := range test.expected {
+				deleted[key] = true
+			}
+			keys := make([]int, 0)
+			for i := 0; i < 200; i += 2 {
+				if !deleted[i] {
+					keys = append(keys, i)
+				}
+			}
+			checkTreeKeys(t, tree, keys)
+			assert.Empty(t, tree.Verify())
+
+			// bounds that are not in the tree are never deleted, so bounds do not change anything for them
+			n := tree.Len()
+			assert.Equal(t, 4, tree.DeleteRange(PersistentKey(11), PersistentKey(19), test.bounds))
+			assert.Equal(t, n-4, tree.Len())
+
+			// a nil bound is not bounded whether it is included or not
+			assert.Equal(t, 5, tree.DeleteRange(nil, PersistentKey(9), test.bounds))
+			assert.Equal(t, 5, tree.DeleteRange(PersistentKey(189), nil, test.bounds))
+			assert.Empty(t, tree.Verify())
+		})
+	}
+}
+
+func TestDeleteRange_Should_Delete_Single_Key_When_Both_Bounds_Are_Included(t *testing.T) {
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	assert.Zero(t, tree.DeleteRange(PersistentKey(50), PersistentKey(50), RangeBounds{ExcludeStart: true, IncludeEnd: true}))
+	assert.Zero(t, tree.DeleteRange(PersistentKey(52), PersistentKey(50), RangeBounds{IncludeEnd: true}))
+	assert.Equal(t, 1, tree.DeleteRange(PersistentKey(50), PersistentKey(50), RangeBounds{IncludeEnd: true}))
+	assert.Nil(t, tree.Find(PersistentKey(50)))
+	assert.Equal(t, 49, tree.Len())
+}
+
+func TestDeleteRange_Should_Not_Leave_Siblings_Of_Edges_Underflowing(t *testing.T) {
+	// a node at the edge of a large range is left with few keys, and its sibling should not underflow after it lends
+	for _, degree := range []int{4, 5, 6} {
+		for seed := int64(0); seed < 10; seed++ {
+			r := rand.New(rand.NewSource(seed))
+			tree := NewBtreeWithPager(degree, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+			for _, i := range r.Perm(3000) {
+				tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+			}
+			deleted := make(map[int]bool)
+			for _, i := range r.Perm(3000)[:2000] {
+				tree.Delete(PersistentKey(i))
+				deleted[i] = true
+			}
+			tree.DeleteRange(PersistentKey(500), PersistentKey(2500), RangeBounds{})
+
+			var keys []int
+			for i := 0; i < 3000; i++ {
+				if !deleted[i] && (i < 500 || i >= 2500) {
+					keys = append(keys, i)
+				}
+			}
+			assert.NoError(t, tree.Verify(), "degree %v seed %v", degree, seed)
+			checkTreeKeys(t, tree, keys)
+		}
+	}
+}
+
+func TestDeleteRange_Should_Not_Merge_Nodes_That_Do_Not_Fit_In_One_Node(t *testing.T) {
+	// merging the internal nodes at the edges of the range would overflow, splitting it leaves them underflowing again
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &SlotPointerValueSerializer{}))
+	for _, i := range rand.New(rand.NewSource(20)).Perm(20) {
+		tree.Insert(PersistentKey(i), SlotPointer{PageId: int64(i)})
+	}
+
+	assert.Equal(t, 8, tree.DeleteRange(PersistentKey(6), PersistentKey(14), RangeBounds{}))
+	it := NewTreeIterator(tree, tree.pager)
+	for i := 0; i < 20; i++ {
+		if i == 6 {
+			i = 14
+		}
+		assert.Equal(t, SlotPointer{PageId: int64(i)}, it.Next())
+	}
+	assert.Nil(t, it.Next())
+	assert.NoError(t, tree.Verify())
+}
+
+func TestDeleteRange_Should_Free_Pages_Of_Deleted_Keys(t *testing.T) {
+	pager := NewInMemoryPager(&VarStringKeySerializer{}, &VarStringValueSerializer{})
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	r := rand.New(rand.NewSource(42))
+	n := 500
+	for _, i := range rand.Perm(n) {
+		tree.Insert(StringKey(fmt.Sprintf("key_%03d", i)), blob(r, r.Intn(10<<10)))
+	}
+
+	assert.Equal(t, 300, tree.DeleteRange(StringKey("key_100"), StringKey("key_400"), RangeBounds{}))
+	for i := 0; i < n; i++ {
+		val := tree.Find(StringKey(fmt.Sprintf("key_%03d", i)))
+		if i >= 100 && i < 400 {
+			assert.Nil(t, val)
+		} else {
+			assert.NotNil(t, val)
+		}
+	}
+
+	assert.Equal(t, 200, tree.DeleteRange(nil, nil, RangeBounds{}))
+	assert.Equal(t, 1, pager.PageCount())
+}
+
+func TestDeleteRange_Should_Delete_Large_Ranges_With_Small_Pool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 12}, FilePagerOptions{PoolSize: 16, EnableWAL: true})
+	assert.NoError(t, err)
+	n := 50000
+	tree, err := BulkLoad(pager, persistentKeySource(n), BulkLoadOptions{})
+	assert.NoError(t, err)
+
+	txs := pager.lastTxId
+	deleted, err := tree.TryDeleteRange(PersistentKey(1000), PersistentKey(49000), RangeBounds{})
+	assert.NoError(t, err)
+	assert.Equal(t, 48000, deleted)
+	assert.Zero(t, pager.pool.pinnedCount())
+	numPages := pager.disk.numPages
+	// detached pages are freed in transactions which use half of the pool
+	assert.LessOrEqual(t, int(pager.lastTxId-txs), int(numPages)/4)
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 12}, FilePagerOptions{PoolSize: 16, EnableWAL: true})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	keys := make([]int, 0)
+	for i := 0; i < n; i++ {
+		if i < 1000 || i >= 49000 {
+			keys = append(keys, i)
+		}
+	}
+	checkTreeKeys(t, tree, keys)
+
+	// freed pages are reused
+	for i := 1000; i < 11000; i++ {
+		tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+	}
+	assert.LessOrEqual(t, int(pager.disk.numPages), int(numPages))
+}
@@ -0,0 +1,186 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	fileMagic   uint32 = 0x42505446 // "BPTF"
+	fileVersion uint16 = 2
+)
+
+var (
+	ErrNotADatabaseFile = errors.New("file is not a b+ tree database file")
+	ErrPageSizeMismatch = errors.New("page size does not match the database file")
+)
+
+// storageFile is the part of *os.File that is used by pagers. It is an interface so that tests can inject faults to
+// disk operations.
+type storageFile interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Seeker
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+func openOsFile(path string) (storageFile, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+func fileSize(file storageFile) (int64, error) {
+	return file.Seek(0, io.SeekEnd)
+}
+
+// fileHeader is stored in the first page of a database file. Since page_id 0 is used as a nil Pointer by the tree,
+// first page can never be a node, and it is used to recognize the file when it is opened again. Second page is
+// reserved for tree metadata(see MetaPageId) hence first node in a file is always the third page.
+type fileHeader struct {
+	Checksum     uint32
+	Magic        uint32
+	Version      uint16
+	PageSize     uint32
+	FreeListHead Pointer
+}
+
+func readFileHeader(data []byte) *fileHeader {
+	reader := bytes.NewReader(data)
+	dest := fileHeader{}
+	err := binary.Read(reader, binary.BigEndian, &dest)
+	CheckErr(err)
+	return &dest
+}
+
+func writeFileHeader(h *fileHeader, dest []byte) {
+	buf := bytes.Buffer{}
+	err := binary.Write(&buf, binary.BigEndian, h)
+	CheckErr(err)
+	copy(dest, buf.Bytes())
+}
+
+// diskManager reads and writes fixed size pages of a database file. page_id of a page is its index in the file, so a
+// page can be found at page_id * pageSize offset.
+type diskManager struct {
+	file     storageFile
+	pageSize int
+	numPages Pointer
+}
+
+// openDiskManager opens the database file at the given path or creates it if it does not exist. If pageSize is 0,
+// page size of the file is used, or DefaultPageSize if the file is created.
+func openDiskManager(path string, pageSize int) (*diskManager, error) {
+	file, err := openOsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDiskManager(file, pageSize)
+}
+
+// newDiskManager initializes a diskManager on an opened database file. File is closed if it cannot be initialized.
+func newDiskManager(file storageFile, pageSize int) (*diskManager, error) {
+	d := &diskManager{file: file, pageSize: pageSize}
+	if err := d.init(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// init writes the file header if the file is empty, otherwise validates the header and counts pages in the file.
+func (d *diskManager) init() error {
+	size, err := fileSize(d.file)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 {
+		if d.pageSize == 0 {
+			d.pageSize = DefaultPageSize
+		}
+		h := fileHeader{Magic: fileMagic, Version: fileVersion, PageSize: uint32(d.pageSize)}
+		data := make([]byte, d.pageSize)
+		writeFileHeader(&h, data)
+		if err := d.writePage(0, data); err != nil {
+			return err
+		}
+		d.numPages = MetaPageId + 1
+		return d.sync()
+	}
+
+	// page size is not known until the header is read, but it is at least MinPageSize
+	data := make([]byte, MinPageSize)
+	if err := d.readRawPage(0, data); err != nil {
+		return err
+	}
+	h := readFileHeader(data)
+	if h.Magic != fileMagic || h.Version != fileVersion || validatePageSize(int(h.PageSize)) != nil {
+		return ErrNotADatabaseFile
+	}
+	if d.pageSize != 0 && d.pageSize != int(h.PageSize) {
+		return fmt.Errorf("%w: file has %v bytes pages, not %v", ErrPageSizeMismatch, h.PageSize, d.pageSize)
+	}
+
+	d.pageSize = int(h.PageSize)
+	data = make([]byte, d.pageSize)
+	if err := d.readPage(0, data); err != nil {
+		return err
+	}
+
+	pageSize := int64(d.pageSize)
+	d.numPages = Pointer((size + pageSize - 1) / pageSize)
+	if d.numPages <= MetaPageId {
+		d.numPages = MetaPageId + 1
+	}
+	return nil
+}
+
+// readPage reads the page and verifies its checksum. It returns a *PageCorruptedError if the page is damaged.
+func (d *diskManager) readPage(pageId Pointer, dest []byte) error {
+	if err := d.readRawPage(pageId, dest); err != nil {
+		return err
+	}
+	return verifyPageChecksum(pageId, dest)
+}
+
+func (d *diskManager) readRawPage(pageId Pointer, dest []byte) error {
+	n, err := d.file.ReadAt(dest, int64(pageId)*int64(d.pageSize))
+	if err == io.EOF {
+		// pages which are allocated but never written are read as zeroes
+		for i := n; i < len(dest); i++ {
+			dest[i] = 0
+		}
+		return nil
+	}
+	return err
+}
+
+// writePage computes the checksum of the page, stores it in the page and writes the page.
+func (d *diskManager) writePage(pageId Pointer, data []byte) error {
+	setPageChecksum(data)
+	_, err := d.file.WriteAt(data, int64(pageId)*int64(d.pageSize))
+	return err
+}
+
+// allocatePage reserves a new page at the end of the file and returns its page_id. Nothing is written to the file
+// until the page is written for the first time.
+func (d *diskManager) allocatePage() Pointer {
+	pageId := d.numPages
+	d.numPages++
+	return pageId
+}
+
+func (d *diskManager) sync() error {
+	return d.file.Sync()
+}
+
+func (d *diskManager) close() error {
+	return d.file.Close()
+}
@@ -0,0 +1,124 @@
+package btree
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors_Duplicate_Key_Should_Return_ErrKeyExists(t *testing.T) {
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, tree.TryInsert(PersistentKey(i), "value"))
+	}
+
+	assert.ErrorIs(t, tree.TryInsert(PersistentKey(50), "other"), ErrKeyExists)
+	assert.Equal(t, 100, tree.length)
+	val, err := tree.TryFind(PersistentKey(50))
+	assert.NoError(t, err)
+	assert.Contains(t, val, "value")
+
+	assert.Panics(t, func() { tree.Insert(PersistentKey(50), "other") })
+}
+
+func TestErrors_Missing_Key_Should_Return_ErrKeyNotFound(t *testing.T) {
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	for i := 0; i < 100; i += 2 {
+		assert.NoError(t, tree.TryInsert(PersistentKey(i), "value"))
+	}
+
+	_, err := tree.TryFind(PersistentKey(51))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.ErrorIs(t, tree.TryDelete(PersistentKey(51)), ErrKeyNotFound)
+	assert.NoError(t, tree.TryDelete(PersistentKey(50)))
+	assert.ErrorIs(t, tree.TryDelete(PersistentKey(50)), ErrKeyNotFound)
+	assert.Equal(t, 49, tree.length)
+
+	isInserted, err := tree.TryInsertOrReplace(PersistentKey(50), "value")
+	assert.NoError(t, err)
+	assert.True(t, isInserted)
+	isInserted, err = tree.TryInsertOrReplace(PersistentKey(50), "other")
+	assert.NoError(t, err)
+	assert.False(t, isInserted)
+}
+
+func TestErrors_Serializer_Errors_Should_Be_Returned_Without_Modifying_Tree(t *testing.T) {
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 5}))
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, tree.TryInsert(PersistentKey(i), "value"))
+	}
+
+	assert.ErrorIs(t, tree.TryInsert(PersistentKey(100), "too long"), ErrValueTooLarge)
+	_, err := tree.TryInsertOrReplace(PersistentKey(50), "too long")
+	assert.ErrorIs(t, err, ErrValueTooLarge)
+
+	assert.Equal(t, 100, tree.length)
+	val, err := tree.TryFind(PersistentKey(50))
+	assert.NoError(t, err)
+	assert.Equal(t, "value", val)
+	_, err = tree.TryFind(PersistentKey(100))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestErrors_Pager_Errors_Should_Be_Returned_And_Tree_Should_Stay_Usable(t *testing.T) {
+	fs := newFaultFS()
+	pager, err := NewFilePagerWithOptions("tree.db", &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, FilePagerOptions{PoolSize: 16, openFile: fs.open})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	tree := NewBtreeWithPager(4, pager)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, tree.TryInsert(PersistentKey(i), "value"))
+	}
+
+	// pages are written when they are evicted from the pool, which fails at the next write
+	fs.failAt = fs.writes + 1
+	n := 100
+	for ; n < 1000; n++ {
+		if err = tree.TryInsert(PersistentKey(n), "value"); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, errInjectedFault)
+	fs.restart()
+
+	assert.Nil(t, pager.tx)
+	assert.Zero(t, pager.pool.pinnedCount())
+	assert.Equal(t, n, tree.length)
+	_, err = tree.TryFind(PersistentKey(n))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.NoError(t, tree.TryInsert(PersistentKey(n), "value"))
+	assert.NoError(t, tree.TryDelete(PersistentKey(0)))
+}
+
+func TestErrors_Corrupted_Page_Should_Be_Returned_From_Find_And_Iterator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	tree := NewBtreeWithPager(4, pager)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, tree.TryInsert(PersistentKey(i), "value"))
+	}
+	root := tree.Root
+	assert.NoError(t, pager.Close())
+
+	flipByte(t, path, int64(root)*DefaultPageSize+PersistentNodeHeaderSize+5)
+
+	pager, err = NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+
+	_, err = tree.TryFind(PersistentKey(50))
+	assert.ErrorIs(t, err, ErrPageCorrupted)
+	assert.ErrorIs(t, tree.TryInsert(PersistentKey(100), "value"), ErrPageCorrupted)
+	assert.ErrorIs(t, tree.TryDelete(PersistentKey(50)), ErrPageCorrupted)
+	assert.Zero(t, pager.pool.pinnedCount())
+
+	// iterator is created before the page is read again, its error is returned by TryNext
+	it := &TreeIterator{tree: tree, curr: root, pager: pager}
+	_, err = it.TryNext()
+	assert.ErrorIs(t, err, ErrPageCorrupted)
+}
@@ -0,0 +1,214 @@
+package btree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+  Export:
+
+  Export walks the tree from the root and returns every node it reaches as an ExportNode, which has the page id of the
+  node, its keys, the range of keys its subtree can have according to the separator keys of its ancestors and how full
+  it is. ExportJSON writes them as JSON, and ExportDOT writes them as a Graphviz graph in which internal nodes point to
+  their children and every node points to the node on its right with a dashed edge:
+
+    dot -Tsvg tree.dot -o tree.svg
+
+  Nodes can be limited to the levels close to the root and to the subtrees whose key ranges overlap a range of keys, so
+  that the part of a large tree around a problem can be looked at.
+*/
+
+// ExportOptions limits the nodes that are exported. Zero value exports every node.
+type ExportOptions struct {
+	// Levels is the number of levels that are exported from the root. Every level is exported if it is 0.
+	Levels int
+
+	// Start and End limit the exported nodes to the ones whose key ranges overlap the keys that are not less than
+	// Start and less than End. A nil Start or End means the range is not bounded on that side.
+	Start, End Key
+}
+
+// TreeExport is the structure of a tree written by ExportJSON.
+type TreeExport struct {
+	Root   Pointer      `json:"root"`
+	Degree int          `json:"degree"`
+	Length int          `json:"length"`
+	Nodes  []ExportNode `json:"nodes"`
+}
+
+// ExportNode is a node of a TreeExport. Nodes are in the order they are reached from the root depth first, so leaves
+// are in ascending order of their keys.
+type ExportNode struct {
+	PageId Pointer  `json:"pageId"`
+	IsLeaf bool     `json:"isLeaf"`
+	Depth  int      `json:"depth"`
+	Keys   []string `json:"keys"`
+
+	// Lower and Upper are the separator keys of the ancestors that bound the keys of the subtree, keys are not less
+	// than Lower and less than Upper. They are nil if the subtree is not bounded on that side.
+	Lower *string `json:"lower,omitempty"`
+	Upper *string `json:"upper,omitempty"`
+
+	// Fill is the fraction of the node that is used, number of keys over the maximum number of keys for nodes that are
+	// not slotted and used bytes over the capacity for slotted nodes.
+	Fill float64 `json:"fill"`
+
+	// Children and Counts are the pointers of the children of an internal node and the number of keys in their
+	// subtrees, including the children that are not exported.
+	Children []Pointer `json:"children,omitempty"`
+	Counts   []int     `json:"counts,omitempty"`
+
+	// Left and Right are the links of the node to its neighbours on the same level, and HighKey is its high key. They
+	// are not set if the node is at the edge of its level.
+	Left    Pointer `json:"left,omitempty"`
+	Right   Pointer `json:"right,omitempty"`
+	HighKey *string `json:"highKey,omitempty"`
+}
+
+// Export returns the nodes of the tree that opts allows. Like Verify, it holds the latches of the path to the node it
+// exports, so the subtrees it exports are not changed by the writers that run together.
+func (tree *BTree) Export(opts ExportOptions) (res *TreeExport, err error) {
+	defer recoverErr(&err)
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	latches.lockRoot()
+	res = &TreeExport{Root: tree.Root, Degree: tree.degree, Nodes: make([]ExportNode, 0)}
+	tree.exportNode(latches, res, opts, tree.Root, 0, nil, nil)
+	tree.metaMu.Lock()
+	res.Length = tree.length
+	tree.metaMu.Unlock()
+	return res, nil
+}
+
+// exportNode appends the node p and the nodes in its subtree to res, keys of the subtree should be between lower and
+// upper. The latch of p is held until its subtree is exported.
+func (tree *BTree) exportNode(latches *heldLatches, res *TreeExport, opts ExportOptions, p Pointer, depth int, lower, upper Key) {
+	if (opts.End != nil && lower != nil && !lower.Less(opts.End)) || (opts.Start != nil && upper != nil && !opts.Start.Less(upper)) {
+		return
+	}
+
+	latches.lock(p)
+	defer latches.unlock(p)
+	node := tree.pager.GetNode(p)
+	e := ExportNode{PageId: p, IsLeaf: node.IsLeaf(), Depth: depth, Keys: make([]string, node.Keylen()), Fill: fill(node, tree.degree)}
+	keys := make([]Key, node.Keylen())
+	for i := range keys {
+		keys[i] = node.GetKeyAt(i)
+		e.Keys[i] = fmt.Sprint(keys[i])
+	}
+	if lower != nil {
+		s := fmt.Sprint(lower)
+		e.Lower = &s
+	}
+	if upper != nil {
+		s := fmt.Sprint(upper)
+		e.Upper = &s
+	}
+	h := node.GetHeader()
+	e.Left, e.Right = h.Left, h.Right
+	if highKey := node.GetHighKey(); highKey != nil {
+		s := fmt.Sprint(highKey)
+		e.HighKey = &s
+	}
+	if !e.IsLeaf {
+		for i := 0; i <= len(keys); i++ {
+			e.Children = append(e.Children, node.GetValueAt(i).(Pointer))
+			e.Counts = append(e.Counts, node.getCountAt(i))
+		}
+	}
+	tree.pager.Unpin(node, false)
+	res.Nodes = append(res.Nodes, e)
+
+	if opts.Levels > 0 && depth+1 >= opts.Levels {
+		return
+	}
+	for i, child := range e.Children {
+		childLower, childUpper := lower, upper
+		if i > 0 {
+			childLower = keys[i-1]
+		}
+		if i < len(keys) {
+			childUpper = keys[i]
+		}
+		tree.exportNode(latches, res, opts, child, depth+1, childLower, childUpper)
+	}
+}
+
+// fill returns the fraction of the node that is used.
+func fill(node Node, degree int) float64 {
+	switch n := node.(type) {
+	case *SlottedLeafNode:
+		return float64(n.cells().used()) / float64(n.cells().capacity())
+	case *SlottedInternalNode:
+		return float64(n.cells().used()) / float64(n.cells().capacity())
+	}
+	return float64(node.Keylen()) / float64(degree-1)
+}
+
+// ExportJSON writes the nodes of the tree that opts allows as an indented TreeExport.
+func (tree *BTree) ExportJSON(w io.Writer, opts ExportOptions) error {
+	res, err := tree.Export(opts)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+// ExportDOT writes the nodes of the tree that opts allows as a Graphviz graph. Nodes are labelled with their page ids,
+// key ranges, number of keys and fill.
+func (tree *BTree) ExportDOT(w io.Writer, opts ExportOptions) error {
+	res, err := tree.Export(opts)
+	if err != nil {
+		return err
+	}
+
+	exported := make(map[Pointer]bool)
+	for _, n := range res.Nodes {
+		exported[n.PageId] = true
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph btree {\n")
+	b.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	for _, n := range res.Nodes {
+		lower, upper := "-inf", "+inf"
+		if n.Lower != nil {
+			lower = *n.Lower
+		}
+		if n.Upper != nil {
+			upper = *n.Upper
+		}
+		label := fmt.Sprintf("page %v\n[%v, %v)\n%v keys, %.0f%% full", n.PageId, lower, upper, len(n.Keys), n.Fill*100)
+		style := ""
+		if n.IsLeaf {
+			style = ", style=rounded"
+		}
+		fmt.Fprintf(&b, "\tn%v [label=%v%v];\n", n.PageId, dotQuote(label), style)
+	}
+	for _, n := range res.Nodes {
+		for i, child := range n.Children {
+			if exported[child] {
+				fmt.Fprintf(&b, "\tn%v -> n%v [label=\"%v\"];\n", n.PageId, child, n.Counts[i])
+			}
+		}
+		if exported[n.Right] {
+			fmt.Fprintf(&b, "\tn%v -> n%v [style=dashed, constraint=false];\n", n.PageId, n.Right)
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote returns s as a quoted DOT string, new lines are centered lines of the label.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
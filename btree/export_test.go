@@ -0,0 +1,117 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport_Should_Export_Every_Node(t *testing.T) {
+	tree := NewBtreeWithPager(5, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	for _, i := range rand.Perm(500) {
+		tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+	}
+
+	res, err := tree.Export(ExportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, tree.Root, res.Root)
+	assert.Equal(t, 500, res.Length)
+	assert.Equal(t, tree.Root, res.Nodes[0].PageId)
+	assert.Nil(t, res.Nodes[0].Lower)
+	assert.Nil(t, res.Nodes[0].Upper)
+
+	keys := make([]string, 0)
+	nodes := make(map[Pointer]ExportNode)
+	for _, n := range res.Nodes {
+		nodes[n.PageId] = n
+		assert.True(t, n.Fill > 0 && n.Fill <= 1, "fill of page %v is %v", n.PageId, n.Fill)
+		if n.IsLeaf {
+			assert.Equal(t, len(n.Keys), int(float64(tree.degree-1)*n.Fill+0.5))
+			keys = append(keys, n.Keys...)
+		}
+	}
+	for i, key := range keys {
+		assert.Equal(t, fmt.Sprint(PersistentKey(i)), key)
+	}
+
+	// every child is exported with the separator keys of its parent
+	for _, n := range res.Nodes {
+		for i, child := range n.Children {
+			assert.Contains(t, nodes, child)
+			if i > 0 {
+				assert.Equal(t, n.Keys[i-1], *nodes[child].Lower)
+			}
+			if i < len(n.Keys) {
+				assert.Equal(t, n.Keys[i], *nodes[child].Upper)
+			}
+			assert.Equal(t, n.Depth+1, nodes[child].Depth)
+		}
+	}
+}
+
+func TestExport_Should_Limit_Nodes_By_Levels_And_Key_Range(t *testing.T) {
+	tree, err := BulkLoad(NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}), persistentKeySource(1000), BulkLoadOptions{Degree: 5})
+	assert.NoError(t, err)
+	all, err := tree.Export(ExportOptions{})
+	assert.NoError(t, err)
+
+	res, err := tree.Export(ExportOptions{Levels: 1})
+	assert.NoError(t, err)
+	assert.Len(t, res.Nodes, 1)
+	assert.Equal(t, tree.Root, res.Nodes[0].PageId)
+	assert.NotEmpty(t, res.Nodes[0].Children)
+
+	res, err = tree.Export(ExportOptions{Levels: 2})
+	assert.NoError(t, err)
+	assert.Len(t, res.Nodes, 1+len(res.Nodes[0].Children))
+
+	res, err = tree.Export(ExportOptions{Start: PersistentKey(300), End: PersistentKey(400)})
+	assert.NoError(t, err)
+	assert.Less(t, len(res.Nodes), len(all.Nodes))
+	keys := make([]string, 0)
+	for _, n := range res.Nodes {
+		if n.IsLeaf {
+			keys = append(keys, n.Keys...)
+		}
+	}
+	// leaves that have keys in the range are exported, and only the leaves around the range have other keys
+	for i := 300; i < 400; i++ {
+		assert.Contains(t, keys, fmt.Sprint(PersistentKey(i)))
+	}
+	assert.Less(t, len(keys), 100+2*tree.degree)
+}
+
+func TestExport_Should_Write_JSON_And_DOT(t *testing.T) {
+	tree := NewBtreeWithPager(50, NewInMemoryPager(&PersistentKeySerializer{}, &VarStringValueSerializer{}))
+	for _, i := range rand.Perm(1000) {
+		tree.Insert(PersistentKey(i), strings.Repeat("v", i%100))
+	}
+	res, err := tree.Export(ExportOptions{})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, tree.ExportJSON(&buf, ExportOptions{}))
+	var decoded TreeExport
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, res, &decoded)
+
+	buf.Reset()
+	assert.NoError(t, tree.ExportDOT(&buf, ExportOptions{}))
+	dot := buf.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph btree {\n"))
+	assert.True(t, strings.HasSuffix(dot, "}\n"))
+	for _, n := range res.Nodes {
+		assert.Contains(t, dot, fmt.Sprintf("\tn%v [label=\"page %v\\n", n.PageId, n.PageId))
+		for _, child := range n.Children {
+			assert.Contains(t, dot, fmt.Sprintf("\tn%v -> n%v ", n.PageId, child))
+		}
+		if n.Right != 0 {
+			assert.Contains(t, dot, fmt.Sprintf("\tn%v -> n%v [style=dashed", n.PageId, n.Right))
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package btree
+
+import (
+	"fmt"
+)
+
+// FilePage is a PersistentPage which is read from or will be written to a database file.
+type FilePage struct {
+	pageId Pointer
+	data   []byte
+}
+
+func (f *FilePage) GetData() []byte {
+	return f.data
+}
+
+func (f *FilePage) GetPageId() Pointer {
+	return f.pageId
+}
+
+// FilePagerOptions configures a FilePager. Zero value of every field means its default.
+type FilePagerOptions struct {
+	// PoolSize is the number of pages that are kept in memory. DefaultPoolSize is used when it is 0.
+	PoolSize int
+
+	// PageSize is the size of pages in the database file. It should be a power of two between MinPageSize and
+	// MaxPageSize. When it is 0, page size of an existing file is used, and new files are created with DefaultPageSize.
+	PageSize int
+
+	// EnableWAL makes every committed transaction durable by writing it to a write-ahead log next to the database file
+	// before any of its pages are written to the database file. Database file is recovered from the log when the
+	// pager is opened after a crash.
+	EnableWAL bool
+
+	// WALCheckpointSize is the size of the write-ahead log in bytes after which dirty pages are written to the
+	// database file and the log is truncated. DefaultWALCheckpointSize is used when it is 0.
+	WALCheckpointSize int64
+
+	// openFile is used to open database and log files, it is replaced by tests to inject faults.
+	openFile func(path string) (storageFile, error)
+}
+
+// FilePager is a Pager implementation which persists every node to a fixed size page in a single database file.
+// Page size is chosen when the file is created(see FilePagerOptions.PageSize) and it cannot be changed later.
+//
+// Pages are cached in a bounded buffer pool. Nodes returned by GetNode, NewLeafNode and NewInternalNode are pinned
+// in the pool until they are unpinned, and pinned pages are never evicted. Hence, every node should be unpinned
+// exactly once, and it should not be used after it is unpinned. Dirty pages are written back to the file when they are
+// evicted or when the pager is flushed.
+//
+// FilePager is a TxPager. Pages modified by a transaction are not written to the file until the transaction commits
+// and they are reverted in memory if it aborts. When write-ahead log is enabled committed transactions survive
+// crashes as well(see wal).
+type FilePager struct {
+	disk            *diskManager
+	pool            *bufferPool
+	wal             *wal
+	tx              *filePagerTx
+	lastTxId        uint64
+	checkpointSize  int64
+	KeySerializer   KeySerializer
+	ValueSerializer ValueSerializer
+}
+
+// NewFilePager opens the database file at the given path or creates it if it does not exist.
+func NewFilePager(path string, keySerializer KeySerializer, valSerializer ValueSerializer) (*FilePager, error) {
+	return NewFilePagerWithOptions(path, keySerializer, valSerializer, FilePagerOptions{})
+}
+
+// NewFilePagerWithOptions is the same as NewFilePager but lets caller configure the pager.
+func NewFilePagerWithOptions(path string, keySerializer KeySerializer, valSerializer ValueSerializer, opts FilePagerOptions) (*FilePager, error) {
+	if opts.PoolSize == 0 {
+		opts.PoolSize = DefaultPoolSize
+	}
+	if opts.WALCheckpointSize == 0 {
+		opts.WALCheckpointSize = DefaultWALCheckpointSize
+	}
+	if opts.openFile == nil {
+		opts.openFile = openOsFile
+	}
+	if opts.PageSize != 0 {
+		if err := validatePageSize(opts.PageSize); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := opts.openFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var log *wal
+	if opts.EnableWAL {
+		log, err = openWal(path+walSuffix, file, opts.openFile)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	disk, err := newDiskManager(file, opts.PageSize)
+	if err != nil {
+		if log != nil {
+			log.close()
+		}
+		return nil, err
+	}
+
+	pager := &FilePager{
+		disk:            disk,
+		pool:            newBufferPool(disk, opts.PoolSize),
+		wal:             log,
+		checkpointSize:  opts.WALCheckpointSize,
+		KeySerializer:   keySerializer,
+		ValueSerializer: valSerializer,
+	}
+	if pager.ValueSerializer == nil {
+		pager.ValueSerializer = &SlotPointerValueSerializer{}
+	}
+
+	return pager, nil
+}
+
+// newNode wraps the given page with the node type that is stored in it.
+func (f *FilePager) newNode(page PersistentPage) Node {
+	h := ReadPersistentNodeHeader(page.GetData())
+	if h.IsLeaf == freePageType {
+		panic(fmt.Sprintf("page %v is free, it is not a node", page.GetPageId()))
+	}
+	if h.IsLeaf == overflowPageType {
+		panic(fmt.Sprintf("page %v is an overflow page, it is not a node", page.GetPageId()))
+	}
+	return wrapNode(f, page)
+}
+
+func (f *FilePager) NewInternalNode(firstPointer Pointer) Node {
+	fr := f.allocatePage()
+	fr.node = initInternalNode(f, &fr.page, firstPointer)
+	return fr.node
+}
+
+func (f *FilePager) NewLeafNode() Node {
+	fr := f.allocatePage()
+	fr.node = initLeafNode(f, &fr.page)
+	return fr.node
+}
+
+func (f *FilePager) GetNode(p Pointer) Node {
+	if p == 0 || p == MetaPageId || p >= f.disk.numPages {
+		return nil
+	}
+
+	fr := f.fetch(p)
+	if fr.node == nil {
+		fr.node = f.newNode(&fr.page)
+	}
+	return fr.node
+}
+
+func (f *FilePager) NewOverflowPage() PersistentPage {
+	fr := f.allocatePage()
+	writeOverflowPageHeader(&overflowPageHeader{Type: overflowPageType}, fr.page.GetData())
+	return &fr.page
+}
+
+func (f *FilePager) GetOverflowPage(p Pointer) PersistentPage {
+	if p == 0 || p == MetaPageId || p >= f.disk.numPages {
+		panic(fmt.Sprintf("page %v is not an overflow page", p))
+	}
+
+	fr := f.fetch(p)
+	if readOverflowPageHeader(fr.page.GetData()).Type != overflowPageType {
+		f.unpin(p, false)
+		panic(fmt.Sprintf("page %v is not an overflow page", p))
+	}
+	return &fr.page
+}
+
+func (f *FilePager) GetMetaPage() PersistentPage {
+	return &f.fetch(MetaPageId).page
+}
+
+func (f *FilePager) GetKeySerializer() KeySerializer {
+	return f.KeySerializer
+}
+
+func (f *FilePager) GetValueSerializer() ValueSerializer {
+	return f.ValueSerializer
+}
+
+func (f *FilePager) GetPageSize() int {
+	return f.disk.pageSize
+}
+
+func (f *FilePager) Unpin(n Node, isDirty bool) {
+	f.UnpinByPointer(n.GetPageId(), isDirty)
+}
+
+func (f *FilePager) UnpinByPointer(p Pointer, isDirty bool) {
+	f.unpin(p, isDirty)
+}
+
+// Flush writes all dirty pages in the buffer pool to the database file and commits the file to stable storage. If
+// write-ahead log is enabled it is truncated afterwards. It returns ErrTxActive if there is an active transaction.
+func (f *FilePager) Flush() error {
+	return f.checkpoint()
+}
+
+// Close flushes and closes the database file. Pager should not be used after it is closed.
+func (f *FilePager) Close() error {
+	err := f.Flush()
+	if f.wal != nil {
+		if walErr := f.wal.close(); err == nil {
+			err = walErr
+		}
+	}
+	if diskErr := f.disk.close(); err == nil {
+		err = diskErr
+	}
+	return err
+}
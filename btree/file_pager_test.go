@@ -0,0 +1,65 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilePager_Inserted_Items_Should_Be_Found_After_Pager_Is_Reopened(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &StringKeySerializer{Len: 11}, &StringValueSerializer{Len: 11})
+	assert.NoError(t, err)
+
+	tree := NewBtreeWithPager(10, pager)
+	n := 1000
+	for _, i := range rand.Perm(n) {
+		tree.Insert(StringKey(fmt.Sprintf("selam_%05d", i)), fmt.Sprintf("value_%05d", i))
+	}
+	tree.InsertOrReplace(StringKey("selam_00500"), "new_value_5")
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePager(path, &StringKeySerializer{Len: 11}, &StringValueSerializer{Len: 11})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	for i := 0; i < n; i++ {
+		expected := fmt.Sprintf("value_%05d", i)
+		if i == 500 {
+			expected = "new_value_5"
+		}
+		assert.Equal(t, expected, tree.Find(StringKey(fmt.Sprintf("selam_%05d", i))))
+	}
+}
+
+func TestFilePager_Deleted_Items_Should_Not_Be_Found(t *testing.T) {
+	pager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &SlotPointerValueSerializer{})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	tree := NewBtreeWithPager(4, pager)
+	n := 1000
+	for _, i := range rand.Perm(n) {
+		tree.Insert(PersistentKey(i), SlotPointer{PageId: int64(i), SlotIdx: int16(i)})
+	}
+
+	for _, i := range rand.Perm(n) {
+		assert.Equal(t, SlotPointer{PageId: int64(i), SlotIdx: int16(i)}, tree.Find(PersistentKey(i)))
+		assert.True(t, tree.Delete(PersistentKey(i)))
+		assert.Nil(t, tree.Find(PersistentKey(i)))
+	}
+}
+
+func TestFilePager_Should_Reject_Files_Which_Are_Not_Database_Files(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not_a_tree.db")
+	assert.NoError(t, os.WriteFile(path, []byte("definitely not a b+ tree"), 0644))
+
+	_, err := NewFilePager(path, &PersistentKeySerializer{}, &SlotPointerValueSerializer{})
+	assert.ErrorIs(t, err, ErrNotADatabaseFile)
+}
@@ -0,0 +1,86 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// freePageType is written to the byte where IsLeaf of a node is stored, so that a free page is never mistaken for a
+// node.
+const freePageType int8 = -1
+
+// freePageHeader is written at the beginning of freed pages. Free pages are linked to each other by Next and form the
+// free list whose head is kept in the file header. Since the list is kept in the pages themselves, it survives
+// restarts without any extra space.
+type freePageHeader struct {
+	Checksum uint32
+	Type     int8
+	Next     Pointer
+}
+
+func readFreePageHeader(data []byte) *freePageHeader {
+	reader := bytes.NewReader(data)
+	dest := freePageHeader{}
+	err := binary.Read(reader, binary.BigEndian, &dest)
+	CheckErr(err)
+	return &dest
+}
+
+func writeFreePageHeader(h *freePageHeader, dest []byte) {
+	buf := bytes.Buffer{}
+	err := binary.Write(&buf, binary.BigEndian, h)
+	CheckErr(err)
+	copy(dest, buf.Bytes())
+}
+
+// allocatePage returns a pinned and zeroed frame for a new node. Pages in the free list are reused before the file
+// is grown.
+func (f *FilePager) allocatePage() *frame {
+	headerFrame := f.fetch(0)
+
+	h := readFileHeader(headerFrame.page.GetData())
+	if h.FreeListHead == 0 {
+		f.unpin(0, false)
+		return f.newPage()
+	}
+
+	fr := f.fetch(h.FreeListHead)
+	h.FreeListHead = readFreePageHeader(fr.page.GetData()).Next
+	writeFileHeader(h, headerFrame.page.GetData())
+	f.unpin(0, true)
+
+	data := fr.page.GetData()
+	for i := range data {
+		data[i] = 0
+	}
+	fr.node = nil
+	fr.isDirty = true
+	return fr
+}
+
+func (f *FilePager) FreeNode(p Pointer) {
+	if p == 0 || p == MetaPageId || p >= f.disk.numPages {
+		panic(fmt.Sprintf("page %v cannot be freed", p))
+	}
+
+	if f.pool.isPinned(p) {
+		panic(fmt.Sprintf("page %v cannot be freed while it is pinned", p))
+	}
+	fr := f.fetch(p)
+	if ReadPersistentNodeHeader(fr.page.GetData()).IsLeaf == freePageType {
+		f.unpin(p, false)
+		panic(fmt.Sprintf("page %v is already free", p))
+	}
+
+	headerFrame := f.fetch(0)
+
+	h := readFileHeader(headerFrame.page.GetData())
+	writeFreePageHeader(&freePageHeader{Type: freePageType, Next: h.FreeListHead}, fr.page.GetData())
+	fr.node = nil
+	h.FreeListHead = p
+	writeFileHeader(h, headerFrame.page.GetData())
+
+	f.unpin(0, true)
+	f.unpin(p, true)
+}
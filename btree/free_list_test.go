@@ -0,0 +1,64 @@
+package btree
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreeList_Deleted_Pages_Should_Be_Reused_By_New_Nodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, FilePagerOptions{PoolSize: 32})
+	assert.NoError(t, err)
+
+	tree := NewBtreeWithPager(4, pager)
+	n := 2000
+	for i := 0; i < n; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+	numPages := pager.disk.numPages
+	for _, i := range rand.Perm(n) {
+		tree.Delete(PersistentKey(i))
+	}
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < n; i++ {
+			tree.Insert(PersistentKey(i), "value")
+		}
+		for _, i := range rand.Perm(n) {
+			tree.Delete(PersistentKey(i))
+		}
+	}
+	assert.LessOrEqual(t, int(pager.disk.numPages), int(numPages))
+	assert.NoError(t, pager.Close())
+
+	// free list should survive a restart
+	pager, err = NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, FilePagerOptions{PoolSize: 32})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	for i := 0; i < n; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+	assert.LessOrEqual(t, int(pager.disk.numPages), int(numPages))
+	for i := 0; i < n; i++ {
+		assert.Contains(t, tree.Find(PersistentKey(i)), "value")
+	}
+}
+
+func TestFreeList_FreeNode_Should_Panic_When_Node_Is_Pinned_Or_Already_Free(t *testing.T) {
+	pager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	node := pager.NewLeafNode()
+	assert.Panics(t, func() { pager.FreeNode(node.GetPageId()) })
+
+	pager.Unpin(node, true)
+	pager.FreeNode(node.GetPageId())
+	assert.Panics(t, func() { pager.FreeNode(node.GetPageId()) })
+	assert.Panics(t, func() { pager.GetNode(node.GetPageId()) })
+}
@@ -0,0 +1,150 @@
+package btree
+
+import (
+	"fmt"
+	"sync"
+)
+
+// InMemoryPager is a Pager which keeps every node in memory. Unlike NoopPersistentPager, its page table and page_id
+// allocator belong to the instance, hence any number of trees can have their own InMemoryPager in the same process.
+// Freed page_ids are reused by new nodes. It is safe to be used by multiple goroutines.
+type InMemoryPager struct {
+	mu         sync.RWMutex
+	nodes      map[Pointer]Node
+	overflow   map[Pointer]PersistentPage
+	freePages  []Pointer
+	lastPageId Pointer
+	meta       *NoopPersistentPage
+	pageSize   int
+
+	KeySerializer   KeySerializer
+	ValueSerializer ValueSerializer
+}
+
+func NewInMemoryPager(keySerializer KeySerializer, valSerializer ValueSerializer) *InMemoryPager {
+	pager, err := NewInMemoryPagerWithPageSize(keySerializer, valSerializer, DefaultPageSize)
+	CheckErr(err)
+	return pager
+}
+
+// NewInMemoryPagerWithPageSize is the same as NewInMemoryPager but every page of the pager is pageSize bytes. Page size
+// should be a power of two between MinPageSize and MaxPageSize.
+func NewInMemoryPagerWithPageSize(keySerializer KeySerializer, valSerializer ValueSerializer, pageSize int) (*InMemoryPager, error) {
+	if err := validatePageSize(pageSize); err != nil {
+		return nil, err
+	}
+	if valSerializer == nil {
+		valSerializer = &SlotPointerValueSerializer{}
+	}
+
+	return &InMemoryPager{
+		nodes:           make(map[Pointer]Node),
+		overflow:        make(map[Pointer]PersistentPage),
+		lastPageId:      MetaPageId,
+		meta:            NewNoopPersistentPageWithSize(MetaPageId, pageSize),
+		pageSize:        pageSize,
+		KeySerializer:   keySerializer,
+		ValueSerializer: valSerializer,
+	}, nil
+}
+
+// allocatePageId returns a freed page_id if there is any, otherwise a new one. It should be called while mu is held.
+func (m *InMemoryPager) allocatePageId() Pointer {
+	if len(m.freePages) > 0 {
+		p := m.freePages[len(m.freePages)-1]
+		m.freePages = m.freePages[:len(m.freePages)-1]
+		return p
+	}
+
+	m.lastPageId++
+	return m.lastPageId
+}
+
+func (m *InMemoryPager) NewInternalNode(firstPointer Pointer) Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node := initInternalNode(m, NewNoopPersistentPageWithSize(m.allocatePageId(), m.pageSize), firstPointer)
+
+	m.nodes[node.GetPageId()] = node
+	return node
+}
+
+func (m *InMemoryPager) NewLeafNode() Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node := initLeafNode(m, NewNoopPersistentPageWithSize(m.allocatePageId(), m.pageSize))
+
+	m.nodes[node.GetPageId()] = node
+	return node
+}
+
+func (m *InMemoryPager) GetNode(p Pointer) Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.nodes[p]
+}
+
+func (m *InMemoryPager) Unpin(n Node, isDirty bool) {}
+
+func (m *InMemoryPager) UnpinByPointer(p Pointer, isDirty bool) {}
+
+func (m *InMemoryPager) FreeNode(p Pointer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, isNode := m.nodes[p]
+	_, isOverflow := m.overflow[p]
+	if !isNode && !isOverflow {
+		panic(fmt.Sprintf("page %v cannot be freed, it does not exist", p))
+	}
+	delete(m.nodes, p)
+	delete(m.overflow, p)
+	m.freePages = append(m.freePages, p)
+}
+
+func (m *InMemoryPager) NewOverflowPage() PersistentPage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	page := NewNoopPersistentPageWithSize(m.allocatePageId(), m.pageSize)
+	m.overflow[page.GetPageId()] = page
+	return page
+}
+
+func (m *InMemoryPager) GetOverflowPage(p Pointer) PersistentPage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	page, ok := m.overflow[p]
+	if !ok {
+		panic(fmt.Sprintf("page %v is not an overflow page", p))
+	}
+	return page
+}
+
+func (m *InMemoryPager) GetMetaPage() PersistentPage {
+	return m.meta
+}
+
+func (m *InMemoryPager) GetKeySerializer() KeySerializer {
+	return m.KeySerializer
+}
+
+func (m *InMemoryPager) GetValueSerializer() ValueSerializer {
+	return m.ValueSerializer
+}
+
+func (m *InMemoryPager) GetPageSize() int {
+	return m.pageSize
+}
+
+// PageCount returns the number of nodes and overflow pages that are allocated and not freed yet.
+func (m *InMemoryPager) PageCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.nodes) + len(m.overflow)
+}
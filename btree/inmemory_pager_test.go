@@ -0,0 +1,62 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryPager_Trees_Should_Not_Share_Pages(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("tree_%v", i)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tree := NewBtreeWithPager(4, NewInMemoryPager(&StringKeySerializer{Len: 11}, &StringValueSerializer{Len: 20}))
+			n := 2000
+			for _, i := range rand.Perm(n) {
+				tree.Insert(StringKey(fmt.Sprintf("selam_%05d", i)), fmt.Sprintf("%v_%05d", name, i))
+			}
+			for i := 0; i < n; i++ {
+				val := tree.Find(StringKey(fmt.Sprintf("selam_%05d", i)))
+				assert.Contains(t, val, fmt.Sprintf("%v_%05d", name, i))
+			}
+		})
+	}
+}
+
+func TestInMemoryPager_Freed_Pages_Should_Be_Reused(t *testing.T) {
+	pager := NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	tree := NewBtreeWithPager(4, pager)
+	n := 1000
+	for i := 0; i < n; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+	pageCount, lastPageId := pager.PageCount(), pager.lastPageId
+
+	for _, i := range rand.Perm(n) {
+		tree.Delete(PersistentKey(i))
+	}
+	assert.Equal(t, 1, pager.PageCount())
+
+	for i := 0; i < n; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+	assert.LessOrEqual(t, pager.PageCount(), pageCount)
+	assert.Equal(t, lastPageId, pager.lastPageId)
+}
+
+func TestInMemoryPager_Should_Reopen_Tree(t *testing.T) {
+	pager := NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	tree := NewBtreeWithPager(4, pager)
+	for i := 0; i < 100; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	opened, err := OpenBtree(pager)
+	assert.NoError(t, err)
+	assert.Equal(t, tree.Root, opened.Root)
+	assert.Contains(t, opened.Find(PersistentKey(50)), "value")
+}
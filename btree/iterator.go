@@ -1,5 +1,8 @@
 package btree
 
+// TreeIterator walks the values of the leaves in both directions. It is positioned between two values, currIdx is the
+// index of the value Next returns in the leaf curr and the value Prev returns is the one before it, hence calling Prev
+// after Next returns the same value again.
 type TreeIterator struct {
 	tree    *BTree
 	curr    Pointer
@@ -7,42 +10,95 @@ type TreeIterator struct {
 	pager   Pager
 }
 
+// Next is the same as TryNext, but it panics if an error occurs.
 func (it *TreeIterator) Next() interface{} {
-	currNode := it.pager.GetNode(it.curr)
+	val, err := it.TryNext()
+	CheckErr(err)
+	return val
+}
+
+// TryNext returns the next value of the iterator, or nil when there is no value left. Errors of serializers and the
+// pager are returned.
+func (it *TreeIterator) TryNext() (val interface{}, err error) {
+	defer recoverErr(&err)
+	defer it.tree.unlockRead(it.tree.lockRead())
+	latches := it.tree.newHeldLatches(false)
+	defer latches.release()
+
+	currNode := it.pager.GetNode(latches.lock(it.curr))
 	h := currNode.GetHeader()
 
 	// if there is no element left in node proceed to next node
 	if h.KeyLen == int16(it.currIdx) {
 		it.pager.Unpin(currNode, false)
 		if h.Right == 0 {
-			return nil
+			return nil, nil
 		}
-		it.curr = h.Right
+		it.curr = latches.lock(h.Right)
+		latches.releaseAncestors()
 		currNode = it.pager.GetNode(it.curr)
 		it.currIdx = 0
 	}
 
-	val := currNode.GetValueAt(it.currIdx)
-	it.pager.Unpin(currNode, false)
+	defer it.pager.Unpin(currNode, false)
+	val = currNode.GetValueAt(it.currIdx)
 	it.currIdx++
+	return val, nil
+}
+
+// Prev is the same as TryPrev, but it panics if an error occurs.
+func (it *TreeIterator) Prev() interface{} {
+	val, err := it.TryPrev()
+	CheckErr(err)
 	return val
 }
 
+// TryPrev returns the previous value of the iterator, or nil when there is no value left. Errors of serializers and
+// the pager are returned.
+func (it *TreeIterator) TryPrev() (val interface{}, err error) {
+	defer recoverErr(&err)
+	defer it.tree.unlockRead(it.tree.lockRead())
+	latches := it.tree.newHeldLatches(false)
+	defer latches.release()
+
+	currNode := it.pager.GetNode(latches.lock(it.curr))
+
+	// if there is no element left in node proceed to previous node, which is found by going down from the root with
+	// the first key of the node since Left links are not latched by readers(see navigate.go)
+	if it.currIdx == 0 {
+		h := currNode.GetHeader()
+		var first Key
+		if currNode.Keylen() > 0 {
+			first = currNode.GetKeyAt(0)
+		}
+		it.pager.Unpin(currNode, false)
+		if h.Left == 0 || first == nil {
+			return nil, nil
+		}
+		var idx int
+		if currNode, idx = it.tree.lastBefore(latches, first); currNode == nil {
+			return nil, nil
+		}
+		it.curr, it.currIdx = currNode.GetPageId(), idx+1
+	}
+
+	defer it.pager.Unpin(currNode, false)
+	it.currIdx--
+	val = currNode.GetValueAt(it.currIdx)
+	return val, nil
+}
+
 // NewTreeIterator creates an iterator which starts from the smallest key in the tree and iterates through up until
 // the largest key.
 func NewTreeIterator(tree *BTree, pager Pager) *TreeIterator {
-	curr := tree.GetRoot()
-	for !curr.IsLeaf() {
-		old := curr
-		curr = tree.pager.GetNode(curr.GetValueAt(0).(Pointer))
-		tree.pager.Unpin(old, false)
-	}
-
-	defer tree.pager.Unpin(curr, false)
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	stack := tree.descend(latches, func(node Node) int { return 0 })
 
 	return &TreeIterator{
 		tree:    tree,
-		curr:    curr.GetPageId(),
+		curr:    stack[len(stack)-1].Node,
 		currIdx: 0,
 		pager:   pager,
 	}
@@ -61,3 +117,38 @@ func NewTreeIteratorWithKey(key Key, tree *BTree, pager Pager) *TreeIterator {
 		pager:   pager,
 	}
 }
+
+// NewReverseTreeIterator creates an iterator which starts from the largest key in the tree, Prev iterates through
+// down until the smallest key.
+func NewReverseTreeIterator(tree *BTree, pager Pager) *TreeIterator {
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	stack := tree.descend(latches, func(node Node) int { return node.Keylen() })
+	leaf := tree.pager.GetNode(stack[len(stack)-1].Node)
+	defer tree.pager.Unpin(leaf, false)
+
+	return &TreeIterator{
+		tree:    tree,
+		curr:    leaf.GetPageId(),
+		currIdx: leaf.Keylen(),
+		pager:   pager,
+	}
+}
+
+// NewReverseTreeIteratorWithKey starts the iterator from the given key if it exists otherwise starts from the largest
+// key which is smaller than given key, Prev iterates through down until the smallest key.
+func NewReverseTreeIteratorWithKey(key Key, tree *BTree, pager Pager) *TreeIterator {
+	val, stack := tree.FindAndGetStack(key, Read)
+	leaf, idx := stack[len(stack)-1].Node, stack[len(stack)-1].Index
+	if val != nil {
+		idx++
+	}
+
+	return &TreeIterator{
+		tree:    tree,
+		curr:    leaf,
+		currIdx: idx,
+		pager:   pager,
+	}
+}
@@ -40,3 +40,60 @@ func TestTreeIterator_Should_Return_All_Values_When_Initialized_Without_A_Key(t
 	}
 	assert.Nil(t, it.Next())
 }
+
+func TestTreeIterator_Should_Return_All_Values_In_Reverse_When_Initialized_Without_A_Key(t *testing.T) {
+	tree := NewBtreeWithPager(3, NewNoopPager(&StringKeySerializer{Len: 11}, &StringValueSerializer{Len: 11}))
+	log.SetOutput(ioutil.Discard)
+	n := 10000
+	for _, i := range rand.Perm(n) {
+		tree.Insert(StringKey(fmt.Sprintf("selam_%05d", i)), fmt.Sprintf("value_%05d", i))
+	}
+
+	// deleting odd keys merges leaves, whose Left links should still be correct
+	for _, i := range rand.Perm(n / 2) {
+		tree.Delete(StringKey(fmt.Sprintf("selam_%05d", 2*i+1)))
+	}
+
+	it := NewReverseTreeIterator(tree, tree.pager)
+	for i := n - 2; i >= 0; i -= 2 {
+		val := it.Prev()
+		assert.Equal(t, fmt.Sprintf("value_%05d", i), val.(string))
+	}
+	assert.Nil(t, it.Prev())
+}
+
+func TestTreeIterator_Should_Return_Every_Value_Smaller_Than_Or_Equal_To_Key_When_Initialized_With_A_Key(t *testing.T) {
+	tree := NewBtreeWithPager(3, NewNoopPager(&StringKeySerializer{Len: 11}, &StringValueSerializer{Len: 11}))
+	log.SetOutput(ioutil.Discard)
+	n := 10000
+	for _, i := range rand.Perm(n) {
+		tree.Insert(StringKey(fmt.Sprintf("selam_%05d", 2*i)), fmt.Sprintf("value_%05d", 2*i))
+	}
+
+	for _, start := range []int{9000, 9001} {
+		it := NewReverseTreeIteratorWithKey(StringKey(fmt.Sprintf("selam_%05d", start)), tree, tree.pager)
+		i := 9000
+		for val := it.Prev(); val != nil; val = it.Prev() {
+			assert.Equal(t, fmt.Sprintf("value_%05d", i), val.(string))
+			i -= 2
+		}
+		assert.Equal(t, -2, i)
+	}
+}
+
+func TestTreeIterator_Prev_Should_Return_The_Value_Returned_By_Next(t *testing.T) {
+	tree := NewBtreeWithPager(3, NewNoopPager(&StringKeySerializer{Len: 11}, &StringValueSerializer{Len: 11}))
+	log.SetOutput(ioutil.Discard)
+	for i := 0; i < 100; i++ {
+		tree.Insert(StringKey(fmt.Sprintf("selam_%05d", i)), fmt.Sprintf("value_%05d", i))
+	}
+
+	it := NewTreeIterator(tree, tree.pager)
+	assert.Nil(t, it.Prev())
+	for i := 0; i < 50; i++ {
+		it.Next()
+	}
+	assert.Equal(t, "value_00049", it.Prev())
+	assert.Equal(t, "value_00048", it.Prev())
+	assert.Equal(t, "value_00048", it.Next())
+}
@@ -0,0 +1,464 @@
+package btree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+  Latch crabbing:
+
+  Every node has a read/write latch which an operation holds while it uses the node. Find, Insert, InsertOrReplace and
+  Delete go down from the root by crabbing latches, the latch of a child is taken before the latch of its parent is
+  released. Readers take shared latches and hold at most two of them at a time, except Verify and Export, which hold
+  the latches of the path to the node they read so that the subtrees they walk are not split or merged. Writers take
+  exclusive latches and keep the latches of the ancestors of a node only until the node is safe, that is, the
+  operation cannot split, merge or redistribute it, hence cannot modify its ancestors(see isSafe). Writers in
+  different subtrees do not block each other once they are below the lowest node they both change. Readers of an
+  optimistic tree do not take latches at all(see olc.go).
+
+  Root pointer of the tree has a latch too, which is taken before the latch of the root node like the latch of a
+  parent, since the root changes when it is split or when it is left with a single child.
+
+  Latches are taken from top to bottom, and from left to right between the nodes of a level: when a node is split or
+  merged with the node on its right, the Left link of the next node is changed, so it is latched as well. Readers
+  follow Right links by crabbing too, but they never follow Left links, they go down from the root again to the node
+  on the left instead(see navigate.go). Writers that merge or redistribute a node latch its siblings while they hold
+  its parent, and release the latches of a level before they go up to the next one, since the nodes they hold could be
+  the next nodes of another writer.
+
+  Subtree counts of every node on the path change when a key is inserted or deleted, so a writer adds its delta to the
+  count of the child it goes to before it releases a node. Writer goes down once assuming that the key is inserted or
+  deleted, and if the leaf turns out to have the key already or not to have it, it goes down again holding every latch
+  on the path and counts the path again from the leaf up(see recountPath).
+
+  Every other operation that only reads the tree, such as Rank, Min or iterators, crabs shared latches as well(see
+  lockRead). Operations that modify many nodes, such as DeleteRange or Apply, run alone: they hold opLatch exclusively
+  while crabbing operations hold it shared. Operations of a tree whose pager is a TxPager, like FilePager, run alone
+  as well, since a transaction of the pager is shared by every goroutine. Other pagers should be safe for concurrent
+  use, like InMemoryPager.
+*/
+
+// latchTable keeps the latches of the pages that are latched or waited for by an operation.
+type latchTable struct {
+	mu      sync.Mutex
+	latches map[Pointer]*pageLatch
+}
+
+type pageLatch struct {
+	sync.RWMutex
+	users int // number of operations that hold the latch or wait for it
+}
+
+func (t *latchTable) lock(p Pointer, exclusive bool) {
+	t.mu.Lock()
+	if t.latches == nil {
+		t.latches = make(map[Pointer]*pageLatch)
+	}
+	l, ok := t.latches[p]
+	if !ok {
+		l = &pageLatch{}
+		t.latches[p] = l
+	}
+	l.users++
+	t.mu.Unlock()
+
+	if exclusive {
+		l.Lock()
+	} else {
+		l.RLock()
+	}
+}
+
+func (t *latchTable) unlock(p Pointer, exclusive bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// latch is released before it is removed, so that the next operation which latches the page sees the changes
+	l := t.latches[p]
+	if exclusive {
+		l.Unlock()
+	} else {
+		l.RUnlock()
+	}
+	l.users--
+	if l.users == 0 {
+		delete(t.latches, p)
+	}
+}
+
+// heldLatches are the latches that an operation holds, in the order they are taken. Methods of a nil *heldLatches do
+// nothing, it is passed by operations that run alone.
+type heldLatches struct {
+	tree      *BTree
+	exclusive bool
+	root      bool // true while the latch of the root pointer is held
+	pages     []Pointer
+
+	// rootWritten and written are the root pointer and the pages whose versions are odd until their latches are
+	// released(see write). Low versions of the pages in lowered are increased before their versions(see raiseLow).
+	rootWritten bool
+	written     []Pointer
+	lowered     []Pointer
+}
+
+func (tree *BTree) newHeldLatches(exclusive bool) *heldLatches {
+	return &heldLatches{tree: tree, exclusive: exclusive}
+}
+
+func (h *heldLatches) lockRoot() {
+	if h == nil {
+		return
+	}
+	if h.exclusive {
+		h.tree.rootLatch.Lock()
+	} else {
+		h.tree.rootLatch.RLock()
+	}
+	h.root = true
+}
+
+func (h *heldLatches) unlockRoot() {
+	if h == nil || !h.root {
+		return
+	}
+	if h.rootWritten {
+		h.tree.versions.root.Add(1)
+		h.rootWritten = false
+	}
+	if h.exclusive {
+		h.tree.rootLatch.Unlock()
+	} else {
+		h.tree.rootLatch.RUnlock()
+	}
+	h.root = false
+}
+
+// lock latches the page and returns it. It does nothing if p is 0.
+func (h *heldLatches) lock(p Pointer) Pointer {
+	if h == nil || p == 0 {
+		return p
+	}
+	h.tree.latches.lock(p, h.exclusive)
+	h.pages = append(h.pages, p)
+	return p
+}
+
+// unlock releases the latch of the page if it is held.
+func (h *heldLatches) unlock(p Pointer) {
+	if h == nil {
+		return
+	}
+	for i, held := range h.pages {
+		if held == p {
+			h.endWrite(p)
+			h.tree.latches.unlock(p, h.exclusive)
+			h.pages = append(h.pages[:i], h.pages[i+1:]...)
+			return
+		}
+	}
+}
+
+// unlockNodes releases the latches of the nodes if they are held, nil nodes are skipped.
+func (h *heldLatches) unlockNodes(nodes ...Node) {
+	if h == nil {
+		return
+	}
+	for _, node := range nodes {
+		if node != nil {
+			h.unlock(node.GetPageId())
+		}
+	}
+}
+
+// releaseAncestors releases every latch except the last page that is latched.
+func (h *heldLatches) releaseAncestors() {
+	if h == nil {
+		return
+	}
+	h.unlockRoot()
+	for _, p := range h.pages[:len(h.pages)-1] {
+		h.endWrite(p)
+		h.tree.latches.unlock(p, h.exclusive)
+	}
+	h.pages = append(h.pages[:0], h.pages[len(h.pages)-1])
+}
+
+// release releases every latch, it should be deferred by the operation.
+func (h *heldLatches) release() {
+	if h == nil {
+		return
+	}
+	h.unlockRoot()
+	for _, p := range h.pages {
+		h.endWrite(p)
+		h.tree.latches.unlock(p, h.exclusive)
+	}
+	h.pages = nil
+}
+
+// write makes the version of the latched page odd before its keys or children are changed, if readers of the tree are
+// optimistic. Version is increased again when the latch is released.
+func (h *heldLatches) write(p Pointer) {
+	if h == nil || !h.tree.isOptimistic() {
+		return
+	}
+	for _, w := range h.written {
+		if w == p {
+			return
+		}
+	}
+	h.tree.versions.of(p).Add(1)
+	h.written = append(h.written, p)
+}
+
+// writeRoot is the same as write, but for the root pointer of the tree.
+func (h *heldLatches) writeRoot() {
+	if h == nil || !h.tree.isOptimistic() || h.rootWritten {
+		return
+	}
+	h.tree.versions.root.Add(1)
+	h.rootWritten = true
+}
+
+// raiseLow is the same as write, but the page loses its smallest keys to the node on its left or it is freed, hence
+// its low version is increased as well when its latch is released, so that optimistic readers which read the page
+// before do not read it again(see olc.go).
+func (h *heldLatches) raiseLow(p Pointer) {
+	if h == nil || !h.tree.isOptimistic() {
+		return
+	}
+	h.write(p)
+	for _, l := range h.lowered {
+		if l == p {
+			return
+		}
+	}
+	h.lowered = append(h.lowered, p)
+}
+
+// endWrite publishes the page if it is written, before its versions are increased again(see olc.go). A page whose low
+// version is increased is not published, since it could be freed.
+func (h *heldLatches) endWrite(p Pointer) {
+	lowered := false
+	for i, l := range h.lowered {
+		if l == p {
+			lowered = true
+			h.lowered = append(h.lowered[:i], h.lowered[i+1:]...)
+			break
+		}
+	}
+	for i, w := range h.written {
+		if w == p {
+			if lowered {
+				h.tree.versions.unpublish(p)
+				h.tree.versions.lowOf(p).Add(1)
+			} else {
+				h.publish(p)
+			}
+			h.tree.versions.of(p).Add(1)
+			h.written = append(h.written[:i], h.written[i+1:]...)
+			return
+		}
+	}
+}
+
+// publish stores a snapshot of the page for optimistic readers, if readers of the tree are optimistic. The page should
+// be latched, or it should not be reachable by other operations yet.
+func (h *heldLatches) publish(p Pointer) {
+	if h == nil || !h.tree.isOptimistic() {
+		return
+	}
+	node := h.tree.pager.GetNode(p)
+	h.tree.versions.publish(h.tree.pager, node)
+	h.tree.pager.Unpin(node, false)
+}
+
+// lockNext latches the node on the right of the node, whose Left link changes when the node is split or merged with
+// the node on its right. It returns the latched page, which is 0 if there is no node on the right.
+func (h *heldLatches) lockNext(node Node) Pointer {
+	if h == nil {
+		return 0
+	}
+	return h.lock(node.GetRight())
+}
+
+// lock starts an operation. Operations that crab latches share opLatch unless pager of the tree is a TxPager, and
+// every other operation holds it exclusively. It returns true if the operation holds it exclusively, in which case the
+// operation can start a transaction. Version of the tree is odd while it runs if readers are optimistic. unlock should
+// be deferred with the returned value.
+func (tree *BTree) lock(crabs bool) (exclusive bool) {
+	if _, isTx := tree.pager.(TxPager); crabs && !isTx {
+		tree.opLatch.RLock()
+		return false
+	}
+
+	tree.opLatch.Lock()
+	if tree.isOptimistic() {
+		tree.versions.tree.Add(1)
+	}
+	return true
+}
+
+func (tree *BTree) unlock(exclusive bool) {
+	if exclusive {
+		if tree.isOptimistic() {
+			tree.versions.rootPage.Store(int64(tree.Root))
+			tree.versions.tree.Add(1)
+		}
+		tree.opLatch.Unlock()
+	} else {
+		tree.opLatch.RUnlock()
+	}
+}
+
+// lockRead starts an operation that only reads the tree. It shares opLatch with the operations that crab latches
+// unless pager of the tree is a TxPager, hence it should crab shared latches as well. Version of the tree is not
+// changed, since optimistic readers do not need to restart for an operation that does not change any page.
+// unlockRead should be deferred with the returned value.
+func (tree *BTree) lockRead() (exclusive bool) {
+	if _, isTx := tree.pager.(TxPager); isTx {
+		tree.opLatch.Lock()
+		return true
+	}
+	tree.opLatch.RLock()
+	return false
+}
+
+func (tree *BTree) unlockRead(exclusive bool) {
+	if exclusive {
+		tree.opLatch.Unlock()
+	} else {
+		tree.opLatch.RUnlock()
+	}
+}
+
+// isSafe returns true if an operation of the mode cannot split, merge or redistribute the node, so that the node and
+// its ancestors are not changed by the operations on its descendants.
+func (tree *BTree) isSafe(node Node, isRoot bool, mode TraverseMode) bool {
+	switch mode {
+	case Insert:
+		return node.IsSafeForSplit(tree.degree)
+	case Delete:
+		// root does not underflow, it is removed when it is left with a single child
+		canShrink := node.IsSafeForMerge(tree.degree)
+		if isRoot {
+			canShrink = node.IsLeaf() || node.Keylen() > 1
+		}
+		// a separator key that is replaced when children are redistributed can be longer in a slotted node
+		canGrow := node.IsLeaf() || !isSlotted(tree.pager.GetKeySerializer(), tree.pager.GetValueSerializer()) ||
+			node.IsSafeForSplit(tree.degree)
+		return canShrink && canGrow
+	}
+	return true
+}
+
+// find goes down to the leaf the key belongs to by crabbing shared latches and returns the value of the key, which is
+// nil if the key does not exist.
+func (tree *BTree) find(key Key) interface{} {
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+
+	stack := tree.crabDown(latches, key, Read, 0)
+	top := stack[len(stack)-1]
+	leaf := tree.pager.GetNode(top.Node)
+	defer tree.pager.Unpin(leaf, false)
+	if _, found := leaf.findKey(key); !found {
+		return nil
+	}
+	return leaf.GetValueAt(top.Index)
+}
+
+// crabDown goes down from the root to the leaf that the key belongs to by crabbing latches, and adds delta to the
+// subtree count of every child it goes to. Latches of the ancestors of a node are released once the node is safe for
+// the mode. It returns the path from the highest node whose latch is still held to the leaf.
+func (tree *BTree) crabDown(latches *heldLatches, key Key, mode TraverseMode, delta int) []NodeIndexPair {
+	latches.lockRoot()
+	p := latches.lock(tree.Root)
+	stack := make([]NodeIndexPair, 0)
+	for isRoot := true; ; isRoot = false {
+		node := tree.pager.GetNode(p)
+		if mode == Read && tree.isOptimistic() && !tree.versions.isPublished(p) {
+			tree.versions.publish(tree.pager, node)
+		}
+		i, found := node.findKey(key)
+		if found && !node.IsLeaf() {
+			i++
+		}
+		if tree.isSafe(node, isRoot, mode) {
+			latches.releaseAncestors()
+			stack = stack[:0]
+		}
+		stack = append(stack, NodeIndexPair{Node: p, Index: i})
+
+		if node.IsLeaf() {
+			tree.pager.Unpin(node, false)
+			return stack
+		}
+		if delta != 0 {
+			node.setCountAt(i, node.getCountAt(i)+delta)
+		}
+		p = node.GetValueAt(i).(Pointer)
+		tree.pager.Unpin(node, delta != 0)
+		latches.lock(p)
+	}
+}
+
+// setRoot changes the root of the tree. Latch of the root pointer should be held exclusively if the operation crabs
+// latches.
+func (tree *BTree) setRoot(p Pointer) {
+	tree.metaMu.Lock()
+	defer tree.metaMu.Unlock()
+	tree.Root = p
+	tree.versions.rootPage.Store(int64(p))
+}
+
+// addLength adds delta to the number of keys and writes the metadata of the tree.
+func (tree *BTree) addLength(delta int) {
+	tree.metaMu.Lock()
+	tree.length += delta
+	tree.metaMu.Unlock()
+	tree.writeMeta()
+}
+
+// recountCounter counts the writers that start to count a path again before they release the latch of the leaf, and
+// the ones that are done, so that a reader can tell whether the counts it reads include a delta that is taken back.
+type recountCounter struct {
+	started atomic.Uint64
+	done    atomic.Uint64
+}
+
+// recountPath takes back the delta that crabDown adds to the subtree counts when the leaf is not changed. It goes down
+// to the leaf that the key belongs to without releasing any latch, and sets the count of every child on the path to
+// the number of keys in the child, from the leaf up. Deltas of the other writers are in the counts of both the child
+// and its parent, since a writer adds its delta to a child before it releases the parent, hence they are kept.
+// recounts.started should be increased before the latch of the leaf is released.
+func (tree *BTree) recountPath(key Key) {
+	latches := tree.newHeldLatches(true)
+	defer latches.release()
+	defer tree.recounts.done.Add(1)
+
+	latches.lockRoot()
+	p := latches.lock(tree.Root)
+	path, indexes := make([]Node, 0), make([]int, 0)
+	for {
+		node := tree.pager.GetNode(p)
+		if node.IsLeaf() {
+			count := node.Keylen()
+			tree.pager.Unpin(node, false)
+			for j := len(path) - 1; j >= 0; j-- {
+				changed := path[j].getCountAt(indexes[j]) != count
+				path[j].setCountAt(indexes[j], count)
+				count = subtreeCount(path[j])
+				tree.pager.Unpin(path[j], changed)
+			}
+			return
+		}
+		i, found := node.findKey(key)
+		if found {
+			i++
+		}
+		path, indexes = append(path, node), append(indexes, i)
+		p = latches.lock(node.GetValueAt(i).(Pointer))
+	}
+}
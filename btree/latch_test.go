@@ -0,0 +1,285 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runConcurrently runs fn in n goroutines and waits for all of them.
+func runConcurrently(n int, fn func(g int, r *rand.Rand)) {
+	var wg sync.WaitGroup
+	for g := 0; g < n; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			fn(g, rand.New(rand.NewSource(int64(g))))
+		}(g)
+	}
+	wg.Wait()
+}
+
+// checkAgainstReference checks that the tree is valid and has exactly the keys and values of the reference map.
+func checkAgainstReference(t *testing.T, tree *BTree, reference map[int]string) {
+	assert.NoError(t, tree.Verify())
+	assert.Equal(t, len(reference), tree.Len())
+	for k, v := range reference {
+		assert.Equal(t, v, tree.Find(PersistentKey(k)), "value of %v", k)
+	}
+
+	it := NewTreeIterator(tree, tree.GetPager())
+	n := 0
+	for val := it.Next(); val != nil; val = it.Next() {
+		n++
+	}
+	assert.Equal(t, len(reference), n)
+}
+
+// runAgainstReference runs random operations on the tree in goroutines, each of which owns the keys k for which
+// k % goroutines == g and reads the keys of the others, and checks the tree against the reference maps of them.
+func runAgainstReference(t *testing.T, tree *BTree, goroutines, ops, keys int, value func(k int, r *rand.Rand) string) {
+	references := make([]map[int]string, goroutines)
+	runConcurrently(goroutines, func(g int, r *rand.Rand) {
+		reference := make(map[int]string)
+		references[g] = reference
+		for i := 0; i < ops; i++ {
+			k := r.Intn(keys/goroutines)*goroutines + g
+			_, exists := reference[k]
+			switch op := r.Intn(10); {
+			case op < 4:
+				v := value(k, r)
+				err := tree.TryInsert(PersistentKey(k), v)
+				if exists {
+					assert.ErrorIs(t, err, ErrKeyExists)
+				} else {
+					assert.NoError(t, err)
+					reference[k] = v
+				}
+			case op < 6:
+				v := value(k, r)
+				assert.Equal(t, !exists, tree.InsertOrReplace(PersistentKey(k), v))
+				reference[k] = v
+			case op < 8:
+				assert.Equal(t, exists, tree.Delete(PersistentKey(k)))
+				delete(reference, k)
+			default:
+				if exists {
+					assert.Equal(t, reference[k], tree.Find(PersistentKey(k)))
+				} else {
+					assert.Nil(t, tree.Find(PersistentKey(k)))
+				}
+				tree.Find(PersistentKey(r.Intn(keys)))
+			}
+		}
+	})
+
+	reference := make(map[int]string)
+	for _, ref := range references {
+		for k, v := range ref {
+			reference[k] = v
+		}
+	}
+	checkAgainstReference(t, tree, reference)
+}
+
+// referenceTrees creates the trees that are stressed by runAgainstReference and the values that are inserted to them.
+var referenceTrees = map[string]struct {
+	newTree func() *BTree
+	value   func(k int, r *rand.Rand) string
+}{
+	"persistent": {
+		newTree: func() *BTree {
+			return NewBtreeWithPager(5, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+		},
+		value: func(k int, r *rand.Rand) string { return fmt.Sprintf("value_%04d", r.Intn(10000)) },
+	},
+	"slotted": {
+		newTree: func() *BTree {
+			return NewBtreeWithPager(50, NewInMemoryPager(&PersistentKeySerializer{}, &VarStringValueSerializer{}))
+		},
+		value: func(k int, r *rand.Rand) string { return strings.Repeat("v", r.Intn(100)) + fmt.Sprint(k) },
+	},
+}
+
+func TestLatch_Concurrent_Operations_Should_Match_Reference_Map(t *testing.T) {
+	goroutines, ops, keys := 8, 4000, 2000
+	if testing.Short() {
+		ops, keys = 500, 300
+	}
+
+	for name, trees := range referenceTrees {
+		t.Run(name, func(t *testing.T) {
+			runAgainstReference(t, trees.newTree(), goroutines, ops, keys, trees.value)
+		})
+	}
+}
+
+func TestLatch_Operations_On_Same_Keys_Should_Keep_Subtree_Counts_Consistent(t *testing.T) {
+	goroutines, ops, keys := 8, 3000, 50
+	if testing.Short() {
+		ops = 500
+	}
+
+	tree := NewBtreeWithPager(3, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	runConcurrently(goroutines, func(g int, r *rand.Rand) {
+		for i := 0; i < ops; i++ {
+			k := PersistentKey(r.Intn(keys))
+			switch r.Intn(3) {
+			case 0:
+				err := tree.TryInsert(k, "value")
+				if err != nil {
+					assert.ErrorIs(t, err, ErrKeyExists)
+				}
+			case 1:
+				tree.InsertOrReplace(k, fmt.Sprintf("value_%v", g))
+			default:
+				tree.Delete(k)
+			}
+		}
+	})
+
+	// deltas of the operations which do not change a leaf are taken back
+	assert.NoError(t, tree.Verify())
+	existing := make([]int, 0)
+	for k := 0; k < keys; k++ {
+		if tree.Find(PersistentKey(k)) != nil {
+			existing = append(existing, k)
+		}
+	}
+	assert.Equal(t, len(existing), tree.Len())
+	for i, k := range existing {
+		assert.Equal(t, i, tree.Rank(PersistentKey(k)))
+		key, _ := tree.Select(i)
+		assert.Equal(t, PersistentKey(k), key)
+	}
+}
+
+func TestLatch_Writes_Should_Go_Down_Once_Unless_They_Do_Not_Change_The_Leaf(t *testing.T) {
+	pager := &countingPager{Pager: NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}), reads: make(map[Pointer]int)}
+	tree := NewBtreeWithPager(3, pager)
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	rootReads := func(op func()) int {
+		root := tree.Root
+		before := pager.reads[root]
+		op()
+		return pager.reads[root] - before
+	}
+	assert.Equal(t, 1, rootReads(func() { tree.Insert(PersistentKey(51), "value") }))
+	assert.Equal(t, 1, rootReads(func() { assert.True(t, tree.InsertOrReplace(PersistentKey(53), "value")) }))
+	assert.Equal(t, 1, rootReads(func() { assert.True(t, tree.Delete(PersistentKey(51))) }))
+
+	// counts of the path are taken back by going down again
+	assert.Equal(t, 2, rootReads(func() { assert.ErrorIs(t, tree.TryInsert(PersistentKey(40), "value"), ErrKeyExists) }))
+	assert.Equal(t, 2, rootReads(func() { assert.False(t, tree.InsertOrReplace(PersistentKey(42), "new")) }))
+	assert.Equal(t, 2, rootReads(func() { assert.False(t, tree.Delete(PersistentKey(21))) }))
+
+	assert.NoError(t, tree.Verify())
+	assert.Equal(t, 51, tree.Len())
+	assert.Equal(t, 22, tree.Rank(PersistentKey(44)))
+}
+
+func TestLatch_Read_Only_Operations_Should_Run_Together_With_Writers(t *testing.T) {
+	ops, keys := 2000, 400
+	if testing.Short() {
+		ops = 300
+	}
+
+	// even keys are never changed, writers insert and delete odd keys
+	tree := NewBtreeWithPager(3, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	for k := 0; k < keys; k += 2 {
+		tree.Insert(PersistentKey(k), "value")
+	}
+	runConcurrently(8, func(g int, r *rand.Rand) {
+		for i := 0; i < ops; i++ {
+			k := PersistentKey(r.Intn(keys/2)*2 + 1)
+			if g < 4 {
+				if r.Intn(2) == 0 {
+					tree.InsertOrReplace(k, "value")
+				} else {
+					tree.Delete(k)
+				}
+				continue
+			}
+
+			even := k - 1
+			switch r.Intn(6) {
+			case 0:
+				// rank could be off by the deltas of the writers
+				rank, err := tree.TryRank(even)
+				assert.NoError(t, err)
+				assert.GreaterOrEqual(t, rank, int(even)/2-4)
+				assert.LessOrEqual(t, rank, int(even)+4)
+			case 1:
+				key, _ := tree.Floor(even)
+				assert.Equal(t, even, key)
+				if key, _ = tree.Lower(even); even > 0 {
+					assert.Contains(t, []Key{even - 1, even - 2}, key)
+				}
+			case 2:
+				key, _ := tree.Higher(even)
+				assert.Contains(t, []Key{even + 1, even + 2, nil}, key)
+				min, _ := tree.Min()
+				assert.Equal(t, PersistentKey(0), min)
+			case 3:
+				key, _ := tree.Ceiling(even)
+				assert.Equal(t, even, key)
+				max, _ := tree.Max()
+				assert.Contains(t, []Key{PersistentKey(keys - 2), PersistentKey(keys - 1)}, max)
+			case 4:
+				_, _, err := tree.TrySelect(r.Intn(keys / 2))
+				assert.NoError(t, err)
+				assert.GreaterOrEqual(t, tree.Height(), 1)
+			default:
+				if r.Intn(20) == 0 {
+					assert.NoError(t, tree.Verify())
+				}
+			}
+		}
+	})
+	assert.NoError(t, tree.Verify())
+}
+
+func TestLatch_Operations_On_File_Pager_Should_Run_One_At_A_Time(t *testing.T) {
+	goroutines, ops := 4, 500
+	if testing.Short() {
+		ops = 100
+	}
+
+	pager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree := NewBtreeWithPager(5, pager)
+
+	references := make([]map[int]string, goroutines)
+	runConcurrently(goroutines, func(g int, r *rand.Rand) {
+		reference := make(map[int]string)
+		references[g] = reference
+		for i := 0; i < ops; i++ {
+			k := r.Intn(ops)*goroutines + g
+			if r.Intn(3) == 0 {
+				tree.Delete(PersistentKey(k))
+				delete(reference, k)
+			} else {
+				v := fmt.Sprintf("value_%04d", i)
+				tree.InsertOrReplace(PersistentKey(k), v)
+				reference[k] = v
+			}
+		}
+	})
+
+	reference := make(map[int]string)
+	for _, ref := range references {
+		for k, v := range ref {
+			reference[k] = v
+		}
+	}
+	checkAgainstReference(t, tree, reference)
+}
@@ -0,0 +1,96 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// MetaPageId is the page_id of the page which stores metadata of a tree. Pagers reserve it so that a tree can be
+	// found again when it is reopened on top of the same pager.
+	MetaPageId Pointer = 1
+
+	metaMagic        uint32 = 0x42545245 // "BTRE"
+	metaVersion      uint16 = 3
+	serializerIdSize        = 32
+)
+
+var (
+	ErrTreeNotFound     = errors.New("pager does not contain a b+ tree")
+	ErrIncompatibleTree = errors.New("b+ tree is not compatible with the pager")
+)
+
+// treeMeta is the content of the metadata page. It is written whenever the root or number of keys in the tree changes.
+type treeMeta struct {
+	Checksum        uint32
+	Magic           uint32
+	Version         uint16
+	PageSize        uint32
+	Root            Pointer
+	Degree          int32
+	Length          int64
+	KeySerializer   [serializerIdSize]byte
+	ValueSerializer [serializerIdSize]byte
+}
+
+// serializerId identifies a serializer by its type and size, which are enough to tell whether the pages written with a
+// serializer could be read by another. Serializers of a Tree are identified by their codecs.
+func serializerId(s interface{ Size() int }) [serializerIdSize]byte {
+	var res [serializerIdSize]byte
+	if c, ok := s.(interface{ id() string }); ok {
+		copy(res[:], c.id())
+		return res
+	}
+	copy(res[:], fmt.Sprintf("%T/%v", s, s.Size()))
+	return res
+}
+
+func newTreeMeta(tree *BTree, pageSize int) *treeMeta {
+	return &treeMeta{
+		Magic:           metaMagic,
+		Version:         metaVersion,
+		PageSize:        uint32(pageSize),
+		Root:            tree.Root,
+		Degree:          int32(tree.degree),
+		Length:          int64(tree.length),
+		KeySerializer:   serializerId(tree.pager.GetKeySerializer()),
+		ValueSerializer: serializerId(tree.pager.GetValueSerializer()),
+	}
+}
+
+func readTreeMeta(data []byte) *treeMeta {
+	reader := bytes.NewReader(data)
+	dest := treeMeta{}
+	err := binary.Read(reader, binary.BigEndian, &dest)
+	CheckErr(err)
+	return &dest
+}
+
+func writeTreeMeta(meta *treeMeta, dest []byte) {
+	buf := bytes.Buffer{}
+	err := binary.Write(&buf, binary.BigEndian, meta)
+	CheckErr(err)
+	copy(dest, buf.Bytes())
+}
+
+// validate checks if a tree described by the meta could be opened by the given pager.
+func (m *treeMeta) validate(pager Pager, pageSize int) error {
+	if m.Magic != metaMagic {
+		return ErrTreeNotFound
+	}
+	if m.Version != metaVersion {
+		return fmt.Errorf("%w: format version is %v, expected %v", ErrIncompatibleTree, m.Version, metaVersion)
+	}
+	if int(m.PageSize) != pageSize {
+		return fmt.Errorf("%w: page size is %v, pager uses %v", ErrIncompatibleTree, m.PageSize, pageSize)
+	}
+	if m.KeySerializer != serializerId(pager.GetKeySerializer()) {
+		return fmt.Errorf("%w: key serializer does not match", ErrIncompatibleTree)
+	}
+	if m.ValueSerializer != serializerId(pager.GetValueSerializer()) {
+		return fmt.Errorf("%w: value serializer does not match", ErrIncompatibleTree)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package btree
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenBtree_Should_Restore_Root_Degree_And_Length(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+
+	tree := NewBtreeWithPager(5, pager)
+	for i := 0; i < 500; i++ {
+		tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+	}
+	tree.InsertOrReplace(PersistentKey(500), "value_500")
+	tree.InsertOrReplace(PersistentKey(10), "new_10")
+	for i := 0; i < 100; i++ {
+		tree.Delete(PersistentKey(i * 2))
+	}
+	root := tree.Root
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	opened, err := OpenBtree(pager)
+	assert.NoError(t, err)
+	assert.Equal(t, root, opened.Root)
+	assert.Equal(t, 5, opened.degree)
+	assert.Equal(t, 401, opened.length)
+	assert.Contains(t, opened.Find(PersistentKey(1)), "value_1")
+	assert.Nil(t, opened.Find(PersistentKey(2)))
+}
+
+func TestOpenBtree_Should_Return_Error_When_Pager_Has_No_Tree(t *testing.T) {
+	pager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	_, err = OpenBtree(pager)
+	assert.ErrorIs(t, err, ErrTreeNotFound)
+}
+
+func TestOpenBtree_Should_Return_Error_When_Serializers_Are_Different(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	NewBtreeWithPager(5, pager)
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 20})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	_, err = OpenBtree(pager)
+	assert.ErrorIs(t, err, ErrIncompatibleTree)
+}
@@ -0,0 +1,204 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+  Navigation:
+
+  Min, Max, Floor, Ceiling, Lower and Higher go down from the root once to the leaf the key belongs to and pick an
+  index around the insertion index of the key in that leaf. If the index is after the last key of the leaf, the
+  answer is the first key of the leaf on the right, which is followed through the Right link instead of going down
+  from the root again. If it is before the first key, the answer is the largest key that is less than the separator
+  key on the left of the leaf, and it is found by going down from the root again with that separator, since latches
+  of a level are taken from left to right(see latch.go).
+*/
+
+// Min is the same as TryMin, but it returns nil key and value if the tree is empty and panics if any other error
+// occurs.
+func (tree *BTree) Min() (Key, interface{}) {
+	return nilIfNotFound(tree.TryMin())
+}
+
+// TryMin returns the smallest key in the tree and its value. It returns ErrKeyNotFound if the tree is empty.
+func (tree *BTree) TryMin() (key Key, value interface{}, err error) {
+	defer recoverErr(&err)
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	stack := tree.descend(latches, func(node Node) int { return 0 })
+	return tree.entryAt(latches, stack[len(stack)-1].Node, nil, func(leaf Node) int { return 0 }, "tree is empty")
+}
+
+// Max is the same as TryMax, but it returns nil key and value if the tree is empty and panics if any other error
+// occurs.
+func (tree *BTree) Max() (Key, interface{}) {
+	return nilIfNotFound(tree.TryMax())
+}
+
+// TryMax returns the largest key in the tree and its value. It returns ErrKeyNotFound if the tree is empty.
+func (tree *BTree) TryMax() (key Key, value interface{}, err error) {
+	defer recoverErr(&err)
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	var low Key
+	stack := tree.descend(latches, lowOf(&low, func(node Node) int { return node.Keylen() }))
+	return tree.entryAt(latches, stack[len(stack)-1].Node, low, func(leaf Node) int { return leaf.Keylen() - 1 }, "tree is empty")
+}
+
+// Floor is the same as TryFloor, but it returns nil key and value if there is no such key and panics if any other
+// error occurs.
+func (tree *BTree) Floor(key Key) (Key, interface{}) {
+	return nilIfNotFound(tree.TryFloor(key))
+}
+
+// TryFloor returns the largest key in the tree which is less than or equal to the given key and its value. It returns
+// ErrKeyNotFound if there is no such key.
+func (tree *BTree) TryFloor(key Key) (Key, interface{}, error) {
+	return tree.navigate(key, func(i int, found bool) int {
+		if found {
+			return i
+		}
+		return i - 1
+	}, "no key is less than or equal to")
+}
+
+// Ceiling is the same as TryCeiling, but it returns nil key and value if there is no such key and panics if any other
+// error occurs.
+func (tree *BTree) Ceiling(key Key) (Key, interface{}) {
+	return nilIfNotFound(tree.TryCeiling(key))
+}
+
+// TryCeiling returns the smallest key in the tree which is greater than or equal to the given key and its value. It
+// returns ErrKeyNotFound if there is no such key.
+func (tree *BTree) TryCeiling(key Key) (Key, interface{}, error) {
+	return tree.navigate(key, func(i int, found bool) int {
+		return i
+	}, "no key is greater than or equal to")
+}
+
+// Lower is the same as TryLower, but it returns nil key and value if there is no such key and panics if any other
+// error occurs.
+func (tree *BTree) Lower(key Key) (Key, interface{}) {
+	return nilIfNotFound(tree.TryLower(key))
+}
+
+// TryLower returns the largest key in the tree which is strictly less than the given key and its value. It returns
+// ErrKeyNotFound if there is no such key.
+func (tree *BTree) TryLower(key Key) (Key, interface{}, error) {
+	return tree.navigate(key, func(i int, found bool) int {
+		return i - 1
+	}, "no key is less than")
+}
+
+// Higher is the same as TryHigher, but it returns nil key and value if there is no such key and panics if any other
+// error occurs.
+func (tree *BTree) Higher(key Key) (Key, interface{}) {
+	return nilIfNotFound(tree.TryHigher(key))
+}
+
+// TryHigher returns the smallest key in the tree which is strictly greater than the given key and its value. It
+// returns ErrKeyNotFound if there is no such key.
+func (tree *BTree) TryHigher(key Key) (Key, interface{}, error) {
+	return tree.navigate(key, func(i int, found bool) int {
+		if found {
+			return i + 1
+		}
+		return i
+	}, "no key is greater than")
+}
+
+// navigate goes down to the leaf the key belongs to and returns the entry at the index that pick chooses from the
+// result of findKey in the leaf.
+func (tree *BTree) navigate(key Key, pick func(i int, found bool) int, notFound string) (k Key, value interface{}, err error) {
+	defer recoverErr(&err)
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	var low Key
+	stack := tree.descend(latches, lowOf(&low, func(node Node) int {
+		i, found := node.findKey(key)
+		if found {
+			i++
+		}
+		return i
+	}))
+	return tree.entryAt(latches, stack[len(stack)-1].Node, low, func(leaf Node) int {
+		return pick(leaf.findKey(key))
+	}, fmt.Sprintf("%v %v", notFound, key))
+}
+
+// lowOf sets low to the separator key on the left of the child that childIndex chooses, as long as the child is not
+// the first one, so that low is the smallest key the leaf at the end of the path can have when descend returns. It is
+// nil if the leaf is the first one of its level.
+func lowOf(low *Key, childIndex func(node Node) int) func(node Node) int {
+	return func(node Node) int {
+		i := childIndex(node)
+		if i > 0 {
+			*low = node.GetKeyAt(i - 1)
+		}
+		return i
+	}
+}
+
+// entryAt returns the key and the value at the index that is chosen by index in the leaf p, whose latch is held by
+// latches and whose smallest possible key is low. If the index is after the last key of the leaf, the first key of the
+// leaves on the right is returned, and if it is before the first key, the largest key that is less than low is
+// returned(see lastBefore). ErrKeyNotFound is returned with the notFound message if there is no leaf in that
+// direction.
+func (tree *BTree) entryAt(latches *heldLatches, p Pointer, low Key, index func(leaf Node) int, notFound string) (Key, interface{}, error) {
+	node := tree.pager.GetNode(p)
+	i := index(node)
+	for i >= 0 && i >= node.Keylen() {
+		next := node.GetRight()
+		tree.pager.Unpin(node, false)
+		if next == 0 {
+			return nil, nil, fmt.Errorf("%w: %v", ErrKeyNotFound, notFound)
+		}
+		latches.lock(next)
+		latches.releaseAncestors()
+		node, i = tree.pager.GetNode(next), 0
+	}
+	if i < 0 {
+		tree.pager.Unpin(node, false)
+		node, i = tree.lastBefore(latches, low)
+		if node == nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrKeyNotFound, notFound)
+		}
+	}
+	defer tree.pager.Unpin(node, false)
+	return node.GetKeyAt(i), node.GetValueAt(i), nil
+}
+
+// lastBefore returns the leaf which has the largest key that is less than low, and the index of the key. The leaf is
+// pinned and its latch is held by latches, which should hold only the latches of a leaf on the right of it, since
+// they are released before it goes down from the root. It returns nil if there is no such key.
+func (tree *BTree) lastBefore(latches *heldLatches, low Key) (Node, int) {
+	for low != nil {
+		latches.release()
+		bound := low
+		low = nil
+		stack := tree.descend(latches, lowOf(&low, func(node Node) int {
+			i, _ := node.findKey(bound)
+			return i
+		}))
+		leaf := tree.pager.GetNode(stack[len(stack)-1].Node)
+		if i, _ := leaf.findKey(bound); i > 0 {
+			return leaf, i - 1
+		}
+		tree.pager.Unpin(leaf, false)
+	}
+	return nil, 0
+}
+
+// nilIfNotFound returns nil key and value if err is ErrKeyNotFound, and panics if it is another error.
+func nilIfNotFound(key Key, value interface{}, err error) (Key, interface{}) {
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	CheckErr(err)
+	return key, value
+}
@@ -0,0 +1,119 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkLeafLinks checks that every leaf links to the leaves on its left and right.
+func checkLeafLinks(t *testing.T, tree *BTree) {
+	stack := tree.descend(nil, func(node Node) int { return 0 })
+	var prev Pointer
+	for p := stack[len(stack)-1].Node; p != 0; {
+		node := tree.pager.GetNode(p)
+		h := node.GetHeader()
+		tree.pager.Unpin(node, false)
+		assert.Equal(t, prev, h.Left, "left link of leaf %v is wrong", p)
+		prev, p = p, h.Right
+	}
+}
+
+func TestNavigate_Should_Find_Neighbouring_Keys(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		degree int
+		pager  Pager
+	}{
+		{"degree_3", 3, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})},
+		{"degree_5", 5, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})},
+		{"slotted", 50, NewInMemoryPager(&PersistentKeySerializer{}, &VarStringValueSerializer{})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := 1000
+			tree := NewBtreeWithPager(tc.degree, tc.pager)
+
+			// only even keys are inserted so that odd keys are between them, and some of them are deleted so that
+			// leaves are merged
+			for _, i := range rand.Perm(n) {
+				tree.Insert(PersistentKey(i*2), fmt.Sprintf("value_%v", i*2))
+			}
+			exists := make(map[int]bool)
+			for i := 0; i < n; i++ {
+				exists[i*2] = true
+			}
+			for _, i := range rand.Perm(n)[:n*3/4] {
+				tree.Delete(PersistentKey(i * 2))
+				delete(exists, i*2)
+			}
+			checkLeafLinks(t, tree)
+
+			keys := make([]int, 0, len(exists))
+			for k := range exists {
+				keys = append(keys, k)
+			}
+			sort.Ints(keys)
+
+			check := func(name string, idx int, key Key, value interface{}) {
+				if idx < 0 || idx >= len(keys) {
+					assert.Nil(t, key, name)
+					assert.Nil(t, value, name)
+					return
+				}
+				assert.Equal(t, PersistentKey(keys[idx]), key, name)
+				assert.Contains(t, value, fmt.Sprintf("value_%v", keys[idx]), name)
+			}
+			key, value := tree.Min()
+			check("min", 0, key, value)
+			key, value = tree.Max()
+			check("max", len(keys)-1, key, value)
+
+			for i := -1; i <= 2*n; i++ {
+				ceiling := sort.SearchInts(keys, i)
+				higher := sort.SearchInts(keys, i+1)
+
+				key, value = tree.Ceiling(PersistentKey(i))
+				check(fmt.Sprintf("ceiling of %v", i), ceiling, key, value)
+				key, value = tree.Higher(PersistentKey(i))
+				check(fmt.Sprintf("higher of %v", i), higher, key, value)
+				key, value = tree.Lower(PersistentKey(i))
+				check(fmt.Sprintf("lower of %v", i), ceiling-1, key, value)
+				key, value = tree.Floor(PersistentKey(i))
+				check(fmt.Sprintf("floor of %v", i), higher-1, key, value)
+			}
+		})
+	}
+}
+
+func TestNavigate_Should_Return_Error_When_There_Is_No_Such_Key(t *testing.T) {
+	tree := NewBtreeWithPager(3, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	_, _, err := tree.TryMin()
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, _, err = tree.TryMax()
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	key, value := tree.Floor(PersistentKey(1))
+	assert.Nil(t, key)
+	assert.Nil(t, value)
+
+	for i := 10; i < 20; i++ {
+		tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+	}
+	_, _, err = tree.TryLower(PersistentKey(10))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, _, err = tree.TryFloor(PersistentKey(9))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, _, err = tree.TryHigher(PersistentKey(19))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, _, err = tree.TryCeiling(PersistentKey(20))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	key, _, err = tree.TryFloor(PersistentKey(100))
+	assert.NoError(t, err)
+	assert.Equal(t, PersistentKey(19), key)
+	key, _, err = tree.TryCeiling(PersistentKey(-100))
+	assert.NoError(t, err)
+	assert.Equal(t, PersistentKey(10), key)
+}
@@ -27,6 +27,10 @@ import (
 
   pairs are Key_0-Val_1, Key_1-Val_2 notice that the value indexes are one more than key indexes for internal
   nodes because of the extra value at the beginning.
+
+  Values of an internal node are pointers of its children. Each pointer is stored with the number of keys in the
+  subtree of the child, so that the position of a key among all keys can be found by going down from the root(see
+  Rank and Select).
 */
 
 /*
@@ -96,6 +100,26 @@ import (
  but would violate b+ tree since when you go right you should always find equal or bigger keys.
 */
 
+/*
+  Links and high keys:
+
+  Every node is linked to the nodes on its left and right on the same level with the Left and Right pointers in its
+  header, like a B-link tree of Lehman and Yao. A node which has a node on its right keeps a high key as well, which is
+  the separator key between them in their lowest common ancestor. Keys in the subtree of a node are less than its high
+  key, so a reader that reaches a node after the node is split can see that the key it looks for is moved to the right
+  and follow the Right link instead of going down from the root again.
+
+  ..................| Pointer_1 | Key_3 | Pointer_2 |............................
+                       /                   \
+                      /                     \
+   | Key_1 | Val_1 | (Key_3) | --> | Key_3 | Val_3 | Key_4 | Val_4 | (high key of the parent) | --> ...
+
+  When a node is split, the new node takes the Right link and the high key of the node, and the separator key of them
+  becomes the high key of the node. When two nodes are merged, the node on the left takes them from the node on the
+  right, and when they are redistributed the new separator key becomes the high key of the node on the left. Since
+  Left link of the node on the right changes in these, it is modified as well.
+*/
+
 type Pointer int64
 
 type Key interface {
@@ -147,12 +171,22 @@ type Node interface {
 	GetValueAt(idx int) interface{}
 	GetValues() []interface{}
 
+	// getCountAt returns the number of keys in the subtree of the child at the given index of an internal node.
+	getCountAt(idx int) int
+
+	// setCountAt sets the number of keys in the subtree of the child at the given index of an internal node. InsertAt
+	// sets it to 0 for the inserted child, the caller should set it afterwards.
+	setCountAt(idx int, count int)
+
 	// SplitNode splits the node it is called into two nodes at the given index. Split is done so that the key at the given
 	// index is moved to newly created node along with every key and value after itself. All keys and values that
 	// comes before that key stays in the current node and current node is truncated after split.
 	// right is a pointer for the newly created node, keyAtLeft is the last key of the current node and keyAtRight is
 	// the first key in newly created node
 	SplitNode(index int) (right Pointer, keyAtLeft Key, keyAtRight Key)
+
+	// splitIndex returns the index an overflowed node should be split at.
+	splitIndex(degree int) int
 	PrintNode()
 	IsOverFlow(degree int) bool
 
@@ -181,9 +215,17 @@ type Node interface {
 	// Keylen returns number of keys in the node
 	Keylen() int
 
-	// GetRight is meant only for leaf nodes which has a right pointer
+	// GetRight returns the node on the right of the node on the same level, which is 0 for the last node of a level
 	GetRight() Pointer
 
+	// GetHighKey returns the high key of the node, which is the smallest key the node on its right can have, hence
+	// every key in the subtree of the node is less than it. It is nil for the last node of a level.
+	GetHighKey() Key
+
+	// setHighKey sets the high key of the node, nil removes it. High key of a node is kept only while it has a node
+	// on its right, hence Right link should be set before it.
+	setHighKey(key Key)
+
 	// MergeNodes merges the node it is called on with its parameter rightNode. Merging two leaf nodes is trivial.
 	// Directly appending key-value pairs of rightNode to leftNode is enough. And the pointer which points to the rightNode
 	// in the parent should be deleted from parent with its value.
@@ -195,5 +237,77 @@ type Node interface {
 	// keys and values between children and updates the key separating them in the parent.
 	Redistribute(rightNode_ Node, parent_ Node)
 
+	// CanLend returns true if the node has enough keys to give some of them to an underflowed sibling by
+	// Redistribute. Otherwise, the sibling should be merged with it.
+	CanLend(degree int) bool
+
+	// canMerge returns true if the keys of rightNode fit in the node along with the key separating them in their
+	// parent, so that the node does not overflow after they are merged.
+	canMerge(rightNode Node, degree int) bool
+
 	IsUnderFlow(degree int) bool
 }
+
+// setLeftLink sets the left link of the node p to left, it is called when the node on the left of p changes. p can be
+// 0 if there is no node on the right.
+func setLeftLink(pager Pager, p Pointer, left Pointer) {
+	if p == 0 {
+		return
+	}
+	node := pager.GetNode(p)
+	h := node.GetHeader()
+	h.Left = left
+	node.SetHeader(h)
+	pager.Unpin(node, true)
+}
+
+// linkSplit links the node that is split to the new node on its right. The new node takes the Right link and the high
+// key of the node, and the key which separates them becomes the high key of the node.
+func linkSplit(pager Pager, left Node, right Node, separator Key) {
+	highKey := left.GetHighKey()
+	leftHeader, rightHeader := left.GetHeader(), right.GetHeader()
+	rightHeader.Right = leftHeader.Right
+	rightHeader.Left = left.GetPageId()
+	leftHeader.Right = right.GetPageId()
+	right.SetHeader(rightHeader)
+	left.SetHeader(leftHeader)
+	right.setHighKey(highKey)
+	left.setHighKey(separator)
+	setLeftLink(pager, rightHeader.Right, right.GetPageId())
+}
+
+// linkMerge links the node on the left of two merged nodes to the node on the right of them, and moves the high key
+// of the right node to it.
+func linkMerge(pager Pager, left Node, right Node) {
+	highKey := right.GetHighKey()
+	h := left.GetHeader()
+	h.Right = right.GetRight()
+	left.SetHeader(h)
+	left.setHighKey(highKey)
+	setLeftLink(pager, h.Right, left.GetPageId())
+}
+
+// subtreeCount returns the number of keys in the subtree of the node.
+func subtreeCount(node Node) int {
+	if node.IsLeaf() {
+		return node.Keylen()
+	}
+	count := 0
+	for i := 0; i < node.Keylen()+1; i++ {
+		count += node.getCountAt(i)
+	}
+	return count
+}
+
+// mergeCounts adds the count of the child at index i+1 of the parent to the child at index i, it is called by
+// MergeNodes before the right child is deleted from the parent.
+func mergeCounts(parent Node, i int) {
+	parent.setCountAt(i, parent.getCountAt(i)+parent.getCountAt(i+1))
+}
+
+// redistributeCounts sets the counts of left and right, which are the children of the parent at index i and i+1, after
+// they are redistributed.
+func redistributeCounts(left, right, parent Node, i int) {
+	parent.setCountAt(i, subtreeCount(left))
+	parent.setCountAt(i+1, subtreeCount(right))
+}
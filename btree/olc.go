@@ -0,0 +1,326 @@
+package btree
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+  Optimistic lock coupling:
+
+  In the optimistic latch mode, Find does not take any latch. Every node has a version which is odd while a writer
+  changes its keys or children, and which is increased again when the writer releases the latch of the node. A reader
+  reads the version of a node before the node, and checks that the version is still the same after it reads the result
+  of findKey and the child it goes to, or the value in a leaf. Since the latch of a parent that is changed is released
+  after the latches of its children, a reader that goes down from a parent which is not changed reaches the right
+  child.
+
+  If a version is changed in the meantime, the reader reads the node again instead of restarting from the root. Keys
+  of a node can only be moved to the node on its right when it is split, and the reader follows the Right link of the
+  node if the key is not less than its high key(see nodes.go). Every node has a low version as well, which is
+  increased when the node loses its smallest keys to the node on its left or when it is freed, then the reader
+  restarts from the root since the key may not be reachable from the node anymore.
+
+  Writers still crab latches with each other as in the pessimistic mode(see latch.go), but they take the versions of
+  only the nodes whose keys or children they change, so readers are not blocked by the writers that go down the tree.
+  Subtree counts are changed without taking the versions since Find does not read them. Root pointer of the tree has a
+  version as well, and operations that run alone make the version of the whole tree odd while they run.
+
+  Readers never read the pages that writers change in place. A writer publishes a copy of every page it changes before
+  it increases the version of the page again, and readers read these snapshots, so a snapshot is never changed while
+  it is read and the reader only needs to check that it read the snapshot of the version it validates. New nodes are
+  published when they are split off, and a page loses its snapshot when its low version is increased or when it is
+  freed, since it could be reused by a node that is not published. Pages that are not published yet, for example the
+  pages of a tree that is bulk loaded, are published by the readers that crab latches, and a reader that reaches such
+  a page crabs latches instead. Operations that run alone do not publish the pages they change, so every snapshot
+  keeps the generation it is published in, and an operation that runs alone starts a new generation in which the
+  snapshots of the older ones are stale(see unpublishPages).
+
+  A reader ignores the panics caused by a node which turns out to be changed, and it falls back to crabbing latches
+  after it restarts or reads a node again maxOptimisticRestarts times, so that it does not starve. Pager of the tree
+  should be safe for concurrent use; Find of a tree whose pager is a TxPager never runs optimistically since its
+  operations run alone.
+*/
+
+// LatchMode is the way Find synchronizes with the operations that modify the tree.
+type LatchMode int
+
+const (
+	// Pessimistic readers crab shared latches from the root to a leaf. It is the default mode.
+	Pessimistic LatchMode = iota
+
+	// Optimistic readers do not take latches, they check versions of the nodes and restart if a node is changed
+	// while they read it. It suits the trees that are read much more often than they are modified.
+	Optimistic
+)
+
+// maxOptimisticRestarts is the number of times an optimistic reader restarts or reads a node again before it crabs
+// latches instead.
+const maxOptimisticRestarts = 16
+
+// SetLatchMode sets the way Find synchronizes with the operations that modify the tree. It should not be called while
+// the tree is used by other goroutines.
+func (tree *BTree) SetLatchMode(mode LatchMode) {
+	tree.latchMode = mode
+	// pages could be changed without being published while readers were not optimistic
+	tree.versions.unpublishAll()
+	tree.versions.rootPage.Store(int64(tree.Root))
+}
+
+// isOptimistic returns true if readers of the tree do not take latches.
+func (tree *BTree) isOptimistic() bool {
+	_, isTx := tree.pager.(TxPager)
+	return tree.latchMode == Optimistic && !isTx
+}
+
+// unpublishPages makes the snapshots of every page stale before an operation that runs alone changes the pages, since
+// it does not publish the pages it changes. Stale snapshots are removed when they are reached(see snapshotOf), so that
+// the operation does not go through every snapshot.
+func (tree *BTree) unpublishPages() {
+	if tree.isOptimistic() {
+		tree.versions.generation.Add(1)
+	}
+}
+
+// freeNode frees the page of a node and removes its snapshot, since the page could be reused by a node that is not
+// published.
+func (tree *BTree) freeNode(p Pointer) {
+	tree.versions.unpublish(p)
+	tree.pager.FreeNode(p)
+}
+
+// versionTable keeps the versions of the nodes, the root pointer and the whole tree, the low versions of the nodes and
+// the snapshots of the pages that optimistic readers read, which are stale unless they are published in generation.
+// Versions of the pages are never removed, so that a reader that reaches a freed page sees that it is changed.
+// rootPage is the root pointer of the tree for optimistic readers.
+type versionTable struct {
+	tree       atomic.Uint64
+	root       atomic.Uint64
+	rootPage   atomic.Int64
+	generation atomic.Uint64
+	pages      sync.Map // Pointer -> *atomic.Uint64
+	lows       sync.Map // Pointer -> *atomic.Uint64
+	snapshots  sync.Map // Pointer -> *snapshot
+}
+
+// snapshot is a copy of a page that is published in the generation.
+type snapshot struct {
+	node       Node
+	generation uint64
+}
+
+func (t *versionTable) of(p Pointer) *atomic.Uint64 {
+	return counterOf(&t.pages, p)
+}
+
+func (t *versionTable) lowOf(p Pointer) *atomic.Uint64 {
+	return counterOf(&t.lows, p)
+}
+
+func counterOf(m *sync.Map, p Pointer) *atomic.Uint64 {
+	if v, ok := m.Load(p); ok {
+		return v.(*atomic.Uint64)
+	}
+	v, _ := m.LoadOrStore(p, new(atomic.Uint64))
+	return v.(*atomic.Uint64)
+}
+
+// publish stores a node on a copy of the page of the node as the snapshot of the page. Node should not be changed by
+// other operations while it is published, and generation should not be changed either, which holds while opLatch is
+// held.
+func (t *versionTable) publish(pager Pager, node Node) {
+	page := node.(PersistentPage)
+	copied := &NoopPersistentPage{pageId: page.GetPageId(), data: append([]byte(nil), page.GetData()...)}
+	t.snapshots.Store(copied.pageId, &snapshot{node: wrapNode(pager, copied), generation: t.generation.Load()})
+}
+
+func (t *versionTable) isPublished(p Pointer) bool {
+	_, ok := t.snapshotOf(p)
+	return ok
+}
+
+func (t *versionTable) unpublish(p Pointer) {
+	t.snapshots.Delete(p)
+}
+
+func (t *versionTable) unpublishAll() {
+	t.snapshots.Range(func(p, _ interface{}) bool {
+		t.snapshots.Delete(p)
+		return true
+	})
+}
+
+// snapshotOf returns the snapshot of the page p, or false if the page is not published or its snapshot is stale, in
+// which case the snapshot is removed.
+func (t *versionTable) snapshotOf(p Pointer) (Node, bool) {
+	v, ok := t.snapshots.Load(p)
+	if !ok {
+		return nil, false
+	}
+	s := v.(*snapshot)
+	if s.generation != t.generation.Load() {
+		// the page could be published again by a reader that crabs latches in the meantime
+		t.snapshots.CompareAndDelete(p, s)
+		return nil, false
+	}
+	return s.node, true
+}
+
+// stableVersion returns the version and true if it is not being changed.
+func stableVersion(v *atomic.Uint64) (uint64, bool) {
+	n := v.Load()
+	return n, n%2 == 0
+}
+
+// findOptimistic returns the value of the key, which is nil if the key does not exist, without taking latches. It
+// returns false if the tree is not optimistic or if nodes are changed every time they are read, in which case find
+// should be used instead.
+func (tree *BTree) findOptimistic(key Key) (value interface{}, ok bool) {
+	if !tree.isOptimistic() {
+		return nil, false
+	}
+	r := &optimisticReader{tree: tree}
+	for r.retry() {
+		if value, ok = r.find(key); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// optimisticReader goes down the tree without latches. p is the node it reads, and version and low are the versions
+// of the node which are read before the node.
+type optimisticReader struct {
+	tree        *BTree
+	retries     int
+	treeVersion uint64
+	p           Pointer
+	version     uint64
+	low         uint64
+}
+
+// retry returns false if the reader restarted or read a node again maxOptimisticRestarts times. Otherwise, it yields
+// to the writers before the reader tries again.
+func (r *optimisticReader) retry() bool {
+	if r.retries == maxOptimisticRestarts {
+		return false
+	}
+	if r.retries > 0 {
+		runtime.Gosched()
+	}
+	r.retries++
+	return true
+}
+
+// visit reads the low version and the version of the node p before the node is read. Node that the reader is on should
+// be validated afterwards, so that p is known to be reachable from it.
+func (r *optimisticReader) visit(p Pointer) {
+	versions := &r.tree.versions
+	r.p, r.low = p, versions.lowOf(p).Load()
+	r.version = versions.of(p).Load()
+}
+
+// isValid returns true if the node is not changed since its version is read.
+func (r *optimisticReader) isValid() bool {
+	versions := &r.tree.versions
+	return r.version%2 == 0 && versions.of(r.p).Load() == r.version && versions.tree.Load() == r.treeVersion
+}
+
+// reread reads the version of the node again after the node is changed. It returns false if the reader should restart
+// from the root instead, since the node lost its smallest keys or it is freed.
+func (r *optimisticReader) reread() bool {
+	versions := &r.tree.versions
+	if !r.retry() {
+		return false
+	}
+	// version is read before the low version, which is increased before the version when the latch is released
+	r.version = versions.of(r.p).Load()
+	return versions.lowOf(r.p).Load() == r.low && versions.tree.Load() == r.treeVersion
+}
+
+// find goes down from the root to the leaf the key belongs to. It returns false if the reader should restart, in
+// which case value should not be used.
+func (r *optimisticReader) find(key Key) (value interface{}, ok bool) {
+	versions := &r.tree.versions
+	if r.treeVersion, ok = stableVersion(&versions.tree); !ok {
+		return nil, false
+	}
+	rootVersion, ok := stableVersion(&versions.root)
+	if !ok {
+		return nil, false
+	}
+	r.visit(Pointer(versions.rootPage.Load()))
+	if versions.root.Load() != rootVersion {
+		return nil, false
+	}
+	return r.follow(key)
+}
+
+// follow goes down from the node of the reader to the leaf the key belongs to, it returns false like find.
+func (r *optimisticReader) follow(key Key) (value interface{}, ok bool) {
+	versions := &r.tree.versions
+	defer func() {
+		if rec := recover(); rec != nil {
+			if r.isValid() {
+				panic(rec)
+			}
+			value, ok = nil, false
+		}
+	}()
+	for {
+		if r.version%2 == 1 {
+			if !r.reread() {
+				return nil, false
+			}
+			continue
+		}
+
+		next, val, ok := r.read(key)
+		if !ok {
+			// reader crabs latches instead, which publishes the page
+			r.retries = maxOptimisticRestarts
+			return nil, false
+		}
+		var nextLow, nextVersion uint64
+		if next != 0 {
+			nextLow = versions.lowOf(next).Load()
+			nextVersion = versions.of(next).Load()
+		}
+		if !r.isValid() {
+			if !r.reread() {
+				return nil, false
+			}
+			continue
+		}
+		if next == 0 {
+			return val, true
+		}
+		r.p, r.low, r.version = next, nextLow, nextVersion
+	}
+}
+
+// read reads the snapshot of the node of the reader and returns the node the key belongs to if it is another node,
+// which is either the node on the right or a child. Otherwise, the node is the leaf of the key and value is the value
+// of the key. It returns false if the node is not published.
+func (r *optimisticReader) read(key Key) (next Pointer, value interface{}, ok bool) {
+	node, ok := r.tree.versions.snapshotOf(r.p)
+	if !ok {
+		return 0, nil, false
+	}
+
+	if highKey := node.GetHighKey(); highKey != nil && !key.Less(highKey) {
+		return node.GetRight(), nil, true
+	}
+	i, found := node.findKey(key)
+	if node.IsLeaf() {
+		if found {
+			value = node.GetValueAt(i)
+		}
+		return 0, value, true
+	}
+	if found {
+		i++
+	}
+	return node.GetValueAt(i).(Pointer), nil, true
+}
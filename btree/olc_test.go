@@ -0,0 +1,356 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newOptimisticTree(n int) *BTree {
+	tree := NewBtreeWithPager(5, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	tree.SetLatchMode(Optimistic)
+	for i := 0; i < n; i++ {
+		tree.Insert(PersistentKey(2*i), fmt.Sprintf("value_%04d", 2*i))
+	}
+	return tree
+}
+
+// nodeVersions returns the versions of every node of the tree.
+func nodeVersions(t *testing.T, tree *BTree) map[Pointer]uint64 {
+	res, err := tree.Export(ExportOptions{})
+	assert.NoError(t, err)
+	versions := make(map[Pointer]uint64)
+	for _, n := range res.Nodes {
+		versions[n.PageId] = tree.versions.of(n.PageId).Load()
+	}
+	return versions
+}
+
+func leafOf(tree *BTree, key Key) Pointer {
+	_, stack := tree.FindAndGetStack(key, Read)
+	return stack[len(stack)-1].Node
+}
+
+func TestOLC_Writers_Should_Change_Versions_Of_Only_The_Nodes_They_Modify(t *testing.T) {
+	tree := newOptimisticTree(100)
+
+	// a key inserted to a leaf that is not full changes only the leaf, not the counts of its ancestors
+	key := PersistentKey(1)
+	for ; ; key += 2 {
+		leaf := tree.GetPager().GetNode(leafOf(tree, key))
+		if leaf.IsSafeForSplit(tree.degree) {
+			break
+		}
+	}
+	leaf := leafOf(tree, key)
+	before := nodeVersions(t, tree)
+	rootVersion := tree.versions.root.Load()
+	tree.Insert(key, "value_0001")
+	after := nodeVersions(t, tree)
+	for p, version := range after {
+		if p == leaf {
+			assert.Equal(t, before[p]+2, version)
+		} else {
+			assert.Equal(t, before[p], version, "version of page %v", p)
+		}
+	}
+	assert.Equal(t, rootVersion, tree.versions.root.Load())
+
+	// root pointer changes when the root is split
+	height := tree.Height()
+	for i := 0; tree.Height() == height; i++ {
+		tree.Insert(PersistentKey(1000+i), "value_0002")
+	}
+	assert.Equal(t, rootVersion+2, tree.versions.root.Load())
+	for p, version := range nodeVersions(t, tree) {
+		assert.Zero(t, version%2, "version of page %v", p)
+	}
+}
+
+func TestOLC_Read_Only_Operations_Should_Not_Change_Version_Of_Tree(t *testing.T) {
+	tree := newOptimisticTree(100)
+	version := tree.versions.tree.Load()
+
+	tree.Rank(PersistentKey(50))
+	tree.Select(10)
+	tree.Floor(PersistentKey(51))
+	tree.Lower(PersistentKey(50))
+	it := NewReverseTreeIterator(tree, tree.GetPager())
+	for it.Prev() != nil {
+	}
+	assert.NoError(t, tree.Verify())
+	_, err := tree.Export(ExportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, version, tree.versions.tree.Load())
+
+	tree.DeleteRange(PersistentKey(0), PersistentKey(10), RangeBounds{})
+	assert.Equal(t, version+2, tree.versions.tree.Load())
+}
+
+func TestOLC_Find_Should_Restart_While_Node_Is_Changed(t *testing.T) {
+	tree := newOptimisticTree(100)
+	leaf := leafOf(tree, PersistentKey(100))
+	assert.NotEqual(t, leaf, leafOf(tree, PersistentKey(0)))
+
+	// a writer makes the version of the leaf odd while it changes the leaf
+	latches := tree.newHeldLatches(true)
+	latches.lock(leaf)
+	latches.write(leaf)
+	_, ok := tree.findOptimistic(PersistentKey(100))
+	assert.False(t, ok)
+	value, ok := tree.findOptimistic(PersistentKey(0))
+	assert.True(t, ok)
+	assert.Equal(t, "value_0000", value)
+	latches.release()
+
+	value, ok = tree.findOptimistic(PersistentKey(100))
+	assert.True(t, ok)
+	assert.Equal(t, "value_0100", value)
+	value, ok = tree.findOptimistic(PersistentKey(101))
+	assert.True(t, ok)
+	assert.Nil(t, value)
+
+	// every node could change while an operation runs alone
+	exclusive := tree.lock(false)
+	_, ok = tree.findOptimistic(PersistentKey(0))
+	assert.False(t, ok)
+	tree.unlock(exclusive)
+	_, ok = tree.findOptimistic(PersistentKey(0))
+	assert.True(t, ok)
+}
+
+func TestOLC_Find_Should_Not_Be_Optimistic_By_Default_Or_With_TxPager(t *testing.T) {
+	tree := newOptimisticTree(10)
+	tree.SetLatchMode(Pessimistic)
+	_, ok := tree.findOptimistic(PersistentKey(0))
+	assert.False(t, ok)
+	assert.Equal(t, "value_0000", tree.Find(PersistentKey(0)))
+
+	pager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree = NewBtreeWithPager(5, pager)
+	tree.SetLatchMode(Optimistic)
+	tree.Insert(PersistentKey(0), "value_0000")
+	_, ok = tree.findOptimistic(PersistentKey(0))
+	assert.False(t, ok)
+	assert.Equal(t, "value_0000", tree.Find(PersistentKey(0)))
+}
+
+// newReaderAt returns an optimistic reader which has read the versions of the node p and not the node yet.
+func newReaderAt(tree *BTree, p Pointer) *optimisticReader {
+	r := &optimisticReader{tree: tree, treeVersion: tree.versions.tree.Load()}
+	r.retry()
+	r.visit(p)
+	return r
+}
+
+func TestOLC_Find_Should_Move_Right_When_Node_Is_Split_While_It_Is_Read(t *testing.T) {
+	tree := newOptimisticTree(100)
+	// sequential inserts leave the last leaf with the most keys
+	leaf := leafOf(tree, PersistentKey(198))
+	node := tree.GetPager().GetNode(leaf)
+	first, key := node.GetKeyAt(0).(PersistentKey), node.GetKeyAt(node.Keylen()-1)
+	tree.GetPager().Unpin(node, false)
+
+	// keys inserted in front of the key split the leaf, and the key is moved to the new leaf on its right. Right link
+	// of the leaf is read directly, since operations that run alone change the version of the tree.
+	r := newReaderAt(tree, leaf)
+	for k := key.(PersistentKey) - 1; k > first && node.GetRight() == 0; k -= 2 {
+		tree.Insert(k, "value_odd_")
+		node = tree.GetPager().GetNode(leaf)
+		tree.GetPager().Unpin(node, false)
+	}
+	value, ok := r.follow(key)
+	assert.True(t, ok)
+	assert.Equal(t, fmt.Sprintf("value_%04d", key), value)
+	assert.NotEqual(t, leaf, r.p)
+	assert.Equal(t, leafOf(tree, key), r.p)
+	assert.Equal(t, 2, r.retries, "reader should read the split leaf again instead of restarting")
+	assert.NoError(t, tree.Verify())
+}
+
+func TestOLC_Find_Should_Restart_When_Node_Loses_Its_Smallest_Keys(t *testing.T) {
+	tree := newOptimisticTree(100)
+	stack := tree.descend(nil, func(node Node) int { return 0 })
+	parent := tree.GetPager().GetNode(stack[len(stack)-2].Node)
+	leaf := parent.GetValueAt(1).(Pointer)
+	tree.GetPager().Unpin(parent, false)
+	node := tree.GetPager().GetNode(leaf)
+	key := node.GetKeyAt(0)
+	tree.GetPager().Unpin(node, false)
+
+	// keys deleted from the first leaf are replaced with the keys of the leaf on its right, or they are merged
+	r := newReaderAt(tree, leaf)
+	low := tree.versions.lowOf(leaf).Load()
+	for k := 0; tree.versions.lowOf(leaf).Load() == low; k += 2 {
+		tree.Delete(PersistentKey(k))
+	}
+	_, ok := r.follow(key)
+	assert.False(t, ok)
+	assert.Equal(t, fmt.Sprintf("value_%04d", key), tree.Find(key))
+}
+
+func TestOLC_Find_Should_Crab_Latches_Until_Pages_Are_Published(t *testing.T) {
+	tree := newOptimisticTree(100)
+	value, ok := tree.findOptimistic(PersistentKey(100))
+	assert.True(t, ok)
+	assert.Equal(t, "value_0100", value)
+
+	// pages changed by an operation that runs alone are published again by the readers that crab latches
+	assert.Equal(t, 5, tree.DeleteRange(PersistentKey(0), PersistentKey(10), RangeBounds{}))
+	_, ok = tree.findOptimistic(PersistentKey(100))
+	assert.False(t, ok)
+	assert.Equal(t, "value_0100", tree.Find(PersistentKey(100)))
+	value, ok = tree.findOptimistic(PersistentKey(100))
+	assert.True(t, ok)
+	assert.Equal(t, "value_0100", value)
+	_, ok = tree.findOptimistic(PersistentKey(0))
+	assert.False(t, ok)
+
+	// snapshots are copies, the reader does not see a change until the page is published
+	leaf := leafOf(tree, PersistentKey(100))
+	snapshot, ok := tree.versions.snapshotOf(leaf)
+	assert.True(t, ok)
+	node := tree.GetPager().GetNode(leaf)
+	assert.NotSame(t, &node.(PersistentPage).GetData()[0], &snapshot.(PersistentPage).GetData()[0])
+	tree.GetPager().Unpin(node, false)
+}
+
+func TestOLC_Snapshots_Should_Be_Kept_Only_For_Pages_Of_Tree(t *testing.T) {
+	tree := newOptimisticTree(100)
+	publishAll := func() {
+		for i := 0; i < 100; i++ {
+			tree.Find(PersistentKey(2 * i))
+		}
+	}
+	publishedPages := func() []Pointer {
+		var res []Pointer
+		tree.versions.snapshots.Range(func(p, _ interface{}) bool {
+			res = append(res, p.(Pointer))
+			return true
+		})
+		return res
+	}
+
+	publishAll()
+	published := len(publishedPages())
+	assert.Equal(t, len(nodeVersions(t, tree)), published)
+
+	// snapshots of the pages that an operation which runs alone changes are stale, and stale snapshots are removed when
+	// they are reached
+	tree.Update(PersistentKey(100), func(old interface{}, exists bool) (interface{}, Action) {
+		return "value_9999", ActionReplace
+	})
+	assert.Len(t, publishedPages(), published)
+	_, ok := tree.versions.snapshotOf(leafOf(tree, PersistentKey(100)))
+	assert.False(t, ok)
+	assert.Len(t, publishedPages(), published-1)
+	assert.Equal(t, "value_9999", tree.Find(PersistentKey(100)))
+
+	// freed pages lose their snapshots
+	publishAll()
+	assert.Equal(t, 70, tree.DeleteRange(PersistentKey(20), PersistentKey(160), RangeBounds{}))
+	pages := nodeVersions(t, tree)
+	for _, p := range publishedPages() {
+		_, ok := pages[p]
+		assert.True(t, ok, "page %v is freed", p)
+	}
+	publishAll()
+	assert.Equal(t, len(pages), len(publishedPages()))
+	assert.NoError(t, tree.Verify())
+}
+
+func TestOLC_Concurrent_Operations_Should_Match_Reference_Map(t *testing.T) {
+	goroutines, ops, keys := 8, 4000, 2000
+	if testing.Short() {
+		ops, keys = 500, 300
+	}
+
+	for name, trees := range referenceTrees {
+		t.Run(name, func(t *testing.T) {
+			tree := trees.newTree()
+			tree.SetLatchMode(Optimistic)
+			runAgainstReference(t, tree, goroutines, ops, keys, trees.value)
+		})
+	}
+}
+
+func TestOLC_Readers_Should_Find_Keys_While_Nodes_Around_Them_Are_Split_And_Merged(t *testing.T) {
+	readers, writers, ops := 6, 2, 20000
+	if testing.Short() {
+		ops = 2000
+	}
+
+	// even keys are only read, odd keys between them are inserted and deleted by the writer that owns them
+	tree := newOptimisticTree(1000)
+	var done atomic.Int32
+	runConcurrently(readers+writers, func(g int, r *rand.Rand) {
+		if g < writers {
+			for done.Load() < int32(readers) {
+				k := PersistentKey(2*(r.Intn(1000/writers)*writers+g) + 1)
+				if !tree.Delete(k) {
+					tree.Insert(k, "value_odd_")
+				}
+			}
+			return
+		}
+
+		defer done.Add(1)
+		for i := 0; i < ops; i++ {
+			k := 2 * r.Intn(1000)
+			assert.Equal(t, fmt.Sprintf("value_%04d", k), tree.Find(PersistentKey(k)))
+		}
+	})
+	assert.NoError(t, tree.Verify())
+}
+
+// benchmarkLatchModes runs op in parallel on trees with n keys in both latch modes.
+func benchmarkLatchModes(b *testing.B, n int, op func(tree *BTree, r *rand.Rand)) {
+	for _, mode := range []struct {
+		name string
+		mode LatchMode
+	}{{"pessimistic", Pessimistic}, {"optimistic", Optimistic}} {
+		b.Run(mode.name, func(b *testing.B) {
+			tree, err := BulkLoad(NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 16}), persistentKeySource(n), BulkLoadOptions{Degree: 64})
+			if err != nil {
+				b.Fatal(err)
+			}
+			tree.SetLatchMode(mode.mode)
+			var seed atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(seed.Add(1)))
+				for pb.Next() {
+					op(tree, r)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkLatch_Find(b *testing.B) {
+	n := 100000
+	benchmarkLatchModes(b, n, func(tree *BTree, r *rand.Rand) {
+		tree.Find(PersistentKey(r.Intn(n)))
+	})
+}
+
+func BenchmarkLatch_Find_With_10_Percent_Writes(b *testing.B) {
+	n := 100000
+	benchmarkLatchModes(b, n, func(tree *BTree, r *rand.Rand) {
+		k := PersistentKey(r.Intn(2 * n))
+		switch r.Intn(20) {
+		case 0:
+			tree.InsertOrReplace(k, "value")
+		case 1:
+			tree.Delete(k)
+		default:
+			tree.Find(k)
+		}
+	})
+}
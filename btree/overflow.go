@@ -0,0 +1,131 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+  Overflow pages:
+
+  A value of a slotted leaf node which does not fit in a cell of maxEntrySize bytes with its key is not stored in its
+  cell. It is split into
+  parts that are stored in a chain of overflow pages, and the cell only keeps a reference to the chain:
+
+  leaf cell:     | key length with overflowFlag | key | value length | first overflow page |
+  overflow page: | overflow page header(Next, Len) | Len bytes of the value | ... unused ... |
+
+  Overflow pages are allocated and freed through the Pager like nodes. The chain of a value is freed when its entry is
+  deleted or when its value is replaced.
+*/
+
+// overflowPageType is written to the byte where IsLeaf of a node is stored, like freePageType.
+const overflowPageType int8 = -2
+
+const (
+	overflowPageHeaderSize = pageChecksumSize + 1 + NodePointerSize + 4
+
+	// overflowFlag is set in the key length of a leaf cell whose value is stored in overflow pages.
+	overflowFlag uint16 = 1 << 15
+
+	// overflowRefSize is the size of value length and first overflow page that are stored in a cell instead of the value.
+	overflowRefSize = 4 + NodePointerSize
+)
+
+type overflowPageHeader struct {
+	Checksum uint32
+	Type     int8
+	Next     Pointer
+	Len      uint32
+}
+
+func readOverflowPageHeader(data []byte) *overflowPageHeader {
+	reader := bytes.NewReader(data)
+	dest := overflowPageHeader{}
+	err := binary.Read(reader, binary.BigEndian, &dest)
+	CheckErr(err)
+	return &dest
+}
+
+func writeOverflowPageHeader(h *overflowPageHeader, dest []byte) {
+	buf := bytes.Buffer{}
+	err := binary.Write(&buf, binary.BigEndian, h)
+	CheckErr(err)
+	copy(dest, buf.Bytes())
+}
+
+// overflowThreshold returns the length above which values of a key of keyLen bytes are stored in overflow pages for
+// the given page size, which is the length of the largest value whose cell and slot fit in maxEntrySize.
+func overflowThreshold(pageSize int, keyLen int) int {
+	return maxEntrySize(pageSize) - slotSize - cellKeyLenSize - keyLen
+}
+
+// writeOverflowChain stores data in a new chain of overflow pages and returns the first page of the chain.
+func writeOverflowChain(pager Pager, data []byte) Pointer {
+	capacity := pager.GetPageSize() - overflowPageHeaderSize
+
+	// chain is written backwards so that every page knows the next one when it is written
+	var next Pointer
+	for end := len(data); end > 0; {
+		start := (end - 1) / capacity * capacity
+		page := pager.NewOverflowPage()
+		writeOverflowPageHeader(&overflowPageHeader{Type: overflowPageType, Next: next, Len: uint32(end - start)}, page.GetData())
+		copy(page.GetData()[overflowPageHeaderSize:], data[start:end])
+		next = page.GetPageId()
+		pager.UnpinByPointer(next, true)
+		end = start
+	}
+	return next
+}
+
+// readOverflowChain returns the value of length n that is stored in the chain starting from the page p.
+func readOverflowChain(pager Pager, p Pointer, n int) []byte {
+	res := make([]byte, 0, n)
+	for p != 0 {
+		page := pager.GetOverflowPage(p)
+		h := readOverflowPageHeader(page.GetData())
+		res = append(res, page.GetData()[overflowPageHeaderSize:overflowPageHeaderSize+int(h.Len)]...)
+		pager.UnpinByPointer(p, false)
+		p = h.Next
+	}
+	if len(res) != n {
+		panic(fmt.Sprintf("overflow chain has %v bytes but value is %v bytes", len(res), n))
+	}
+	return res
+}
+
+// freeOverflowChain frees every page of the chain starting from the page p.
+func freeOverflowChain(pager Pager, p Pointer) {
+	for p != 0 {
+		page := pager.GetOverflowPage(p)
+		next := readOverflowPageHeader(page.GetData()).Next
+		pager.UnpinByPointer(p, false)
+		pager.FreeNode(p)
+		p = next
+	}
+}
+
+// newOverflowRef stores val in overflow pages and returns the reference that is stored in a leaf cell instead of it.
+func newOverflowRef(pager Pager, val []byte) []byte {
+	ref := make([]byte, overflowRefSize)
+	binary.BigEndian.PutUint32(ref, uint32(len(val)))
+	binary.BigEndian.PutUint64(ref[4:], uint64(writeOverflowChain(pager, val)))
+	return ref
+}
+
+func readOverflowRef(ref []byte) (n int, p Pointer) {
+	return int(binary.BigEndian.Uint32(ref)), Pointer(binary.BigEndian.Uint64(ref[4:]))
+}
+
+// freeNodeWithOverflow frees the node pointed by p and the overflow pages of its values. The node should not be pinned
+// by the caller.
+func freeNodeWithOverflow(pager Pager, p Pointer) {
+	if leaf, ok := pager.GetNode(p).(*SlottedLeafNode); ok {
+		for i := 0; i < leaf.Keylen(); i++ {
+			leaf.freeOverflowAt(i)
+		}
+	}
+	pager.UnpinByPointer(p, false)
+	pager.FreeNode(p)
+}
@@ -0,0 +1,149 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func blob(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	r.Read(b)
+	return string(b)
+}
+
+func TestOverflow_Chain_Should_Store_Values_Of_Any_Length(t *testing.T) {
+	pager := NewInMemoryPager(&PersistentKeySerializer{}, &VarStringValueSerializer{})
+	capacity := pager.GetPageSize() - overflowPageHeaderSize
+	r := rand.New(rand.NewSource(42))
+
+	for _, n := range []int{1, capacity - 1, capacity, capacity + 1, 3 * capacity, 100 << 10} {
+		data := []byte(blob(r, n))
+		first := writeOverflowChain(pager, data)
+		assert.Equal(t, (n+capacity-1)/capacity, pager.PageCount())
+		assert.Equal(t, data, readOverflowChain(pager, first, n))
+
+		freeOverflowChain(pager, first)
+		assert.Zero(t, pager.PageCount())
+	}
+}
+
+func TestOverflow_Large_Values_Should_Be_Stored_In_Overflow_Pages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &PersistentKeySerializer{}, &VarStringValueSerializer{})
+	assert.NoError(t, err)
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	r := rand.New(rand.NewSource(42))
+	n := 100
+	values := make([]string, n)
+	for _, i := range rand.Perm(n) {
+		values[i] = blob(r, r.Intn(300<<10))
+		tree.Insert(PersistentKey(i), values[i])
+	}
+	assert.Zero(t, pager.pool.pinnedCount())
+	for i := 0; i < n; i++ {
+		assert.Equal(t, values[i], tree.Find(PersistentKey(i)))
+	}
+	assert.Zero(t, pager.pool.pinnedCount())
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePager(path, &PersistentKeySerializer{}, &VarStringValueSerializer{})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	it := NewTreeIterator(tree, pager)
+	for i := 0; i < n; i++ {
+		assert.Equal(t, values[i], it.Next())
+	}
+}
+
+func TestOverflow_Values_Should_Be_Stored_In_Leaf_When_They_Fit_In_A_Cell(t *testing.T) {
+	pager := NewInMemoryPager(&VarStringKeySerializer{}, &VarStringValueSerializer{})
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	key := StringKey("key")
+	keyBytes, err := pager.GetKeySerializer().Serialize(key)
+	assert.NoError(t, err)
+	fits := overflowThreshold(pager.GetPageSize(), len(keyBytes))
+	assert.Greater(t, fits, 400)
+
+	// a value which fits in a cell with its key does not use an overflow page
+	pages := pager.PageCount()
+	tree.Insert(key, strings.Repeat("v", fits))
+	assert.Equal(t, pages, pager.PageCount())
+
+	tree.InsertOrReplace(key, strings.Repeat("v", fits+1))
+	assert.Equal(t, pages+1, pager.PageCount())
+	assert.Equal(t, strings.Repeat("v", fits+1), tree.Find(key))
+}
+
+func TestOverflow_Pages_Should_Be_Freed_When_Values_Are_Deleted_Or_Replaced(t *testing.T) {
+	pager := NewInMemoryPager(&VarStringKeySerializer{}, &VarStringValueSerializer{})
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	r := rand.New(rand.NewSource(42))
+	n := 200
+	for _, i := range rand.Perm(n) {
+		tree.Insert(StringKey(fmt.Sprintf("key_%v", i)), blob(r, r.Intn(20<<10)))
+	}
+	for _, i := range rand.Perm(n) {
+		switch i % 3 {
+		case 0:
+			// large value replaced by a small one
+			tree.InsertOrReplace(StringKey(fmt.Sprintf("key_%v", i)), "small")
+		case 1:
+			tree.InsertOrReplace(StringKey(fmt.Sprintf("key_%v", i)), blob(r, 10<<10))
+		}
+	}
+	for i := 0; i < n; i++ {
+		val := tree.Find(StringKey(fmt.Sprintf("key_%v", i)))
+		switch i % 3 {
+		case 0:
+			assert.Equal(t, "small", val)
+		case 1:
+			assert.Len(t, val, 10<<10)
+		}
+	}
+
+	for _, i := range rand.Perm(n) {
+		assert.True(t, tree.Delete(StringKey(fmt.Sprintf("key_%v", i))))
+	}
+	assert.Equal(t, 1, pager.PageCount())
+}
+
+func TestOverflow_Freed_Pages_Should_Be_Reused_By_File_Pager(t *testing.T) {
+	pager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &VarStringValueSerializer{})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	r := rand.New(rand.NewSource(42))
+	for i := 0; i < 20; i++ {
+		tree.Insert(PersistentKey(i), blob(r, 50<<10))
+	}
+	numPages := pager.disk.numPages
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			tree.InsertOrReplace(PersistentKey(i), blob(r, 50<<10))
+		}
+	}
+	for i := 0; i < 20; i++ {
+		assert.True(t, tree.Delete(PersistentKey(i)))
+	}
+	for i := 0; i < 20; i++ {
+		tree.Insert(PersistentKey(i), blob(r, 50<<10))
+	}
+	assert.LessOrEqual(t, int(pager.disk.numPages), int(numPages))
+	assert.Zero(t, pager.pool.pinnedCount())
+}
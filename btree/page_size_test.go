@@ -0,0 +1,108 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageSize_Tree_With_Max_Degree_Should_Fit_In_Pages(t *testing.T) {
+	for _, pageSize := range []int{MinPageSize, 16 << 10, MaxPageSize} {
+		t.Run(fmt.Sprintf("page_size_%v", pageSize), func(t *testing.T) {
+			pager, err := NewInMemoryPagerWithPageSize(&StringKeySerializer{Len: 100}, &StringValueSerializer{Len: 200}, pageSize)
+			assert.NoError(t, err)
+			tree, err := NewBtreeWithMaxDegree(pager)
+			assert.NoError(t, err)
+			assert.Equal(t, (pageSize-PersistentNodeHeaderSize)/300, tree.degree)
+
+			// keys of StringKeySerializer should be exactly Len bytes
+			n := 2000
+			for _, i := range rand.Perm(n) {
+				tree.Insert(StringKey(fmt.Sprintf("%0100d", i)), fmt.Sprintf("value_%05d", i))
+			}
+			for i := 0; i < n; i++ {
+				assert.Contains(t, tree.Find(StringKey(fmt.Sprintf("%0100d", i))), fmt.Sprintf("value_%05d", i))
+			}
+			for _, i := range rand.Perm(n) {
+				assert.True(t, tree.Delete(StringKey(fmt.Sprintf("%0100d", i))))
+			}
+		})
+	}
+}
+
+func TestPageSize_Degree_Which_Does_Not_Fit_Should_Be_Rejected(t *testing.T) {
+	pager := NewInMemoryPager(&StringKeySerializer{Len: 1000}, &StringValueSerializer{Len: 1000})
+	_, err := NewBtreeWithMaxDegree(pager)
+	assert.ErrorIs(t, err, ErrDegreeTooLarge)
+
+	pager = NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 100})
+	assert.Panics(t, func() { NewBtreeWithPager(80, pager) })
+	assert.NotPanics(t, func() {
+		NewBtreeWithPager(MaxDegree(DefaultPageSize, &PersistentKeySerializer{}, &StringValueSerializer{Len: 100}), pager)
+	})
+
+	pager, err = NewInMemoryPagerWithPageSize(&StringKeySerializer{Len: 1000}, &StringValueSerializer{Len: 1000}, MaxPageSize)
+	assert.NoError(t, err)
+	_, err = NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+}
+
+func TestPageSize_Invalid_Page_Sizes_Should_Be_Rejected(t *testing.T) {
+	for _, pageSize := range []int{1024, 5000, 128 << 10} {
+		_, err := NewInMemoryPagerWithPageSize(&PersistentKeySerializer{}, nil, pageSize)
+		assert.ErrorIs(t, err, ErrInvalidPageSize)
+
+		_, err = NewFilePagerWithOptions(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, nil, FilePagerOptions{PageSize: pageSize})
+		assert.ErrorIs(t, err, ErrInvalidPageSize)
+	}
+}
+
+func TestPageSize_File_Should_Be_Reopened_With_Its_Page_Size(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, FilePagerOptions{PageSize: 32 << 10})
+	assert.NoError(t, err)
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+	for i := 0; i < 10000; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+	assert.NoError(t, pager.Close())
+
+	_, err = NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, FilePagerOptions{PageSize: 16 << 10})
+	assert.ErrorIs(t, err, ErrPageSizeMismatch)
+
+	pager, err = NewFilePager(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer pager.Close()
+	assert.Equal(t, 32<<10, pager.GetPageSize())
+
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	for i := 0; i < 10000; i++ {
+		assert.Contains(t, tree.Find(PersistentKey(i)), "value")
+	}
+}
+
+func TestPageSize_Internal_Nodes_With_Max_Degree_Should_Be_Redistributed(t *testing.T) {
+	// internal nodes are full enough that they cannot hold the keys of both nodes while they are redistributed
+	pager := NewInMemoryPager(&StringKeySerializer{Len: 200}, &StringValueSerializer{Len: 10})
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+	assert.Equal(t, 17, tree.degree)
+
+	n := 20000
+	r := rand.New(rand.NewSource(42))
+	for _, i := range r.Perm(n) {
+		tree.Insert(StringKey(fmt.Sprintf("%0200d", i)), "value")
+	}
+	for j, i := range r.Perm(n) {
+		assert.True(t, tree.Delete(StringKey(fmt.Sprintf("%0200d", i))))
+		if j%1000 == 0 {
+			assert.NoError(t, tree.Verify())
+		}
+	}
+	assert.Zero(t, tree.Len())
+}
@@ -1,8 +1,8 @@
 package btree
 
 import (
-	"bytes"
-	"encoding/binary"
+	"errors"
+	"fmt"
 )
 
 // PersistentPage is an interface that InternalNode and SlottedPage structures should implement to be able to be
@@ -40,6 +40,49 @@ type Pager interface {
 
 	// UnpinByPointer does the same thing as Unpin to the node pointed by p Pointer.
 	UnpinByPointer(p Pointer, isDirty bool)
+
+	// FreeNode deallocates the page of the node pointed by p, so that it can be reused by NewInternalNode or NewLeafNode.
+	// Node should be unpinned before it is freed, and it should never be used after that. Overflow pages are freed
+	// by FreeNode as well.
+	FreeNode(p Pointer)
+
+	// NewOverflowPage allocates a page that stores a part of a value which is too large to be stored in a leaf
+	// node(see overflow pages). Like nodes, it is pinned until it is released by calling UnpinByPointer.
+	NewOverflowPage() PersistentPage
+
+	// GetOverflowPage returns the overflow page pointed by p. It should be released by calling UnpinByPointer.
+	GetOverflowPage(p Pointer) PersistentPage
+
+	// GetMetaPage returns the page with MetaPageId which is reserved for tree metadata. It is never returned as a node
+	// and like nodes, it should be released by calling UnpinByPointer with MetaPageId when it is no longer used.
+	GetMetaPage() PersistentPage
+
+	// GetKeySerializer returns the KeySerializer that nodes created by the pager use.
+	GetKeySerializer() KeySerializer
+
+	// GetValueSerializer returns the ValueSerializer that leaf nodes created by the pager use.
+	GetValueSerializer() ValueSerializer
+
+	// GetPageSize returns the size of the byte array of every page created by the pager.
+	GetPageSize() int
+}
+
+const (
+	// DefaultPageSize is the page size of pagers when it is not configured.
+	DefaultPageSize = 4096
+
+	// MinPageSize and MaxPageSize are the limits of a configured page size. Page size should also be a power of two.
+	MinPageSize = 4 << 10
+	MaxPageSize = 64 << 10
+)
+
+var ErrInvalidPageSize = errors.New("page size should be a power of two between 4K and 64K")
+
+func validatePageSize(pageSize int) error {
+	if pageSize < MinPageSize || pageSize > MaxPageSize || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidPageSize, pageSize)
+	}
+	return nil
 }
 
 /* NOOP IMPLEMENTATION*/
@@ -50,9 +93,13 @@ type NoopPersistentPage struct {
 }
 
 func NewNoopPersistentPage(pageId Pointer) *NoopPersistentPage {
+	return NewNoopPersistentPageWithSize(pageId, DefaultPageSize)
+}
+
+func NewNoopPersistentPageWithSize(pageId Pointer, size int) *NoopPersistentPage {
 	return &NoopPersistentPage{
 		pageId: pageId,
-		data:   make([]byte, 4096, 4096),
+		data:   make([]byte, size, size),
 	}
 }
 
@@ -65,13 +112,16 @@ func (n NoopPersistentPage) GetPageId() Pointer {
 }
 
 // will be used by noop persistent pager. Making them global is not good but NoopPager is only intented
-// for testing purposes
-var lastPageId Pointer = 0
+// for testing purposes. MetaPageId is reserved, so it is never given to a node. InMemoryPager should be preferred
+// when pages of different trees should not be shared.
+var lastPageId Pointer = MetaPageId
 var mapping = make(map[Pointer]Node)
+var overflowPages = make(map[Pointer]PersistentPage)
 
 type NoopPersistentPager struct {
 	KeySerializer   KeySerializer
 	ValueSerializer ValueSerializer
+	meta            *NoopPersistentPage
 }
 
 func (n2 *NoopPersistentPager) UnpinByPointer(p Pointer, isDirty bool) {}
@@ -79,58 +129,65 @@ func (n2 *NoopPersistentPager) UnpinByPointer(p Pointer, isDirty bool) {}
 func (n2 *NoopPersistentPager) Unpin(n Node, isDirty bool) {}
 
 func (n *NoopPersistentPager) NewInternalNode(firstPointer Pointer) Node {
-	h := PersistentNodeHeader{
-		IsLeaf: 0,
-		KeyLen: 0,
-	}
-
 	// create a new node
 	// TODO: should use an adam akıllı pager
 	lastPageId++
-	node := PersistentInternalNode{PersistentPage: NewNoopPersistentPage(lastPageId), pager: n, keySerializer: n.KeySerializer}
-
-	// write header
-	data := node.GetData()
-	WritePersistentNodeHeader(&h, data)
+	node := initInternalNode(n, NewNoopPersistentPage(lastPageId), firstPointer)
 
-	// write first pointer
-	buf := bytes.Buffer{}
-	err := binary.Write(&buf, binary.BigEndian, firstPointer)
-	CheckErr(err)
-	asByte := buf.Bytes()
-	copy(data[PersistentNodeHeaderSize:], asByte)
-
-	mapping[lastPageId] = &node
-	return &node
+	mapping[lastPageId] = node
+	return node
 }
 
 func (n *NoopPersistentPager) NewLeafNode() Node {
-	h := PersistentNodeHeader{
-		IsLeaf: 1,
-		KeyLen: 0,
-	}
-
 	// create a new node
 	// TODO: should use an adam akıllı pager
 	lastPageId++
-	var node PersistentLeafNode
-	if n.ValueSerializer == nil {
-		node = PersistentLeafNode{PersistentPage: NewNoopPersistentPage(lastPageId), pager: n, keySerializer: n.KeySerializer, valSerializer: &SlotPointerValueSerializer{}}
-	} else {
-		node = PersistentLeafNode{PersistentPage: NewNoopPersistentPage(lastPageId), pager: n, keySerializer: n.KeySerializer, valSerializer: n.ValueSerializer}
+	node := initLeafNode(n, NewNoopPersistentPage(lastPageId))
+
+	mapping[lastPageId] = node
+	return node
+}
 
+func (n *NoopPersistentPager) GetNode(p Pointer) Node {
+	return mapping[p]
+}
+
+func (n *NoopPersistentPager) FreeNode(p Pointer) {
+	delete(mapping, p)
+	delete(overflowPages, p)
+}
+
+func (n *NoopPersistentPager) NewOverflowPage() PersistentPage {
+	lastPageId++
+	page := NewNoopPersistentPage(lastPageId)
+	overflowPages[lastPageId] = page
+	return page
+}
+
+func (n *NoopPersistentPager) GetOverflowPage(p Pointer) PersistentPage {
+	return overflowPages[p]
+}
+
+func (n *NoopPersistentPager) GetMetaPage() PersistentPage {
+	if n.meta == nil {
+		n.meta = NewNoopPersistentPage(MetaPageId)
 	}
+	return n.meta
+}
 
-	// write header
-	data := node.GetData()
-	WritePersistentNodeHeader(&h, data)
+func (n *NoopPersistentPager) GetKeySerializer() KeySerializer {
+	return n.KeySerializer
+}
 
-	mapping[lastPageId] = &node
-	return &node
+func (n *NoopPersistentPager) GetValueSerializer() ValueSerializer {
+	if n.ValueSerializer == nil {
+		return &SlotPointerValueSerializer{}
+	}
+	return n.ValueSerializer
 }
 
-func (n *NoopPersistentPager) GetNode(p Pointer) Node {
-	return mapping[p]
+func (n *NoopPersistentPager) GetPageSize() int {
+	return DefaultPageSize
 }
 
 func NewNoopPager(serializer KeySerializer, valSerializer ValueSerializer) *NoopPersistentPager {
@@ -25,7 +25,14 @@ func TestDelete_Should_Decrease_Height_Size_When_Root_Is_Empty_3(t *testing.T) {
 		SlotIdx: 10,
 	}, res.(SlotPointer))
 
-	tree.Delete(PersistentKey(1))
+	// internal nodes of degree 4 underflow only when they have no keys, since a split leaves a single key in the node
+	// on its right
+	for _, val := range []int{1, 2} {
+		tree.Delete(PersistentKey(val))
+		_, stack = tree.FindAndGetStack(PersistentKey(1), Insert)
+		assert.Len(t, stack, 3)
+	}
+	tree.Delete(PersistentKey(3))
 	_, stack = tree.FindAndGetStack(PersistentKey(1), Insert)
 
 	assert.Len(t, stack, 2)
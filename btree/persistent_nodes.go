@@ -31,15 +31,21 @@ type SlotPointer struct {
 // type Pointer int64
 
 const (
-	PersistentNodeHeaderSize = 3 + 2*NodePointerSize
+	PersistentNodeHeaderSize = pageChecksumSize + 3 + 2*NodePointerSize
 	NodePointerSize          = 8 // Pointer is int64 which is 8 bytes
+	SubtreeCountSize         = 8 // number of keys in the subtree of a child is an int64 which is 8 bytes
+
+	// InternalChildSize is the size of a child of an internal node, which is its pointer followed by the number of keys
+	// in its subtree.
+	InternalChildSize = NodePointerSize + SubtreeCountSize
 )
 
 type PersistentNodeHeader struct {
-	IsLeaf int8
-	KeyLen int16
-	Right  Pointer
-	Left   Pointer
+	Checksum uint32 // only maintained by pagers which write pages to disk
+	IsLeaf   int8
+	KeyLen   int16
+	Right    Pointer
+	Left     Pointer
 }
 
 type PersistentLeafNode struct {
@@ -63,6 +69,58 @@ func WritePersistentNodeHeader(header *PersistentNodeHeader, dest []byte) {
 	copy(dest, buf.Bytes())
 }
 
+// InitInternalNodePage writes an empty internal node to data. First pointer is the only value of an empty internal node.
+func InitInternalNodePage(data []byte, firstPointer Pointer) {
+	h := PersistentNodeHeader{
+		IsLeaf: 0,
+		KeyLen: 0,
+	}
+	WritePersistentNodeHeader(&h, data)
+
+	// write first pointer
+	buf := bytes.Buffer{}
+	err := binary.Write(&buf, binary.BigEndian, firstPointer)
+	CheckErr(err)
+	copy(data[PersistentNodeHeaderSize:], buf.Bytes())
+	binary.BigEndian.PutUint64(data[PersistentNodeHeaderSize+NodePointerSize:], 0)
+}
+
+// InitLeafNodePage writes an empty leaf node to data.
+func InitLeafNodePage(data []byte) {
+	h := PersistentNodeHeader{
+		IsLeaf: 1,
+		KeyLen: 0,
+	}
+	WritePersistentNodeHeader(&h, data)
+}
+
+// highKeyOffset returns the offset of the high key of a node that is not slotted, which is stored at the end of its
+// page. Keys and values of the node end before it.
+func highKeyOffset(data []byte, keySerializer KeySerializer) int {
+	return len(data) - keySerializer.Size()
+}
+
+func readPersistentHighKey(data []byte, keySerializer KeySerializer) Key {
+	if ReadPersistentNodeHeader(data).Right == 0 {
+		return nil
+	}
+	key, err := keySerializer.Deserialize(data[highKeyOffset(data, keySerializer):])
+	CheckErr(err)
+
+	return key
+}
+
+func writePersistentHighKey(data []byte, keySerializer KeySerializer, key Key) {
+	dest := data[highKeyOffset(data, keySerializer):]
+	if key == nil {
+		clear(dest)
+		return
+	}
+	asByte, err := keySerializer.Serialize(key)
+	CheckErr(err)
+	copy(dest, asByte)
+}
+
 func (p *PersistentLeafNode) findKey(key Key) (index int, found bool) {
 	data := p.GetData()
 	h := ReadPersistentNodeHeader(data)
@@ -90,7 +148,8 @@ func (p *PersistentLeafNode) findKey(key Key) (index int, found bool) {
 func (p *PersistentLeafNode) shiftKeyValueToRightAt(n int) {
 	data := p.GetData()
 	offset := n * (p.keySerializer.Size() + p.valSerializer.Size())
-	copy(data[PersistentNodeHeaderSize+offset+p.keySerializer.Size()+p.valSerializer.Size():], data[PersistentNodeHeaderSize+offset:])
+	end := highKeyOffset(data, p.keySerializer)
+	copy(data[PersistentNodeHeaderSize+offset+p.keySerializer.Size()+p.valSerializer.Size():end], data[PersistentNodeHeaderSize+offset:])
 }
 
 func (p *PersistentLeafNode) shiftKeyValueToLeftAt(n int) {
@@ -140,6 +199,14 @@ func (p *PersistentLeafNode) GetValueAt(idx int) interface{} {
 	return val
 }
 
+func (p *PersistentLeafNode) getCountAt(idx int) int {
+	panic("leaf nodes do not have children")
+}
+
+func (p *PersistentLeafNode) setCountAt(idx int, count int) {
+	panic("leaf nodes do not have children")
+}
+
 func (p *PersistentLeafNode) GetValues() []interface{} {
 	h := ReadPersistentNodeHeader(p.GetData())
 	res := make([]interface{}, 0)
@@ -167,15 +234,16 @@ func (p *PersistentLeafNode) SplitNode(idx int) (right Pointer, keyAtLeft Key, k
 	copy(rightData[PersistentNodeHeaderSize:], leftData[PersistentNodeHeaderSize+offset:])
 	rightHeader := ReadPersistentNodeHeader(rightData)
 	rightHeader.KeyLen = rightKeyLen
-	rightHeader.Right = leftHeader.Right
-	rightHeader.Left = p.GetPageId()
-	leftHeader.Right = rightNode.GetPageId()
 	WritePersistentNodeHeader(rightHeader, rightData)
-	WritePersistentNodeHeader(leftHeader, leftData)
+	linkSplit(pager, p, rightNode, keyAtRight)
 
 	return rightNode.GetPageId(), keyAtLeft, keyAtRight
 }
 
+func (p *PersistentLeafNode) splitIndex(degree int) int {
+	return degree / 2
+}
+
 func (p *PersistentLeafNode) PrintNode() {
 	fmt.Printf("Node( ")
 	h := ReadPersistentNodeHeader(p.GetData())
@@ -212,7 +280,7 @@ func (p *PersistentLeafNode) DeleteAt(index int) {
 	h.KeyLen--
 	WritePersistentNodeHeader(h, p.GetData())
 
-	p.shiftKeyValueToLeftAt(index + 1) // TODO: handle overflow. overlflow pages maybe?
+	p.shiftKeyValueToLeftAt(index + 1) // values are of fixed size, they are never stored in overflow pages
 }
 
 func (p *PersistentLeafNode) Keylen() int {
@@ -225,6 +293,14 @@ func (p *PersistentLeafNode) GetRight() Pointer {
 	return h.Right
 }
 
+func (p *PersistentLeafNode) GetHighKey() Key {
+	return readPersistentHighKey(p.GetData(), p.keySerializer)
+}
+
+func (p *PersistentLeafNode) setHighKey(key Key) {
+	writePersistentHighKey(p.GetData(), p.keySerializer, key)
+}
+
 func (p *PersistentLeafNode) MergeNodes(rightNode Node, parent Node) {
 	if parent.IsLeaf() {
 		panic("parent node cannot be leaf")
@@ -241,11 +317,12 @@ func (p *PersistentLeafNode) MergeNodes(rightNode Node, parent Node) {
 	endOfLeft := PersistentNodeHeaderSize + (int(leftHeader.KeyLen) * (p.valSerializer.Size() + p.keySerializer.Size()))
 	copy(leftData[endOfLeft:], rightData[PersistentNodeHeaderSize:])
 
-	// TODO: destroy rightNode
+	// rightNode is not used anymore, it is freed by the caller once it is unpinned
+	mergeCounts(parent, i)
 	parent.DeleteAt(i)
 	leftHeader.KeyLen += rightHeader.KeyLen
-	leftHeader.Right = rightHeader.Right
 	WritePersistentNodeHeader(leftHeader, leftData)
+	linkMerge(p.pager, p, rightNode)
 }
 
 func (p *PersistentLeafNode) Redistribute(rightNode Node, parent Node) {
@@ -273,6 +350,16 @@ func (p *PersistentLeafNode) Redistribute(rightNode Node, parent Node) {
 	}
 
 	parent.setKeyAt(i, rightNode.GetKeyAt(0))
+	p.setHighKey(rightNode.GetKeyAt(0))
+	redistributeCounts(p, rightNode, parent, i)
+}
+
+func (p *PersistentLeafNode) canMerge(rightNode Node, degree int) bool {
+	return p.Keylen()+rightNode.Keylen() < degree
+}
+
+func (p *PersistentLeafNode) CanLend(degree int) bool {
+	return p.Keylen() >= (degree/2)+1
 }
 
 func (p *PersistentLeafNode) IsUnderFlow(degree int) bool {
@@ -346,13 +433,15 @@ func (p *PersistentInternalNode) findKey(key Key) (index int, found bool) {
 
 func (p *PersistentInternalNode) shiftKeyValueToRightAt(n int) {
 	data := p.GetData()
-	offset := n * (p.keySerializer.Size() + NodePointerSize)
+	offset := n * (p.keySerializer.Size() + InternalChildSize)
 
 	// in leaf nodes since there is one more pointer than keys additional pointer is stored right after the header
 	// after that layout is same as leaf node. Rest of the page is like an array of key value pairs. In internal nodes
 	// values are node pointers( Pointer )
-	pairBeginningOffset := NodePointerSize + PersistentNodeHeaderSize
-	copy(data[pairBeginningOffset+offset+p.keySerializer.Size()+NodePointerSize:], data[pairBeginningOffset+offset:])
+	pairBeginningOffset := InternalChildSize + PersistentNodeHeaderSize
+	// pairs are shifted up to the high key at the end of the page
+	end := highKeyOffset(data, p.keySerializer)
+	copy(data[pairBeginningOffset+offset+p.keySerializer.Size()+InternalChildSize:end], data[pairBeginningOffset+offset:])
 }
 
 func (p *PersistentInternalNode) shiftKeyValueToLeftAt(n int) {
@@ -361,20 +450,20 @@ func (p *PersistentInternalNode) shiftKeyValueToLeftAt(n int) {
 	}
 
 	data := p.GetData()
-	offset := n * (p.keySerializer.Size() + NodePointerSize)
-	destOffset := (n - 1) * (p.keySerializer.Size() + NodePointerSize)
+	offset := n * (p.keySerializer.Size() + InternalChildSize)
+	destOffset := (n - 1) * (p.keySerializer.Size() + InternalChildSize)
 
 	// in leaf nodes since there is one more pointer than keys additional pointer is stored right after the header
 	// after that layout is same as leaf node. Rest of the page is like an array of key value pairs. In internal nodes
 	// values are node pointers( Pointer )
-	pairBeginningOffset := NodePointerSize + PersistentNodeHeaderSize
+	pairBeginningOffset := InternalChildSize + PersistentNodeHeaderSize
 	copy(data[pairBeginningOffset+destOffset:], data[pairBeginningOffset+offset:])
 }
 
 func (p *PersistentInternalNode) setKeyAt(idx int, key Key) {
 	data := p.GetData()
-	offset := idx * (p.keySerializer.Size() + NodePointerSize)
-	pairBeginningOffset := PersistentNodeHeaderSize + NodePointerSize
+	offset := idx * (p.keySerializer.Size() + InternalChildSize)
+	pairBeginningOffset := PersistentNodeHeaderSize + InternalChildSize
 
 	asByte, err := p.keySerializer.Serialize(key)
 	CheckErr(err)
@@ -393,15 +482,15 @@ func (p *PersistentInternalNode) setValueAt(idx int, val interface{}) {
 		copy(data[PersistentNodeHeaderSize:], asByte)
 		return
 	}
-	offset := (idx-1)*(p.keySerializer.Size()+NodePointerSize) + p.keySerializer.Size()
-	pairBeginningOffset := PersistentNodeHeaderSize + NodePointerSize
+	offset := (idx-1)*(p.keySerializer.Size()+InternalChildSize) + p.keySerializer.Size()
+	pairBeginningOffset := PersistentNodeHeaderSize + InternalChildSize
 	copy(data[pairBeginningOffset+offset:], asByte)
 }
 
 func (p *PersistentInternalNode) GetKeyAt(idx int) Key {
 	data := p.GetData()
-	offset := idx * (p.keySerializer.Size() + NodePointerSize)
-	pairBeginningOffset := PersistentNodeHeaderSize + NodePointerSize
+	offset := idx * (p.keySerializer.Size() + InternalChildSize)
+	pairBeginningOffset := PersistentNodeHeaderSize + InternalChildSize
 	key, err := p.keySerializer.Deserialize(data[pairBeginningOffset+offset:])
 	CheckErr(err)
 
@@ -417,8 +506,8 @@ func (p *PersistentInternalNode) GetValueAt(idx int) interface{} {
 	} else {
 		// first pointer is in a special position so, this offset is the offset after the pairs started
 		// since first pointer is before pairs started in layout, it should not be calculated here. so idx - 1
-		offset := (idx-1)*(p.keySerializer.Size()+NodePointerSize) + p.keySerializer.Size()
-		pairBeginningOffset := PersistentNodeHeaderSize + NodePointerSize
+		offset := (idx-1)*(p.keySerializer.Size()+InternalChildSize) + p.keySerializer.Size()
+		pairBeginningOffset := PersistentNodeHeaderSize + InternalChildSize
 		reader = bytes.NewReader(data[pairBeginningOffset+offset:])
 	}
 	var val Pointer
@@ -428,6 +517,22 @@ func (p *PersistentInternalNode) GetValueAt(idx int) interface{} {
 	return val
 }
 
+// childOffset returns the offset of the pointer of the child at the given index, its subtree count follows it.
+func (p *PersistentInternalNode) childOffset(idx int) int {
+	if idx == 0 {
+		return PersistentNodeHeaderSize
+	}
+	return PersistentNodeHeaderSize + InternalChildSize + (idx-1)*(p.keySerializer.Size()+InternalChildSize) + p.keySerializer.Size()
+}
+
+func (p *PersistentInternalNode) getCountAt(idx int) int {
+	return int(binary.BigEndian.Uint64(p.GetData()[p.childOffset(idx)+NodePointerSize:]))
+}
+
+func (p *PersistentInternalNode) setCountAt(idx int, count int) {
+	binary.BigEndian.PutUint64(p.GetData()[p.childOffset(idx)+NodePointerSize:], uint64(count))
+}
+
 func (p *PersistentInternalNode) GetValues() []interface{} {
 	h := ReadPersistentNodeHeader(p.GetData())
 	res := make([]interface{}, 0)
@@ -452,21 +557,27 @@ func (p *PersistentInternalNode) SplitNode(idx int) (right Pointer, keyAtLeft Ke
 	rightKeyLen := leftHeader.KeyLen - int16(idx) - 1
 	leftHeader.KeyLen = int16(idx)
 	WritePersistentNodeHeader(leftHeader, leftData)
-	offset := (idx + 1) * (p.keySerializer.Size() + NodePointerSize)
-	pairBeginningOffset := PersistentNodeHeaderSize + NodePointerSize
+	offset := (idx + 1) * (p.keySerializer.Size() + InternalChildSize)
+	pairBeginningOffset := PersistentNodeHeaderSize + InternalChildSize
 
 	// corresponding pointer is in the next index that is why +1
 	rightNode := pager.NewInternalNode(p.GetValueAt(idx + 1).(Pointer)).(*PersistentInternalNode)
 	defer pager.Unpin(rightNode, true)
+	rightNode.setCountAt(0, p.getCountAt(idx+1))
 	rightData := rightNode.GetData()
 	copy(rightData[pairBeginningOffset:], leftData[pairBeginningOffset+offset:])
 	rightHeader := ReadPersistentNodeHeader(rightData)
 	rightHeader.KeyLen = rightKeyLen
 	WritePersistentNodeHeader(rightHeader, rightData)
+	linkSplit(pager, p, rightNode, keyAtRight)
 
 	return rightNode.GetPageId(), keyAtLeft, keyAtRight
 }
 
+func (p *PersistentInternalNode) splitIndex(degree int) int {
+	return degree / 2
+}
+
 func (p *PersistentInternalNode) PrintNode() {
 	fmt.Printf("Node( ")
 	h := ReadPersistentNodeHeader(p.GetData())
@@ -489,6 +600,7 @@ func (p *PersistentInternalNode) InsertAt(index int, key Key, val interface{}) {
 	p.shiftKeyValueToRightAt(index)
 	p.setKeyAt(index, key)
 	p.setValueAt(index+1, val)
+	p.setCountAt(index+1, 0)
 }
 
 func (p *PersistentInternalNode) IsLeaf() bool {
@@ -509,7 +621,16 @@ func (p *PersistentInternalNode) Keylen() int {
 }
 
 func (p *PersistentInternalNode) GetRight() Pointer {
-	panic("no right pointer for internal nodes for now")
+	h := ReadPersistentNodeHeader(p.GetData())
+	return h.Right
+}
+
+func (p *PersistentInternalNode) GetHighKey() Key {
+	return readPersistentHighKey(p.GetData(), p.keySerializer)
+}
+
+func (p *PersistentInternalNode) setHighKey(key Key) {
+	writePersistentHighKey(p.GetData(), p.keySerializer, key)
 }
 
 func (p *PersistentInternalNode) MergeNodes(rightNode Node, parent Node) {
@@ -557,8 +678,11 @@ func (p *PersistentInternalNode) MergeNodes(rightNode Node, parent Node) {
 		}
 		v := rightNode.GetValueAt(ii)
 		p.InsertAt(p.Keylen(), k, v)
+		p.setCountAt(p.Keylen(), rightNode.getCountAt(ii))
 	}
+	mergeCounts(parent, i)
 	parent.DeleteAt(i)
+	linkMerge(p.pager, p, rightNode)
 }
 
 func (p *PersistentInternalNode) Redistribute(rightNode Node, parent Node) {
@@ -590,40 +714,49 @@ func (p *PersistentInternalNode) Redistribute(rightNode Node, parent Node) {
 	var i int
 	for i = 0; parent.GetValueAt(i).(Pointer) != p.GetPageId(); i++ {
 	}
-	numKeysAtLeft := (p.Keylen() + rightNode.Keylen()) / 2
-	numKeysAtRight := (p.Keylen() + rightNode.Keylen()) - numKeysAtLeft
 
-	for ii := 0; ii < rightNode.Keylen()+1; ii++ {
-		var k Key
-		if ii == 0 {
-			k = parent.GetKeyAt(i)
-		} else {
-			k = rightNode.GetKeyAt(ii - 1)
-		}
-		v := rightNode.GetValueAt(ii)
-		p.InsertAt(p.Keylen(), k, v)
-	}
-	rightData := rightNode.(*PersistentInternalNode).GetData()
-	rightHeader := ReadPersistentNodeHeader(rightData)
-	rightHeader.KeyLen = 0
-	WritePersistentNodeHeader(rightHeader, rightData)
+	totalKeys := p.Keylen() + rightNode.Keylen()
+	totalKeysInLeftAfterRedistribute := totalKeys / 2
 
-	rightNode.setValueAt(0, p.GetValueAt(numKeysAtLeft+1))
-	for i := numKeysAtLeft + 1; i < numKeysAtLeft+1+numKeysAtRight; i++ {
-		k := p.GetKeyAt(i)
-		v := p.GetValueAt(i + 1)
-		rightNode.InsertAt(rightNode.Keylen(), k, v)
+	// keys are rotated through the parent one at a time, so that neither node has more keys than it can store
+	for p.Keylen() < totalKeysInLeftAfterRedistribute {
+		// separator and the first child of right are moved to the end of left, first key of right is the new separator
+		p.InsertAt(p.Keylen(), parent.GetKeyAt(i), rightNode.GetValueAt(0))
+		p.setCountAt(p.Keylen(), rightNode.getCountAt(0))
+		parent.setKeyAt(i, rightNode.GetKeyAt(0))
+		rightNode.setValueAt(0, rightNode.GetValueAt(1))
+		rightNode.setCountAt(0, rightNode.getCountAt(1))
+		rightNode.DeleteAt(0)
 	}
-	keyToParent := p.GetKeyAt(numKeysAtLeft)
-	parent.setKeyAt(i, keyToParent)
+	for p.Keylen() > totalKeysInLeftAfterRedistribute {
+		// separator and the last child of left are moved to the front of right, last key of left is the new separator
+		last := p.Keylen()
+		firstCount := rightNode.getCountAt(0)
+		rightNode.InsertAt(0, parent.GetKeyAt(i), rightNode.GetValueAt(0))
+		rightNode.setCountAt(1, firstCount)
+		rightNode.setValueAt(0, p.GetValueAt(last))
+		rightNode.setCountAt(0, p.getCountAt(last))
+		parent.setKeyAt(i, p.GetKeyAt(last-1))
+		p.DeleteAt(last - 1)
+	}
+
+	p.setHighKey(parent.GetKeyAt(i))
+	redistributeCounts(p, rightNode, parent, i)
+}
+
+func (p *PersistentInternalNode) canMerge(rightNode Node, degree int) bool {
+	return p.Keylen()+rightNode.Keylen()+1 < degree
+}
 
-	leftHeader := ReadPersistentNodeHeader(p.GetData())
-	leftHeader.KeyLen = int16(numKeysAtLeft)
-	WritePersistentNodeHeader(leftHeader, p.GetData())
+func (p *PersistentInternalNode) CanLend(degree int) bool {
+	// TODO: this is actually different for internal and leaf nodes since internal nodes have one more value than they have keys
+	return p.Keylen()+1 > (degree+1)/2
 }
 
+// IsUnderFlow returns true if the node has fewer keys than a split leaves in the node on the right, which keeps
+// degree-splitIndex-1 keys since the key at the split index is pushed up to the parent.
 func (p *PersistentInternalNode) IsUnderFlow(degree int) bool {
-	return p.Keylen() < degree/2
+	return p.Keylen() < degree-p.splitIndex(degree)-1
 }
 
 func (p *PersistentInternalNode) GetHeader() *PersistentNodeHeader {
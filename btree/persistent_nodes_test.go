@@ -162,3 +162,50 @@ func TestPersistentInternalNode_FindKey_Should_Find_Correct_Locations_When_Keys_
 		assert.Equal(t, Pointer(i+2), val.(Pointer))
 	}
 }
+
+func TestPersistentInternalNode_Split_And_Merge_Should_Keep_Links_And_High_Keys(t *testing.T) {
+	pager := NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	left, next := pager.NewInternalNode(Pointer(100)), pager.NewInternalNode(Pointer(200))
+	for i := 0; i < 9; i++ {
+		left.InsertAt(i, PersistentKey(i+1), Pointer(i+101))
+	}
+	h := left.GetHeader()
+	h.Right = next.GetPageId()
+	left.SetHeader(h)
+	left.setHighKey(PersistentKey(50))
+	h = next.GetHeader()
+	h.Left = left.GetPageId()
+	next.SetHeader(h)
+	pager.Unpin(next, true)
+
+	// new node takes the right link and the high key, pushed up key becomes the high key of the split node
+	right, _, pushedUp := left.SplitNode(4)
+	rightNode := pager.GetNode(right)
+	assert.Equal(t, PersistentKey(5), pushedUp)
+	assert.Equal(t, right, left.GetRight())
+	assert.Equal(t, pushedUp, left.GetHighKey())
+	assert.Equal(t, left.GetPageId(), rightNode.GetHeader().Left)
+	assert.Equal(t, next.GetPageId(), rightNode.GetRight())
+	assert.Equal(t, PersistentKey(50), rightNode.GetHighKey())
+	next = pager.GetNode(next.GetPageId())
+	assert.Equal(t, right, next.GetHeader().Left)
+	assert.Nil(t, next.GetHighKey())
+	pager.Unpin(next, false)
+
+	// keys shifted to right do not overwrite the high key at the end of the page
+	rightNode.InsertAt(0, PersistentKey(5), Pointer(105))
+	assert.Equal(t, PersistentKey(50), rightNode.GetHighKey())
+	rightNode.DeleteAt(0)
+
+	parent := pager.NewInternalNode(left.GetPageId())
+	parent.InsertAt(0, pushedUp, right)
+	left.MergeNodes(rightNode, parent)
+	assert.Equal(t, next.GetPageId(), left.GetRight())
+	assert.Equal(t, PersistentKey(50), left.GetHighKey())
+	next = pager.GetNode(next.GetPageId())
+	assert.Equal(t, left.GetPageId(), next.GetHeader().Left)
+	pager.Unpin(next, false)
+	for i := 0; i < 9; i++ {
+		assert.Equal(t, PersistentKey(i+1), left.GetKeyAt(i))
+	}
+}
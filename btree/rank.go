@@ -0,0 +1,117 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrIndexOutOfRange = errors.New("index is out of range")
+
+// Len returns the number of keys in the tree.
+func (tree *BTree) Len() int {
+	defer tree.unlockRead(tree.lockRead())
+	tree.metaMu.Lock()
+	defer tree.metaMu.Unlock()
+	return tree.length
+}
+
+// Rank is the same as TryRank, but it panics if an error occurs.
+func (tree *BTree) Rank(key Key) int {
+	rank, err := tree.TryRank(key)
+	CheckErr(err)
+	return rank
+}
+
+// TryRank returns the number of keys in the tree that are less than the key, which is the index of the key in
+// ascending order if it exists. The key does not need to exist. It goes down from the root once, adding up the subtree
+// counts of the children on the left of the path. Writers add their deltas to the counts on their way down, hence a
+// rank that is read while they run could be off by the number of writers which have not changed their leaves yet.
+func (tree *BTree) TryRank(key Key) (rank int, err error) {
+	defer recoverErr(&err)
+	defer tree.unlockRead(tree.lockRead())
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	return tree.rank(latches, key), nil
+}
+
+func (tree *BTree) rank(latches *heldLatches, key Key) int {
+	rank := 0
+	latches.lockRoot()
+	p := latches.lock(tree.Root)
+	for {
+		node := tree.pager.GetNode(p)
+		i, found := node.findKey(key)
+		if node.IsLeaf() {
+			tree.pager.Unpin(node, false)
+			return rank + i
+		}
+
+		if found {
+			i++
+		}
+		for j := 0; j < i; j++ {
+			rank += node.getCountAt(j)
+		}
+		p = node.GetValueAt(i).(Pointer)
+		tree.pager.Unpin(node, false)
+		latches.lock(p)
+		latches.releaseAncestors()
+	}
+}
+
+// Select is the same as TrySelect, but it panics if an error occurs.
+func (tree *BTree) Select(i int) (Key, interface{}) {
+	key, value, err := tree.TrySelect(i)
+	CheckErr(err)
+	return key, value
+}
+
+// TrySelect returns the key at the given index in ascending order of keys and its value, so that Rank of the key is i.
+// It returns ErrIndexOutOfRange if i is negative or not less than Len. Like Rank, it could be off by the number of
+// writers that run together.
+func (tree *BTree) TrySelect(i int) (key Key, value interface{}, err error) {
+	defer recoverErr(&err)
+	defer tree.unlockRead(tree.lockRead())
+	tree.metaMu.Lock()
+	length := tree.length
+	tree.metaMu.Unlock()
+	if i < 0 || i >= length {
+		return nil, nil, fmt.Errorf("%w: %v, tree has %v keys", ErrIndexOutOfRange, i, length)
+	}
+
+	latches := tree.newHeldLatches(false)
+	defer latches.release()
+	latches.lockRoot()
+	p := latches.lock(tree.Root)
+	for {
+		node := tree.pager.GetNode(p)
+		if node.IsLeaf() {
+			// counts could include the deltas of writers that run together, keys that are not in the leaf are on its
+			// right
+			for i >= node.Keylen() {
+				i -= node.Keylen()
+				right := node.GetRight()
+				tree.pager.Unpin(node, false)
+				if right == 0 {
+					return nil, nil, fmt.Errorf("%w: keys are deleted while the tree is read", ErrIndexOutOfRange)
+				}
+				latches.lock(right)
+				latches.releaseAncestors()
+				node = tree.pager.GetNode(right)
+			}
+			defer tree.pager.Unpin(node, false)
+			return node.GetKeyAt(i), node.GetValueAt(i), nil
+		}
+
+		// child j contains the key if i is less than its count after the keys of the children before it are skipped
+		j := 0
+		for j < node.Keylen() && i >= node.getCountAt(j) {
+			i -= node.getCountAt(j)
+			j++
+		}
+		p = node.GetValueAt(j).(Pointer)
+		tree.pager.Unpin(node, false)
+		latches.lock(p)
+		latches.releaseAncestors()
+	}
+}
@@ -0,0 +1,147 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkRanks checks that Rank and Select of the tree agree with the given keys, which should be sorted.
+func checkRanks(t *testing.T, tree *BTree, keys []int, n int) {
+	assert.Equal(t, len(keys), tree.Len())
+	for i := -1; i <= n; i++ {
+		assert.Equal(t, sort.SearchInts(keys, i), tree.Rank(PersistentKey(i)))
+	}
+	for i, k := range keys {
+		key, value := tree.Select(i)
+		assert.Equal(t, PersistentKey(k), key)
+		assert.Contains(t, value, fmt.Sprintf("value_%v", k))
+	}
+}
+
+func TestRank_And_Select_Should_Follow_Inserts_And_Deletes(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		degree        int
+		valSerializer ValueSerializer
+		padding       int
+	}{
+		{"degree_3", 3, &StringValueSerializer{Len: 10}, 0},
+		{"degree_7", 7, &StringValueSerializer{Len: 10}, 0},
+		{"degree_5", 5, &StringValueSerializer{Len: 10}, 0},
+		// slotted nodes are split by bytes, longer values make the tree deeper
+		{"slotted", 50, &VarStringValueSerializer{}, 40},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := 2000
+			tree := NewBtreeWithPager(tc.degree, NewInMemoryPager(&PersistentKeySerializer{}, tc.valSerializer))
+			for _, i := range rand.Perm(n) {
+				value := fmt.Sprintf("value_%v", i)
+				if tc.padding > 0 {
+					value += strings.Repeat(" ", i%tc.padding)
+				}
+				tree.Insert(PersistentKey(i), value)
+			}
+
+			exists := make(map[int]bool)
+			for i := 0; i < n; i++ {
+				exists[i] = true
+			}
+			for _, i := range rand.Perm(n)[:n/2] {
+				tree.Delete(PersistentKey(i))
+				delete(exists, i)
+			}
+
+			keys := make([]int, 0, len(exists))
+			for i := 0; i < n; i++ {
+				if exists[i] {
+					keys = append(keys, i)
+				}
+			}
+			checkTreeKeys(t, tree, keys)
+			checkRanks(t, tree, keys, n)
+		})
+	}
+}
+
+func TestRank_Should_Be_Maintained_By_Every_Modification(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 12}, FilePagerOptions{EnableWAL: true})
+	assert.NoError(t, err)
+
+	n := 3000
+	tree, err := BulkLoad(pager, persistentKeySource(n), BulkLoadOptions{Degree: 5})
+	assert.NoError(t, err)
+	exists := make(map[int]bool)
+	for i := 0; i < n; i++ {
+		exists[i] = true
+	}
+
+	batch := NewWriteBatch()
+	for i := 0; i < 900; i += 3 {
+		batch.Delete(PersistentKey(i))
+		delete(exists, i)
+	}
+	for i := n; i < n+300; i++ {
+		batch.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+		exists[i] = true
+	}
+	tree.Apply(batch)
+
+	assert.Equal(t, 150, tree.DeleteRange(PersistentKey(1000), PersistentKey(1150), RangeBounds{}))
+	for i := 1000; i < 1150; i++ {
+		delete(exists, i)
+	}
+	for i := 0; i < 50; i++ {
+		tree.Update(PersistentKey(1000+i*3), func(old interface{}, exists bool) (interface{}, Action) {
+			return fmt.Sprintf("value_%v", 1000+i*3), ActionInsert
+		})
+		exists[1000+i*3] = true
+		tree.Update(PersistentKey(2000+i*3+1), func(old interface{}, exists bool) (interface{}, Action) {
+			return nil, ActionDelete
+		})
+		delete(exists, 2000+i*3+1)
+	}
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePagerWithOptions(path, &PersistentKeySerializer{}, &StringValueSerializer{Len: 12}, FilePagerOptions{EnableWAL: true})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+
+	keys := make([]int, 0, len(exists))
+	for i := 0; i < n+300; i++ {
+		if exists[i] {
+			keys = append(keys, i)
+		}
+	}
+	checkTreeKeys(t, tree, keys)
+	checkRanks(t, tree, keys, n+300)
+}
+
+func TestSelect_Should_Return_Error_When_Index_Is_Out_Of_Range(t *testing.T) {
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	_, _, err := tree.TrySelect(0)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	assert.Equal(t, 0, tree.Rank(PersistentKey(10)))
+
+	for i := 0; i < 100; i++ {
+		tree.Insert(PersistentKey(i*2), fmt.Sprintf("value_%v", i*2))
+	}
+	_, _, err = tree.TrySelect(-1)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	_, _, err = tree.TrySelect(100)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+
+	key, _ := tree.Select(99)
+	assert.Equal(t, PersistentKey(198), key)
+	assert.Equal(t, 50, tree.Rank(PersistentKey(100)))
+	assert.Equal(t, 51, tree.Rank(PersistentKey(101)))
+	assert.Panics(t, func() { tree.Select(100) })
+}
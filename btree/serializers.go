@@ -3,6 +3,8 @@ package btree
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 )
 
 // KeySerializer is the interface a b+ tree uses to serialize keys in a b+ tree. A type should have a corresponding
@@ -12,7 +14,7 @@ type KeySerializer interface {
 	Serialize(key Key) ([]byte, error)
 	Deserialize([]byte) (Key, error)
 
-	// Size return byte length of the serialized key.
+	// Size return byte length of the serialized key. It is VarSize if serialized keys can have different lengths.
 	Size() int
 }
 
@@ -62,28 +64,46 @@ func (s *StringKeySerializer) Size() int {
 	return s.Len
 }
 
+// VarStringKeySerializer serializes a StringKey to its bytes without any padding, hence keys can be of any length.
+// Nodes of a pager which uses it are slotted(see SlottedLeafNode).
+type VarStringKeySerializer struct{}
+
+func (s *VarStringKeySerializer) Serialize(key Key) ([]byte, error) {
+	return []byte(key.(StringKey)), nil
+}
+
+func (s *VarStringKeySerializer) Deserialize(data []byte) (Key, error) {
+	return StringKey(data), nil
+}
+
+func (s *VarStringKeySerializer) Size() int {
+	return VarSize
+}
+
 // ValueSerializer is very similar to KeySerializer. A type should have a ValueSerializer implemented to be
-// used as a value in b+ tree. All values serialized by a ValueSerializer should also have the same length although
-// that behaviour can be changed easily by slightly modifying the implementation since values are only stored in
-// leaf nodes.
+// used as a value in b+ tree. Values serialized by a ValueSerializer have the same length unless its Size is VarSize,
+// in which case leaf nodes are slotted and every value is stored with its own length.
 type ValueSerializer interface {
 	Serialize(val interface{}) ([]byte, error)
 	Deserialize([]byte) (interface{}, error)
 	Size() int
 }
 
+var ErrValueTooLarge = errors.New("value is larger than the size of its serializer")
+
+// StringValueSerializer pads values to Len bytes with zeros. Values longer than Len are rejected with
+// ErrValueTooLarge, VarStringValueSerializer should be used if values do not have a reasonable maximum length.
 type StringValueSerializer struct {
 	Len int
 }
 
 func (s *StringValueSerializer) Serialize(val interface{}) ([]byte, error) {
-	buf := bytes.Buffer{}
-	err := binary.Write(&buf, binary.BigEndian, ([]byte)(val.(string)))
-	if err != nil {
-		return nil, err
+	str := val.(string)
+	if len(str) > s.Len {
+		return nil, fmt.Errorf("%w: value is %v bytes, at most %v bytes fit", ErrValueTooLarge, len(str), s.Len)
 	}
 	res := make([]byte, s.Len)
-	copy(res, buf.Bytes())
+	copy(res, str)
 	return res, nil
 }
 
@@ -95,6 +115,22 @@ func (s *StringValueSerializer) Size() int {
 	return s.Len
 }
 
+// VarStringValueSerializer serializes a string value to its bytes without any padding. Leaf nodes of a pager which
+// uses it are slotted(see SlottedLeafNode).
+type VarStringValueSerializer struct{}
+
+func (s *VarStringValueSerializer) Serialize(val interface{}) ([]byte, error) {
+	return []byte(val.(string)), nil
+}
+
+func (s *VarStringValueSerializer) Deserialize(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func (s *VarStringValueSerializer) Size() int {
+	return VarSize
+}
+
 type SlotPointerValueSerializer struct {
 }
 
@@ -0,0 +1,879 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/*
+  Slotted node structure:
+
+  Nodes of a pager whose KeySerializer or ValueSerializer returns VarSize from Size are stored in slotted format. Every key-value pair
+  is a cell of variable length in a heap that grows from the end of the page towards its beginning, and a slot
+  directory of fixed size slots that grows the other way keeps the cells in key order.
+
+  ---------------------------------------------------------------------------------------------------
+  | node header | slotted header | (first pointer) | Slot_0 | Slot_1 | ... free ... | Cell_1 | Cell_0 |
+  ---------------------------------------------------------------------------------------------------
+
+  A cell of a leaf node is | key length | key | value | and a cell of an internal node is | pointer | key | where the
+  pointer is the value after the key. First pointer of an internal node does not have a key, hence it is stored right
+  after the slotted header like in PersistentInternalNode. High key of a node is a cell of only the key in the heap,
+  whose slot is in the slotted header instead of the slot directory.
+
+  Since the number of keys that fit in a node depends on their lengths, slotted nodes ignore degree and decide if they
+  overflow or underflow by the bytes they use:
+  - An entry, which is a cell and its slot, can be at most 1/8 of the node.
+  - A node overflows when there is no room for another entry of maximum size, so a node that does not overflow always
+    has room for an insert or for a key in it to be replaced by a longer one.
+  - A node underflows when less than 1/4 of it is used and it can lend entries to a sibling when more than 1/2 of it
+    is used. These guarantee that two nodes that are merged or redistributed never overflow.
+*/
+
+// VarSize is returned from Size by serializers whose output length varies with the key or value.
+const VarSize = -1
+
+const (
+	slottedHeaderSize = 12
+	slotSize          = 4
+	cellKeyLenSize    = 2
+)
+
+var ErrEntryTooLarge = errors.New("key and value are too large to be stored in a node")
+
+// slottedHeader is written after PersistentNodeHeader in slotted nodes.
+type slottedHeader struct {
+	HeapStart  uint32 // offset of the first byte of the cell heap
+	Fragmented uint32 // bytes of the cells in the heap which are deleted but not reclaimed yet
+	HighKey    slot   // cell of the high key, its length is 0 if the node does not have one
+}
+
+type slot struct {
+	Offset uint16
+	Len    uint16
+}
+
+// isSlotted returns true if a pager with the given serializers stores its nodes in slotted format.
+func isSlotted(keySerializer KeySerializer, valSerializer ValueSerializer) bool {
+	return keySerializer.Size() == VarSize || (valSerializer != nil && valSerializer.Size() == VarSize)
+}
+
+// maxEntrySize returns the largest size of a cell and its slot in a slotted node of the given page size.
+func maxEntrySize(pageSize int) int {
+	return (pageSize - PersistentNodeHeaderSize - slottedHeaderSize - InternalChildSize) / 8
+}
+
+// checkEntrySize returns ErrEntryTooLarge if the key and the value cannot be stored in a node of the pager. It also
+// returns the errors of the serializers, so that an entry which cannot be serialized is rejected before the tree is
+// modified.
+func checkEntrySize(pager Pager, key Key, value interface{}) error {
+	_, _, err := entrySizes(pager, key, value)
+	return err
+}
+
+// entrySizes returns the bytes a slotted leaf node uses to store the key and the value, and the bytes a slotted
+// internal node uses to store the key and a pointer, including their slots. Sizes are 0 if nodes of the pager are not
+// slotted.
+func entrySizes(pager Pager, key Key, value interface{}) (leafEntry int, internalEntry int, err error) {
+	keyBytes, err := pager.GetKeySerializer().Serialize(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	valBytes, err := pager.GetValueSerializer().Serialize(value)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isSlotted(pager.GetKeySerializer(), pager.GetValueSerializer()) {
+		return 0, 0, nil
+	}
+
+	storedVal := len(valBytes)
+	if storedVal > overflowThreshold(pager.GetPageSize(), len(keyBytes)) {
+		storedVal = overflowRefSize
+	}
+	leafEntry = slotSize + cellKeyLenSize + len(keyBytes) + storedVal
+	internalEntry = slotSize + InternalChildSize + len(keyBytes)
+	if max := maxEntrySize(pager.GetPageSize()); leafEntry > max || internalEntry > max {
+		return 0, 0, fmt.Errorf("%w: key is %v bytes and value is stored in %v bytes, at most %v bytes fit", ErrEntryTooLarge, len(keyBytes), storedVal, max-slotSize-cellKeyLenSize)
+	}
+	return leafEntry, internalEntry, nil
+}
+
+// InitSlottedLeafNodePage writes an empty slotted leaf node to data.
+func InitSlottedLeafNodePage(data []byte) {
+	WritePersistentNodeHeader(&PersistentNodeHeader{IsLeaf: 1}, data)
+	writeSlottedHeader(&slottedHeader{HeapStart: uint32(len(data))}, data)
+}
+
+// InitSlottedInternalNodePage writes an empty slotted internal node to data.
+func InitSlottedInternalNodePage(data []byte, firstPointer Pointer) {
+	WritePersistentNodeHeader(&PersistentNodeHeader{IsLeaf: 0}, data)
+	writeSlottedHeader(&slottedHeader{HeapStart: uint32(len(data))}, data)
+	binary.BigEndian.PutUint64(data[PersistentNodeHeaderSize+slottedHeaderSize:], uint64(firstPointer))
+	binary.BigEndian.PutUint64(data[PersistentNodeHeaderSize+slottedHeaderSize+NodePointerSize:], 0)
+}
+
+// initLeafNode writes an empty leaf node in the node format of the pager to the page and returns the node.
+func initLeafNode(pager Pager, page PersistentPage) Node {
+	if isSlotted(pager.GetKeySerializer(), pager.GetValueSerializer()) {
+		InitSlottedLeafNodePage(page.GetData())
+	} else {
+		InitLeafNodePage(page.GetData())
+	}
+	return wrapNode(pager, page)
+}
+
+// initInternalNode writes an empty internal node in the node format of the pager to the page and returns the node.
+func initInternalNode(pager Pager, page PersistentPage, firstPointer Pointer) Node {
+	if isSlotted(pager.GetKeySerializer(), pager.GetValueSerializer()) {
+		InitSlottedInternalNodePage(page.GetData(), firstPointer)
+	} else {
+		InitInternalNodePage(page.GetData(), firstPointer)
+	}
+	return wrapNode(pager, page)
+}
+
+// wrapNode returns the node stored in the page with the node type of the pager.
+func wrapNode(pager Pager, page PersistentPage) Node {
+	ks, vs := pager.GetKeySerializer(), pager.GetValueSerializer()
+	isLeaf := ReadPersistentNodeHeader(page.GetData()).IsLeaf == 1
+	switch {
+	case isSlotted(ks, vs) && isLeaf:
+		return &SlottedLeafNode{PersistentPage: page, pager: pager, keySerializer: ks, valSerializer: vs}
+	case isSlotted(ks, vs):
+		return &SlottedInternalNode{PersistentPage: page, pager: pager, keySerializer: ks}
+	case isLeaf:
+		return &PersistentLeafNode{PersistentPage: page, pager: pager, keySerializer: ks, valSerializer: vs}
+	default:
+		return &PersistentInternalNode{PersistentPage: page, pager: pager, keySerializer: ks}
+	}
+}
+
+func readSlottedHeader(data []byte) *slottedHeader {
+	return &slottedHeader{
+		HeapStart:  binary.BigEndian.Uint32(data[PersistentNodeHeaderSize:]),
+		Fragmented: binary.BigEndian.Uint32(data[PersistentNodeHeaderSize+4:]),
+		HighKey: slot{
+			Offset: binary.BigEndian.Uint16(data[PersistentNodeHeaderSize+8:]),
+			Len:    binary.BigEndian.Uint16(data[PersistentNodeHeaderSize+10:]),
+		},
+	}
+}
+
+func writeSlottedHeader(h *slottedHeader, data []byte) {
+	binary.BigEndian.PutUint32(data[PersistentNodeHeaderSize:], h.HeapStart)
+	binary.BigEndian.PutUint32(data[PersistentNodeHeaderSize+4:], h.Fragmented)
+	binary.BigEndian.PutUint16(data[PersistentNodeHeaderSize+8:], h.HighKey.Offset)
+	binary.BigEndian.PutUint16(data[PersistentNodeHeaderSize+10:], h.HighKey.Len)
+}
+
+// slottedCells manages the slot directory and the cell heap of a slotted node. Slots start at begin. Number of cells
+// is the KeyLen in the node header.
+type slottedCells struct {
+	data  []byte
+	begin int
+}
+
+func (c slottedCells) count() int {
+	return int(ReadPersistentNodeHeader(c.data).KeyLen)
+}
+
+func (c slottedCells) setCount(n int) {
+	h := ReadPersistentNodeHeader(c.data)
+	h.KeyLen = int16(n)
+	WritePersistentNodeHeader(h, c.data)
+}
+
+func (c slottedCells) slotAt(idx int) slot {
+	offset := c.begin + idx*slotSize
+	return slot{
+		Offset: binary.BigEndian.Uint16(c.data[offset:]),
+		Len:    binary.BigEndian.Uint16(c.data[offset+2:]),
+	}
+}
+
+func (c slottedCells) setSlotAt(idx int, s slot) {
+	offset := c.begin + idx*slotSize
+	binary.BigEndian.PutUint16(c.data[offset:], s.Offset)
+	binary.BigEndian.PutUint16(c.data[offset+2:], s.Len)
+}
+
+// cellAt returns the cell at the given index. Returned slice points to the page, it should be copied if it is going
+// to be used after the node is modified.
+func (c slottedCells) cellAt(idx int) []byte {
+	s := c.slotAt(idx)
+	return c.data[int(s.Offset) : int(s.Offset)+int(s.Len)]
+}
+
+func (c slottedCells) entrySize(idx int) int {
+	return slotSize + int(c.slotAt(idx).Len)
+}
+
+// capacity is the number of bytes that slots and cells can use.
+func (c slottedCells) capacity() int {
+	return len(c.data) - c.begin
+}
+
+func (c slottedCells) used() int {
+	h := readSlottedHeader(c.data)
+	return c.count()*slotSize + len(c.data) - int(h.HeapStart) - int(h.Fragmented)
+}
+
+func (c slottedCells) free() int {
+	return c.capacity() - c.used()
+}
+
+// allocate reserves n bytes in the heap for a new cell, compacting the heap if the free space is fragmented, and
+// returns the offset of the reserved bytes. Room for a new slot is reserved as well if newSlot is true.
+func (c slottedCells) allocate(n int, newSlot bool) int {
+	slotsEnd := c.begin + c.count()*slotSize
+	if newSlot {
+		slotsEnd += slotSize
+	}
+	h := readSlottedHeader(c.data)
+	if int(h.HeapStart)-slotsEnd < n {
+		c.compact()
+		h = readSlottedHeader(c.data)
+	}
+	if int(h.HeapStart)-slotsEnd < n {
+		panic(fmt.Sprintf("there is no room for a %v bytes cell in the node, node should have been split", n))
+	}
+
+	h.HeapStart -= uint32(n)
+	writeSlottedHeader(h, c.data)
+	return int(h.HeapStart)
+}
+
+// compact moves cells to the end of the page so that the space of the deleted cells can be reused.
+func (c slottedCells) compact() {
+	n := c.count()
+	cells := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		cells[i] = append([]byte{}, c.cellAt(i)...)
+	}
+	highKey := append([]byte{}, c.highKey()...)
+
+	heapStart := len(c.data)
+	for i, cell := range cells {
+		heapStart -= len(cell)
+		copy(c.data[heapStart:], cell)
+		c.setSlotAt(i, slot{Offset: uint16(heapStart), Len: uint16(len(cell))})
+	}
+	heapStart -= len(highKey)
+	copy(c.data[heapStart:], highKey)
+	writeSlottedHeader(&slottedHeader{
+		HeapStart: uint32(heapStart),
+		HighKey:   slot{Offset: uint16(heapStart), Len: uint16(len(highKey))},
+	}, c.data)
+}
+
+// highKey returns the cell of the high key, which is empty if the node does not have one. Returned slice points to
+// the page like the one returned from cellAt.
+func (c slottedCells) highKey() []byte {
+	s := readSlottedHeader(c.data).HighKey
+	return c.data[int(s.Offset) : int(s.Offset)+int(s.Len)]
+}
+
+// setHighKey replaces the cell of the high key, it is removed if the cell is empty.
+func (c slottedCells) setHighKey(cell []byte) {
+	h := readSlottedHeader(c.data)
+	h.Fragmented += uint32(h.HighKey.Len)
+	h.HighKey = slot{}
+	writeSlottedHeader(h, c.data)
+	if len(cell) == 0 {
+		return
+	}
+
+	offset := c.allocate(len(cell), false)
+	copy(c.data[offset:], cell)
+	h = readSlottedHeader(c.data)
+	h.HighKey = slot{Offset: uint16(offset), Len: uint16(len(cell))}
+	writeSlottedHeader(h, c.data)
+}
+
+func (c slottedCells) insertCell(idx int, cell []byte) {
+	offset := c.allocate(len(cell), true)
+	copy(c.data[offset:], cell)
+
+	n := c.count()
+	slotsBegin := c.begin + idx*slotSize
+	copy(c.data[slotsBegin+slotSize:], c.data[slotsBegin:c.begin+n*slotSize])
+	c.setSlotAt(idx, slot{Offset: uint16(offset), Len: uint16(len(cell))})
+	c.setCount(n + 1)
+}
+
+func (c slottedCells) deleteCell(idx int) {
+	h := readSlottedHeader(c.data)
+	h.Fragmented += uint32(c.slotAt(idx).Len)
+	writeSlottedHeader(h, c.data)
+
+	n := c.count()
+	slotsBegin := c.begin + idx*slotSize
+	copy(c.data[slotsBegin:], c.data[slotsBegin+slotSize:c.begin+n*slotSize])
+	c.setCount(n - 1)
+}
+
+func (c slottedCells) replaceCell(idx int, cell []byte) {
+	s := c.slotAt(idx)
+	h := readSlottedHeader(c.data)
+	if len(cell) <= int(s.Len) {
+		copy(c.data[s.Offset:], cell)
+		h.Fragmented += uint32(int(s.Len) - len(cell))
+		writeSlottedHeader(h, c.data)
+		c.setSlotAt(idx, slot{Offset: s.Offset, Len: uint16(len(cell))})
+		return
+	}
+
+	// old cell is released before allocating so that compaction can reclaim it
+	h.Fragmented += uint32(s.Len)
+	writeSlottedHeader(h, c.data)
+	c.setSlotAt(idx, slot{Offset: s.Offset, Len: 0})
+	offset := c.allocate(len(cell), false)
+	copy(c.data[offset:], cell)
+	c.setSlotAt(idx, slot{Offset: uint16(offset), Len: uint16(len(cell))})
+}
+
+// moveCells appends cells of src in [from, to) to the end of c and deletes them from src.
+func (c slottedCells) moveCells(src slottedCells, from, to int) {
+	for i := from; i < to; i++ {
+		c.insertCell(c.count(), append([]byte{}, src.cellAt(i)...))
+	}
+	for i := to - 1; i >= from; i-- {
+		src.deleteCell(i)
+	}
+}
+
+// splitIndex returns the index of the first cell that should be moved to the right node, so that both nodes use
+// about the same number of bytes after the split. At least minRight cells are left to right node.
+func (c slottedCells) splitIndex(minRight int) int {
+	n, half, acc := c.count(), c.used()/2, 0
+	for i := 0; i < n; i++ {
+		acc += c.entrySize(i)
+		if acc >= half {
+			idx := i + 1
+			if idx > n-minRight {
+				idx = n - minRight
+			}
+			return idx
+		}
+	}
+	return n - minRight
+}
+
+func (c slottedCells) isOverFlow() bool {
+	return c.free() < maxEntrySize(len(c.data))
+}
+
+func (c slottedCells) isUnderFlow() bool {
+	return c.used() < c.capacity()/4
+}
+
+// canMerge returns true if the cells of right and a cell of at most separator bytes fit in c without overflowing it.
+func (c slottedCells) canMerge(right slottedCells, separator int) bool {
+	return c.free()-right.used()-separator >= maxEntrySize(len(c.data))
+}
+
+func (c slottedCells) canLend() bool {
+	return c.used() > c.capacity()/2
+}
+
+func (c slottedCells) isSafeForSplit() bool {
+	return c.free() >= 2*maxEntrySize(len(c.data))
+}
+
+func (c slottedCells) isSafeForMerge() bool {
+	return c.used()-maxEntrySize(len(c.data)) >= c.capacity()/4
+}
+
+// slottedHighKey returns the high key of a slotted node, or nil if the node is the last one of its level.
+func slottedHighKey(n Node, c slottedCells, keySerializer KeySerializer) Key {
+	if n.GetRight() == 0 {
+		return nil
+	}
+	key, err := keySerializer.Deserialize(c.highKey())
+	CheckErr(err)
+
+	return key
+}
+
+func setSlottedHighKey(c slottedCells, keySerializer KeySerializer, key Key) {
+	if key == nil {
+		c.setHighKey(nil)
+		return
+	}
+	keyBytes, err := keySerializer.Serialize(key)
+	CheckErr(err)
+	c.setHighKey(keyBytes)
+}
+
+func slottedFindKey(n Node, keyLen int, key Key) (index int, found bool) {
+	i := sort.Search(keyLen, func(i int) bool {
+		return key.Less(n.GetKeyAt(i))
+	})
+
+	if i > 0 && !n.GetKeyAt(i-1).Less(key) {
+		return i - 1, true
+	}
+	return i, false
+}
+
+func indexInParent(p Node, parent Node) int {
+	var i int
+	for i = 0; parent.GetValueAt(i).(Pointer) != p.GetPageId(); i++ {
+	}
+	return i
+}
+
+// SlottedLeafNode is a leaf node whose keys and values can be of any length(see slotted node structure).
+type SlottedLeafNode struct {
+	PersistentPage
+	pager         Pager
+	keySerializer KeySerializer
+	valSerializer ValueSerializer
+}
+
+func (p *SlottedLeafNode) cells() slottedCells {
+	return slottedCells{data: p.GetData(), begin: PersistentNodeHeaderSize + slottedHeaderSize}
+}
+
+func (p *SlottedLeafNode) newCell(key Key, val interface{}) []byte {
+	keyBytes, err := p.keySerializer.Serialize(key)
+	CheckErr(err)
+	valBytes, err := p.valSerializer.Serialize(val)
+	CheckErr(err)
+
+	if len(valBytes) > overflowThreshold(len(p.GetData()), len(keyBytes)) {
+		return p.buildCell(keyBytes, newOverflowRef(p.pager, valBytes), true)
+	}
+	return p.buildCell(keyBytes, valBytes, false)
+}
+
+func (p *SlottedLeafNode) buildCell(keyBytes []byte, valBytes []byte, isOverflow bool) []byte {
+	keyLen := uint16(len(keyBytes))
+	if isOverflow {
+		keyLen |= overflowFlag
+	}
+
+	cell := make([]byte, cellKeyLenSize, cellKeyLenSize+len(keyBytes)+len(valBytes))
+	binary.BigEndian.PutUint16(cell, keyLen)
+	cell = append(cell, keyBytes...)
+	return append(cell, valBytes...)
+}
+
+// splitCell returns key and value of the cell. If the value is stored in overflow pages val is its reference.
+func (p *SlottedLeafNode) splitCell(cell []byte) (key []byte, val []byte, isOverflow bool) {
+	keyLen := binary.BigEndian.Uint16(cell)
+	isOverflow = keyLen&overflowFlag != 0
+	keyLen &^= overflowFlag
+	return cell[cellKeyLenSize : cellKeyLenSize+int(keyLen)], cell[cellKeyLenSize+int(keyLen):], isOverflow
+}
+
+// freeOverflowAt frees the overflow pages of the value at idx if it has any.
+func (p *SlottedLeafNode) freeOverflowAt(idx int) {
+	if _, ref, isOverflow := p.splitCell(p.cells().cellAt(idx)); isOverflow {
+		_, first := readOverflowRef(ref)
+		freeOverflowChain(p.pager, first)
+	}
+}
+
+func (p *SlottedLeafNode) findKey(key Key) (index int, found bool) {
+	return slottedFindKey(p, p.Keylen(), key)
+}
+
+func (p *SlottedLeafNode) shiftKeyValueToRightAt(n int) {
+	panic("slotted nodes do not shift keys, cells are inserted with InsertAt")
+}
+
+func (p *SlottedLeafNode) shiftKeyValueToLeftAt(n int) {
+	panic("slotted nodes do not shift keys, cells are deleted with DeleteAt")
+}
+
+func (p *SlottedLeafNode) setKeyAt(idx int, key Key) {
+	keyBytes, err := p.keySerializer.Serialize(key)
+	CheckErr(err)
+
+	// value is kept as it is, so that its overflow pages are not copied
+	_, valBytes, isOverflow := p.splitCell(p.cells().cellAt(idx))
+	p.cells().replaceCell(idx, p.buildCell(keyBytes, valBytes, isOverflow))
+}
+
+func (p *SlottedLeafNode) setValueAt(idx int, val interface{}) {
+	// old overflow pages are freed first, so that they can be reused by the new value
+	p.freeOverflowAt(idx)
+	p.cells().replaceCell(idx, p.newCell(p.GetKeyAt(idx), val))
+}
+
+func (p *SlottedLeafNode) GetKeyAt(idx int) Key {
+	keyBytes, _, _ := p.splitCell(p.cells().cellAt(idx))
+	key, err := p.keySerializer.Deserialize(keyBytes)
+	CheckErr(err)
+
+	return key
+}
+
+func (p *SlottedLeafNode) GetValueAt(idx int) interface{} {
+	_, valBytes, isOverflow := p.splitCell(p.cells().cellAt(idx))
+	if isOverflow {
+		n, first := readOverflowRef(valBytes)
+		valBytes = readOverflowChain(p.pager, first, n)
+	}
+	val, err := p.valSerializer.Deserialize(valBytes)
+	CheckErr(err)
+
+	return val
+}
+
+func (p *SlottedLeafNode) getCountAt(idx int) int {
+	panic("leaf nodes do not have children")
+}
+
+func (p *SlottedLeafNode) setCountAt(idx int, count int) {
+	panic("leaf nodes do not have children")
+}
+
+func (p *SlottedLeafNode) GetValues() []interface{} {
+	res := make([]interface{}, 0)
+	for i := 0; i < p.Keylen(); i++ {
+		res = append(res, p.GetValueAt(i))
+	}
+	return res
+}
+
+func (p *SlottedLeafNode) SplitNode(idx int) (right Pointer, keyAtLeft Key, keyAtRight Key) {
+	pager := p.pager
+	keyAtLeft = p.GetKeyAt(idx - 1)
+	keyAtRight = p.GetKeyAt(idx)
+
+	rightNode := pager.NewLeafNode().(*SlottedLeafNode)
+	defer pager.Unpin(rightNode, true)
+	rightNode.cells().moveCells(p.cells(), idx, p.Keylen())
+	linkSplit(pager, p, rightNode, keyAtRight)
+
+	return rightNode.GetPageId(), keyAtLeft, keyAtRight
+}
+
+func (p *SlottedLeafNode) splitIndex(degree int) int {
+	return p.cells().splitIndex(1)
+}
+
+func (p *SlottedLeafNode) PrintNode() {
+	fmt.Printf("Node( ")
+	for i := 0; i < p.Keylen(); i++ {
+		fmt.Printf("%v | ", p.GetKeyAt(i))
+	}
+	fmt.Printf(")    ")
+}
+
+func (p *SlottedLeafNode) IsOverFlow(degree int) bool {
+	return p.cells().isOverFlow()
+}
+
+func (p *SlottedLeafNode) InsertAt(index int, key Key, val interface{}) {
+	p.cells().insertCell(index, p.newCell(key, val))
+}
+
+func (p *SlottedLeafNode) IsLeaf() bool {
+	return true
+}
+
+func (p *SlottedLeafNode) DeleteAt(index int) {
+	p.freeOverflowAt(index)
+	p.cells().deleteCell(index)
+}
+
+func (p *SlottedLeafNode) Keylen() int {
+	return p.cells().count()
+}
+
+func (p *SlottedLeafNode) GetRight() Pointer {
+	return p.GetHeader().Right
+}
+
+func (p *SlottedLeafNode) GetHighKey() Key {
+	return slottedHighKey(p, p.cells(), p.keySerializer)
+}
+
+func (p *SlottedLeafNode) setHighKey(key Key) {
+	setSlottedHighKey(p.cells(), p.keySerializer, key)
+}
+
+func (p *SlottedLeafNode) MergeNodes(rightNode Node, parent Node) {
+	if parent.IsLeaf() {
+		panic("parent node cannot be leaf")
+	}
+	i := indexInParent(p, parent)
+
+	right := rightNode.(*SlottedLeafNode)
+	p.cells().moveCells(right.cells(), 0, right.Keylen())
+
+	// rightNode is not used anymore, it is freed by the caller once it is unpinned
+	mergeCounts(parent, i)
+	parent.DeleteAt(i)
+	linkMerge(p.pager, p, right)
+}
+
+func (p *SlottedLeafNode) Redistribute(rightNode Node, parent Node) {
+	i := indexInParent(p, parent)
+
+	left, right := p.cells(), rightNode.(*SlottedLeafNode).cells()
+	for right.count() > 1 && right.entrySize(0) < right.used()-left.used() {
+		left.moveCells(right, 0, 1)
+	}
+	for left.count() > 1 && left.entrySize(left.count()-1) < left.used()-right.used() {
+		right.insertCell(0, append([]byte{}, left.cellAt(left.count()-1)...))
+		left.deleteCell(left.count() - 1)
+	}
+
+	parent.setKeyAt(i, rightNode.GetKeyAt(0))
+	p.setHighKey(rightNode.GetKeyAt(0))
+	redistributeCounts(p, rightNode, parent, i)
+}
+
+func (p *SlottedLeafNode) canMerge(rightNode Node, degree int) bool {
+	return p.cells().canMerge(rightNode.(*SlottedLeafNode).cells(), 0)
+}
+
+func (p *SlottedLeafNode) CanLend(degree int) bool {
+	return p.cells().canLend()
+}
+
+func (p *SlottedLeafNode) IsUnderFlow(degree int) bool {
+	return p.cells().isUnderFlow()
+}
+
+func (p *SlottedLeafNode) GetHeader() *PersistentNodeHeader {
+	return ReadPersistentNodeHeader(p.GetData())
+}
+
+func (p *SlottedLeafNode) SetHeader(h *PersistentNodeHeader) {
+	WritePersistentNodeHeader(h, p.GetData())
+}
+
+func (p *SlottedLeafNode) IsSafeForSplit(degree int) bool {
+	return p.cells().isSafeForSplit()
+}
+
+func (p *SlottedLeafNode) IsSafeForMerge(degree int) bool {
+	return p.cells().isSafeForMerge()
+}
+
+// SlottedInternalNode is an internal node whose keys can be of any length(see slotted node structure).
+type SlottedInternalNode struct {
+	PersistentPage
+	pager         Pager
+	keySerializer KeySerializer
+}
+
+func (p *SlottedInternalNode) cells() slottedCells {
+	return slottedCells{data: p.GetData(), begin: PersistentNodeHeaderSize + slottedHeaderSize + InternalChildSize}
+}
+
+// newCell returns a cell of the key and the child pointer with the given subtree count.
+func (p *SlottedInternalNode) newCell(key Key, val interface{}, count int) []byte {
+	keyBytes, err := p.keySerializer.Serialize(key)
+	CheckErr(err)
+
+	cell := make([]byte, InternalChildSize, InternalChildSize+len(keyBytes))
+	binary.BigEndian.PutUint64(cell, uint64(val.(Pointer)))
+	binary.BigEndian.PutUint64(cell[NodePointerSize:], uint64(count))
+	return append(cell, keyBytes...)
+}
+
+func (p *SlottedInternalNode) findKey(key Key) (index int, found bool) {
+	return slottedFindKey(p, p.Keylen(), key)
+}
+
+func (p *SlottedInternalNode) shiftKeyValueToRightAt(n int) {
+	panic("slotted nodes do not shift keys, cells are inserted with InsertAt")
+}
+
+func (p *SlottedInternalNode) shiftKeyValueToLeftAt(n int) {
+	panic("slotted nodes do not shift keys, cells are deleted with DeleteAt")
+}
+
+func (p *SlottedInternalNode) setKeyAt(idx int, key Key) {
+	p.cells().replaceCell(idx, p.newCell(key, p.GetValueAt(idx+1), p.getCountAt(idx+1)))
+}
+
+func (p *SlottedInternalNode) setValueAt(idx int, val interface{}) {
+	if idx == 0 {
+		// first pointer is located right after slotted header
+		binary.BigEndian.PutUint64(p.GetData()[PersistentNodeHeaderSize+slottedHeaderSize:], uint64(val.(Pointer)))
+		return
+	}
+	binary.BigEndian.PutUint64(p.cells().cellAt(idx-1), uint64(val.(Pointer)))
+}
+
+func (p *SlottedInternalNode) GetKeyAt(idx int) Key {
+	key, err := p.keySerializer.Deserialize(p.cells().cellAt(idx)[InternalChildSize:])
+	CheckErr(err)
+
+	return key
+}
+
+func (p *SlottedInternalNode) GetValueAt(idx int) interface{} {
+	if idx == 0 {
+		return Pointer(binary.BigEndian.Uint64(p.GetData()[PersistentNodeHeaderSize+slottedHeaderSize:]))
+	}
+	return Pointer(binary.BigEndian.Uint64(p.cells().cellAt(idx - 1)))
+}
+
+// countAt returns the bytes of the subtree count of the child at the given index.
+func (p *SlottedInternalNode) countAt(idx int) []byte {
+	if idx == 0 {
+		// count of the first pointer is located right after it
+		return p.GetData()[PersistentNodeHeaderSize+slottedHeaderSize+NodePointerSize:]
+	}
+	return p.cells().cellAt(idx - 1)[NodePointerSize:]
+}
+
+func (p *SlottedInternalNode) getCountAt(idx int) int {
+	return int(binary.BigEndian.Uint64(p.countAt(idx)))
+}
+
+func (p *SlottedInternalNode) setCountAt(idx int, count int) {
+	binary.BigEndian.PutUint64(p.countAt(idx), uint64(count))
+}
+
+func (p *SlottedInternalNode) GetValues() []interface{} {
+	res := make([]interface{}, 0)
+	for i := 0; i < p.Keylen()+1; i++ {
+		res = append(res, p.GetValueAt(i))
+	}
+	return res
+}
+
+func (p *SlottedInternalNode) SplitNode(idx int) (right Pointer, keyAtLeft Key, keyAtRight Key) {
+	pager := p.pager
+	// keyAtRight is pushed up to parent, it is in neither of the nodes after split
+	keyAtLeft = p.GetKeyAt(idx - 1)
+	keyAtRight = p.GetKeyAt(idx)
+
+	rightNode := pager.NewInternalNode(p.GetValueAt(idx + 1).(Pointer)).(*SlottedInternalNode)
+	defer pager.Unpin(rightNode, true)
+	rightNode.setCountAt(0, p.getCountAt(idx+1))
+	rightNode.cells().moveCells(p.cells(), idx+1, p.Keylen())
+	p.cells().deleteCell(idx)
+	linkSplit(pager, p, rightNode, keyAtRight)
+
+	return rightNode.GetPageId(), keyAtLeft, keyAtRight
+}
+
+func (p *SlottedInternalNode) splitIndex(degree int) int {
+	// key at split index is pushed up, so right node needs at least one more key
+	return p.cells().splitIndex(2)
+}
+
+func (p *SlottedInternalNode) PrintNode() {
+	fmt.Printf("Node( ")
+	for i := 0; i < p.Keylen(); i++ {
+		fmt.Printf("%v | ", p.GetKeyAt(i))
+	}
+	fmt.Printf(")    ")
+}
+
+func (p *SlottedInternalNode) IsOverFlow(degree int) bool {
+	return p.cells().isOverFlow()
+}
+
+func (p *SlottedInternalNode) InsertAt(index int, key Key, val interface{}) {
+	p.cells().insertCell(index, p.newCell(key, val, 0))
+}
+
+func (p *SlottedInternalNode) IsLeaf() bool {
+	return false
+}
+
+func (p *SlottedInternalNode) DeleteAt(index int) {
+	p.cells().deleteCell(index)
+}
+
+func (p *SlottedInternalNode) Keylen() int {
+	return p.cells().count()
+}
+
+func (p *SlottedInternalNode) GetRight() Pointer {
+	return p.GetHeader().Right
+}
+
+func (p *SlottedInternalNode) GetHighKey() Key {
+	return slottedHighKey(p, p.cells(), p.keySerializer)
+}
+
+func (p *SlottedInternalNode) setHighKey(key Key) {
+	setSlottedHighKey(p.cells(), p.keySerializer, key)
+}
+
+func (p *SlottedInternalNode) MergeNodes(rightNode Node, parent Node) {
+	i := indexInParent(p, parent)
+
+	// separating key in parent is pushed down in front of the first pointer of right node
+	right := rightNode.(*SlottedInternalNode)
+	p.InsertAt(p.Keylen(), parent.GetKeyAt(i), right.GetValueAt(0))
+	p.setCountAt(p.Keylen(), right.getCountAt(0))
+	p.cells().moveCells(right.cells(), 0, right.Keylen())
+	mergeCounts(parent, i)
+	parent.DeleteAt(i)
+	linkMerge(p.pager, p, right)
+}
+
+func (p *SlottedInternalNode) Redistribute(rightNode Node, parent Node) {
+	i := indexInParent(p, parent)
+
+	// keys are rotated through the separating key in parent, which is kept in separator until the rotation ends so
+	// that parent is modified only once
+	right := rightNode.(*SlottedInternalNode)
+	left, rightCells := p.cells(), right.cells()
+	separator := parent.GetKeyAt(i)
+	for rightCells.count() > 1 && rightCells.entrySize(0) < rightCells.used()-left.used() {
+		p.InsertAt(p.Keylen(), separator, right.GetValueAt(0))
+		p.setCountAt(p.Keylen(), right.getCountAt(0))
+		separator = right.GetKeyAt(0)
+		right.setValueAt(0, right.GetValueAt(1))
+		right.setCountAt(0, right.getCountAt(1))
+		right.DeleteAt(0)
+	}
+	for left.count() > 1 && left.entrySize(left.count()-1) < left.used()-rightCells.used() {
+		right.InsertAt(0, separator, right.GetValueAt(0))
+		right.setCountAt(1, right.getCountAt(0))
+		right.setValueAt(0, p.GetValueAt(p.Keylen()))
+		right.setCountAt(0, p.getCountAt(p.Keylen()))
+		separator = p.GetKeyAt(p.Keylen() - 1)
+		p.DeleteAt(p.Keylen() - 1)
+	}
+
+	parent.setKeyAt(i, separator)
+	p.setHighKey(separator)
+	redistributeCounts(p, rightNode, parent, i)
+}
+
+func (p *SlottedInternalNode) canMerge(rightNode Node, degree int) bool {
+	// separator is pulled down with the first pointer of rightNode, whose cell is not larger than an entry
+	return p.cells().canMerge(rightNode.(*SlottedInternalNode).cells(), maxEntrySize(len(p.GetData())))
+}
+
+func (p *SlottedInternalNode) CanLend(degree int) bool {
+	return p.cells().canLend()
+}
+
+func (p *SlottedInternalNode) IsUnderFlow(degree int) bool {
+	return p.cells().isUnderFlow()
+}
+
+func (p *SlottedInternalNode) GetHeader() *PersistentNodeHeader {
+	return ReadPersistentNodeHeader(p.GetData())
+}
+
+func (p *SlottedInternalNode) SetHeader(h *PersistentNodeHeader) {
+	WritePersistentNodeHeader(h, p.GetData())
+}
+
+func (p *SlottedInternalNode) IsSafeForSplit(degree int) bool {
+	return p.cells().isSafeForSplit()
+}
+
+func (p *SlottedInternalNode) IsSafeForMerge(degree int) bool {
+	return p.cells().isSafeForMerge()
+}
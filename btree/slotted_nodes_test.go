@@ -0,0 +1,246 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// urlKeys returns n distinct keys whose lengths vary between a few bytes and a few hundred bytes.
+func urlKeys(n int) []string {
+	r := rand.New(rand.NewSource(42))
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("https://example.com/%v/%v", strings.Repeat("p", r.Intn(300)), i)
+		if r.Intn(3) == 0 {
+			keys[i] = fmt.Sprintf("u%v", i)
+		}
+	}
+	return keys
+}
+
+func TestSlotted_Variable_Length_Keys_Should_Be_Inserted_Found_And_Deleted(t *testing.T) {
+	pager := NewInMemoryPager(&VarStringKeySerializer{}, &StringValueSerializer{Len: 20})
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	keys := urlKeys(5000)
+	for i, idx := range rand.Perm(len(keys)) {
+		tree.Insert(StringKey(keys[idx]), fmt.Sprintf("value_%v", idx))
+		if i%1000 == 0 {
+			assert.Contains(t, tree.Find(StringKey(keys[idx])), fmt.Sprintf("value_%v", idx))
+		}
+	}
+	assert.Greater(t, tree.Height(), 2)
+	for i, key := range keys {
+		assert.Contains(t, tree.Find(StringKey(key)), fmt.Sprintf("value_%v", i))
+	}
+
+	sorted := rand.Perm(len(keys))
+	sort.Slice(sorted, func(i, j int) bool { return keys[sorted[i]] < keys[sorted[j]] })
+	it := NewTreeIterator(tree, pager)
+	for _, idx := range sorted {
+		assert.Contains(t, it.Next(), fmt.Sprintf("value_%v", idx))
+	}
+	assert.Nil(t, it.Next())
+
+	perm := rand.Perm(len(keys))
+	for i, idx := range perm {
+		assert.True(t, tree.Delete(StringKey(keys[idx])))
+		assert.Empty(t, tree.Find(StringKey(keys[idx])))
+		if i%500 == 0 {
+			for _, other := range perm[i+1:] {
+				assert.Contains(t, tree.Find(StringKey(keys[other])), fmt.Sprintf("value_%v", other))
+			}
+		}
+	}
+	assert.Equal(t, 1, pager.PageCount())
+}
+
+func TestSlotted_Tree_Should_Be_Reopened_From_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &VarStringKeySerializer{}, &StringValueSerializer{Len: 20})
+	assert.NoError(t, err)
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	keys := urlKeys(3000)
+	for _, idx := range rand.Perm(len(keys)) {
+		tree.InsertOrReplace(StringKey(keys[idx]), fmt.Sprintf("value_%v", idx))
+	}
+	for _, key := range keys[:1000] {
+		assert.True(t, tree.Delete(StringKey(key)))
+	}
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePager(path, &VarStringKeySerializer{}, &StringValueSerializer{Len: 20})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	for i, key := range keys {
+		if i < 1000 {
+			assert.Empty(t, tree.Find(StringKey(key)))
+		} else {
+			assert.Contains(t, tree.Find(StringKey(key)), fmt.Sprintf("value_%v", i))
+		}
+	}
+}
+
+func TestSlotted_Entry_Larger_Than_Max_Entry_Size_Should_Be_Rejected(t *testing.T) {
+	pager := NewInMemoryPager(&VarStringKeySerializer{}, &StringValueSerializer{Len: 20})
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	assert.NotPanics(t, func() { tree.Insert(StringKey(strings.Repeat("k", 400)), "value") })
+	defer func() {
+		err, ok := recover().(error)
+		assert.True(t, ok)
+		assert.ErrorIs(t, err, ErrEntryTooLarge)
+		assert.Contains(t, tree.Find(StringKey(strings.Repeat("k", 400))), "value")
+	}()
+	tree.Insert(StringKey(strings.Repeat("k", 1000)), "value")
+	t.Fatal("inserting a too large entry should panic")
+}
+
+func TestSlotted_Nodes_Should_Use_Less_Pages_Than_Fixed_Size_Nodes_For_Short_Keys(t *testing.T) {
+	keys := urlKeys(3000)
+	maxLen := 0
+	for _, key := range keys {
+		if len(key) > maxLen {
+			maxLen = len(key)
+		}
+	}
+
+	slotted := NewInMemoryPager(&VarStringKeySerializer{}, &StringValueSerializer{Len: 20})
+	fixed, err := NewInMemoryPagerWithPageSize(&StringKeySerializer{Len: maxLen}, &StringValueSerializer{Len: 20}, 16<<10)
+	assert.NoError(t, err)
+	for _, pager := range []*InMemoryPager{slotted, fixed} {
+		tree, err := NewBtreeWithMaxDegree(pager)
+		assert.NoError(t, err)
+		for _, idx := range rand.Perm(len(keys)) {
+			key := keys[idx]
+			if pager == fixed {
+				key += strings.Repeat(" ", maxLen-len(key))
+			}
+			tree.Insert(StringKey(key), "value")
+		}
+	}
+
+	// fixed size nodes need bigger pages to fit enough keys of maximum length, and they use that space for every key
+	assert.Less(t, slotted.PageCount()*slotted.GetPageSize(), fixed.PageCount()*fixed.GetPageSize())
+}
+
+func TestSlotted_Cells_Should_Be_Compacted_When_Heap_Is_Fragmented(t *testing.T) {
+	pager := NewInMemoryPager(&VarStringKeySerializer{}, &StringValueSerializer{Len: 20})
+	node := pager.NewLeafNode().(*SlottedLeafNode)
+	key := func(i int) StringKey { return StringKey(fmt.Sprintf("%03d%v", i, strings.Repeat("k", 100))) }
+
+	for i := 0; i < 26; i++ {
+		node.InsertAt(i, key(i+100), "value")
+	}
+	for i := 0; i < 10; i++ {
+		node.DeleteAt(0)
+	}
+	assert.NotZero(t, readSlottedHeader(node.GetData()).Fragmented)
+
+	// new cells do not fit between slots and the heap unless deleted cells are reclaimed
+	for i := 0; i < 8; i++ {
+		node.InsertAt(i, key(i), "value")
+	}
+	assert.Zero(t, readSlottedHeader(node.GetData()).Fragmented)
+	assert.Equal(t, 24, node.Keylen())
+	assert.False(t, node.IsOverFlow(0))
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, key(i), node.GetKeyAt(i))
+		assert.Contains(t, node.GetValueAt(i), "value")
+	}
+	for i := 8; i < 24; i++ {
+		assert.Equal(t, key(i+102), node.GetKeyAt(i))
+		assert.Contains(t, node.GetValueAt(i), "value")
+	}
+}
+
+func TestSlotted_Variable_Length_Values_Should_Be_Replaced_With_Longer_Values(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, &PersistentKeySerializer{}, &VarStringValueSerializer{})
+	assert.NoError(t, err)
+	tree, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+
+	value := func(i, n int) string { return fmt.Sprintf("%v_%v", i, strings.Repeat("v", n)) }
+	n := 4000
+	for _, i := range rand.Perm(n) {
+		tree.Insert(PersistentKey(i), value(i, i%50))
+	}
+	height := tree.Height()
+	for _, i := range rand.Perm(n) {
+		assert.False(t, tree.InsertOrReplace(PersistentKey(i), value(i, 115)))
+	}
+	assert.Greater(t, tree.Height(), height)
+	assert.NoError(t, pager.Close())
+
+	pager, err = NewFilePager(path, &PersistentKeySerializer{}, &VarStringValueSerializer{})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	for i := 0; i < n; i++ {
+		assert.Equal(t, value(i, 115), tree.Find(PersistentKey(i)))
+	}
+	for _, i := range rand.Perm(n) {
+		assert.True(t, tree.Delete(PersistentKey(i)))
+	}
+	assert.Empty(t, tree.Find(PersistentKey(0)))
+}
+
+func TestSlotted_Value_Longer_Than_Serializer_Len_Should_Be_Rejected(t *testing.T) {
+	tree := NewBtreeWithPager(10, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 5}))
+	tree.Insert(PersistentKey(1), "12345")
+
+	defer func() {
+		err, ok := recover().(error)
+		assert.True(t, ok)
+		assert.ErrorIs(t, err, ErrValueTooLarge)
+		assert.Equal(t, "12345", tree.Find(PersistentKey(1)))
+		assert.Empty(t, tree.Find(PersistentKey(2)))
+	}()
+	tree.Insert(PersistentKey(2), "123456")
+	t.Fatal("inserting a too large value should panic")
+}
+
+func TestSlotted_High_Key_Should_Be_Kept_When_Heap_Is_Compacted(t *testing.T) {
+	pager := NewInMemoryPager(&VarStringKeySerializer{}, &StringValueSerializer{Len: 20})
+	node := pager.NewLeafNode().(*SlottedLeafNode)
+	key := func(i int) StringKey { return StringKey(fmt.Sprintf("%03d%v", i, strings.Repeat("k", 100))) }
+
+	// high key is kept only while the node has a node on its right
+	node.setHighKey(key(999))
+	assert.Nil(t, node.GetHighKey())
+	h := node.GetHeader()
+	h.Right = 100
+	node.SetHeader(h)
+	assert.Equal(t, key(999), node.GetHighKey())
+
+	for i := 0; i < 25; i++ {
+		node.InsertAt(i, key(i+100), "value")
+	}
+	for i := 0; i < 10; i++ {
+		node.DeleteAt(0)
+	}
+	for i := 0; i < 8; i++ {
+		node.InsertAt(i, key(i), "value")
+	}
+	assert.Zero(t, readSlottedHeader(node.GetData()).Fragmented)
+	assert.Equal(t, key(999), node.GetHighKey())
+
+	node.setHighKey(StringKey("shorter"))
+	assert.Equal(t, StringKey("shorter"), node.GetHighKey())
+	node.setHighKey(nil)
+	assert.Zero(t, readSlottedHeader(node.GetData()).HighKey.Len)
+}
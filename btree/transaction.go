@@ -0,0 +1,208 @@
+package btree
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrTxActive = errors.New("operation is not allowed while a transaction is active")
+
+// TxPager is implemented by pagers which can apply a group of page changes atomically. BTree starts a transaction
+// for every operation that modifies it when its pager is a TxPager, so that the operation is either completely applied
+// or not applied at all even if it panics in the middle or the process crashes.
+type TxPager interface {
+	Pager
+
+	// BeginTx starts a transaction. If a transaction is already started, it is joined and the transaction is committed
+	// only when the outermost CommitTx is called.
+	BeginTx()
+
+	// CommitTx commits the transaction. If the transaction cannot be committed it is aborted before CommitTx panics.
+	CommitTx()
+
+	// AbortTx reverts every change made to the pages since the outermost BeginTx. It is a noop if there is no active
+	// transaction.
+	AbortTx()
+}
+
+// boundedTxPager is implemented by TxPagers which keep the pages used by a transaction in memory until it is committed,
+// hence a transaction can use a limited number of pages.
+type boundedTxPager interface {
+	TxPager
+
+	// txPages returns the number of pages used by the active transaction and the number of pages a transaction can
+	// use at most.
+	txPages() (used int, limit int)
+}
+
+// pageUndo is what is needed to revert a page to its state before a transaction.
+type pageUndo struct {
+	data     []byte // nil when page is allocated in the transaction
+	pinCount int
+	isDirty  bool
+	modified bool
+}
+
+type filePagerTx struct {
+	id       uint64
+	depth    int
+	pages    map[Pointer]*pageUndo
+	numPages Pointer
+}
+
+func (f *FilePager) BeginTx() {
+	if f.tx != nil {
+		f.tx.depth++
+		return
+	}
+
+	f.lastTxId++
+	f.tx = &filePagerTx{
+		id:       f.lastTxId,
+		depth:    1,
+		pages:    make(map[Pointer]*pageUndo),
+		numPages: f.disk.numPages,
+	}
+}
+
+func (f *FilePager) CommitTx() {
+	if f.tx == nil {
+		panic("there is no transaction to commit")
+	}
+	f.tx.depth--
+	if f.tx.depth > 0 {
+		return
+	}
+
+	if f.wal != nil {
+		if err := f.logTx(); err != nil {
+			f.AbortTx()
+			panic(err)
+		}
+	}
+
+	for pageId := range f.tx.pages {
+		if fr, ok := f.pool.pageTable[pageId]; ok {
+			fr.uncommitted = false
+		}
+	}
+	f.tx = nil
+
+	if f.wal != nil && f.wal.size >= f.checkpointSize {
+		CheckErr(f.checkpoint())
+	}
+}
+
+// logTx writes after image of every page modified by the transaction to write-ahead log and syncs it.
+func (f *FilePager) logTx() error {
+	pageIds := make([]Pointer, 0, len(f.tx.pages))
+	for pageId, undo := range f.tx.pages {
+		if undo.modified {
+			pageIds = append(pageIds, pageId)
+		}
+	}
+	if len(pageIds) == 0 {
+		return nil
+	}
+	sort.Slice(pageIds, func(i, j int) bool { return pageIds[i] < pageIds[j] })
+
+	for _, pageId := range pageIds {
+		f.wal.appendPage(f.tx.id, pageId, f.pool.pageTable[pageId].page.GetData())
+	}
+	f.wal.appendCommit(f.tx.id)
+	if err := f.wal.flush(); err != nil {
+		f.wal.discard()
+		return err
+	}
+	return nil
+}
+
+func (f *FilePager) txPages() (used int, limit int) {
+	if f.tx != nil {
+		used = len(f.tx.pages)
+	}
+	return used, len(f.pool.frames)
+}
+
+func (f *FilePager) AbortTx() {
+	if f.tx == nil {
+		return
+	}
+
+	for pageId, undo := range f.tx.pages {
+		if undo.data == nil {
+			f.pool.drop(pageId)
+			continue
+		}
+
+		fr, ok := f.pool.pageTable[pageId]
+		if !ok {
+			// page is evicted, since it could only be evicted when it was clean it is not modified
+			continue
+		}
+		copy(fr.page.GetData(), undo.data)
+		fr.node = nil
+		fr.pinCount = undo.pinCount
+		fr.isDirty = undo.isDirty
+		fr.uncommitted = false
+	}
+	f.disk.numPages = f.tx.numPages
+	f.tx = nil
+}
+
+// fetch pins the page in the pool. If there is an active transaction, state of the page is saved before it is used
+// by the transaction for the first time, so that it can be reverted if the transaction aborts.
+func (f *FilePager) fetch(pageId Pointer) *frame {
+	fr, err := f.pool.fetch(pageId)
+	CheckErr(err)
+
+	if f.tx != nil {
+		if _, ok := f.tx.pages[pageId]; !ok {
+			data := make([]byte, len(fr.page.GetData()))
+			copy(data, fr.page.GetData())
+			f.tx.pages[pageId] = &pageUndo{data: data, pinCount: fr.pinCount - 1, isDirty: fr.isDirty}
+		}
+		fr.uncommitted = true
+	}
+	return fr
+}
+
+// newPage allocates a new page at the end of the file and pins it in the pool.
+func (f *FilePager) newPage() *frame {
+	fr, err := f.pool.newPage()
+	CheckErr(err)
+
+	if f.tx != nil {
+		f.tx.pages[fr.page.GetPageId()] = &pageUndo{modified: true}
+		fr.uncommitted = true
+	}
+	return fr
+}
+
+// unpin unpins the page in the pool and remembers it if it is modified by the active transaction.
+func (f *FilePager) unpin(pageId Pointer, isDirty bool) {
+	CheckErr(f.pool.unpin(pageId, isDirty))
+
+	if f.tx != nil && isDirty {
+		if undo, ok := f.tx.pages[pageId]; ok {
+			undo.modified = true
+		}
+	}
+}
+
+// checkpoint writes every dirty page to the database file, syncs it and truncates the write-ahead log.
+func (f *FilePager) checkpoint() error {
+	if f.tx != nil {
+		return ErrTxActive
+	}
+	if err := f.pool.flushAll(); err != nil {
+		return err
+	}
+	if err := f.disk.sync(); err != nil {
+		return err
+	}
+	if f.wal != nil {
+		return f.wal.truncate()
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package btree
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+  Typed tree:
+
+  Tree[K, V] is a thin layer over BTree whose methods take and return keys of type K and values of type V, so that a
+  key or a value of a wrong type is a compile error instead of a failed type assertion in Key.Less or a serializer.
+  Keys and values are encoded by a KeyCodec and a ValueCodec. The pager of the tree stores them with the serializers
+  returned by NewKeySerializer and NewValueSerializer, which wrap the codecs, and keys are compared with
+  KeyCodec.Compare. Everything else, such as transactions, node formats and the metadata page, is the same as BTree.
+*/
+
+// KeyCodec encodes keys of type K and orders them.
+type KeyCodec[K any] interface {
+	Encode(key K) ([]byte, error)
+	Decode(data []byte) (K, error)
+
+	// Size returns the byte length of an encoded key. It is VarSize if encoded keys can have different lengths.
+	Size() int
+
+	// Compare returns a negative number if a is less than b, zero if they are equal and a positive number otherwise.
+	Compare(a, b K) int
+}
+
+// ValueCodec encodes values of type V.
+type ValueCodec[V any] interface {
+	Encode(value V) ([]byte, error)
+	Decode(data []byte) (V, error)
+
+	// Size returns the byte length of an encoded value. It is VarSize if encoded values can have different lengths.
+	Size() int
+}
+
+var ErrCodecSize = errors.New("encoded length is different than the size of the codec")
+
+// Int64Codec encodes int64 keys and values to 8 bytes.
+type Int64Codec struct{}
+
+func (Int64Codec) Encode(v int64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(v)), nil
+}
+
+func (Int64Codec) Decode(data []byte) (int64, error) {
+	return int64(binary.BigEndian.Uint64(data)), nil
+}
+
+func (Int64Codec) Size() int {
+	return 8
+}
+
+func (Int64Codec) Compare(a, b int64) int {
+	return cmp.Compare(a, b)
+}
+
+// StringCodec encodes string keys and values to their bytes without any padding, nodes of a pager which uses it are
+// slotted(see SlottedLeafNode).
+type StringCodec struct{}
+
+func (StringCodec) Encode(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+func (StringCodec) Size() int {
+	return VarSize
+}
+
+func (StringCodec) Compare(a, b string) int {
+	return cmp.Compare(a, b)
+}
+
+// typedKey is the Key of a Tree, it is only compared with keys of the same tree.
+type typedKey[K any] struct {
+	key   K
+	codec KeyCodec[K]
+}
+
+func (k typedKey[K]) Less(than Key) bool {
+	return k.codec.Compare(k.key, than.(typedKey[K]).key) < 0
+}
+
+func (k typedKey[K]) String() string {
+	return fmt.Sprint(k.key)
+}
+
+// codecSize checks that an encoded key or value has the size of its codec.
+func codecSize(codec interface{ Size() int }, data []byte) error {
+	if codec.Size() != VarSize && len(data) != codec.Size() {
+		return fmt.Errorf("%w: %T encoded %v bytes, its size is %v", ErrCodecSize, codec, len(data), codec.Size())
+	}
+	return nil
+}
+
+// codecTrim returns the bytes of an encoded key or value. Pages pass the bytes after a fixed size key or value as well.
+func codecTrim(codec interface{ Size() int }, data []byte) []byte {
+	if codec.Size() != VarSize {
+		return data[:codec.Size()]
+	}
+	return data
+}
+
+type keyCodecSerializer[K any] struct {
+	codec KeyCodec[K]
+}
+
+// NewKeySerializer returns a KeySerializer which encodes the keys of a Tree with the codec.
+func NewKeySerializer[K any](codec KeyCodec[K]) KeySerializer {
+	return &keyCodecSerializer[K]{codec: codec}
+}
+
+func (s *keyCodecSerializer[K]) Serialize(key Key) ([]byte, error) {
+	data, err := s.codec.Encode(key.(typedKey[K]).key)
+	if err != nil {
+		return nil, err
+	}
+	return data, codecSize(s.codec, data)
+}
+
+func (s *keyCodecSerializer[K]) Deserialize(data []byte) (Key, error) {
+	key, err := s.codec.Decode(codecTrim(s.codec, data))
+	if err != nil {
+		return nil, err
+	}
+	return typedKey[K]{key: key, codec: s.codec}, nil
+}
+
+func (s *keyCodecSerializer[K]) Size() int {
+	return s.codec.Size()
+}
+
+// id identifies the serializer by its codec in the metadata page, its own type name is too long for it.
+func (s *keyCodecSerializer[K]) id() string {
+	return fmt.Sprintf("%T/%v", s.codec, s.codec.Size())
+}
+
+type valueCodecSerializer[V any] struct {
+	codec ValueCodec[V]
+}
+
+// NewValueSerializer returns a ValueSerializer which encodes the values of a Tree with the codec.
+func NewValueSerializer[V any](codec ValueCodec[V]) ValueSerializer {
+	return &valueCodecSerializer[V]{codec: codec}
+}
+
+func (s *valueCodecSerializer[V]) Serialize(val interface{}) ([]byte, error) {
+	data, err := s.codec.Encode(val.(V))
+	if err != nil {
+		return nil, err
+	}
+	return data, codecSize(s.codec, data)
+}
+
+func (s *valueCodecSerializer[V]) Deserialize(data []byte) (interface{}, error) {
+	return s.codec.Decode(codecTrim(s.codec, data))
+}
+
+func (s *valueCodecSerializer[V]) Size() int {
+	return s.codec.Size()
+}
+
+func (s *valueCodecSerializer[V]) id() string {
+	return fmt.Sprintf("%T/%v", s.codec, s.codec.Size())
+}
+
+// Tree is a BTree whose keys are of type K and values are of type V.
+type Tree[K, V any] struct {
+	tree  *BTree
+	codec KeyCodec[K]
+}
+
+// NewTree returns a typed tree on top of the tree, whose pager should be created with the serializers returned by
+// NewKeySerializer and NewValueSerializer for K and V. Otherwise, ErrIncompatibleTree is returned.
+func NewTree[K, V any](tree *BTree) (*Tree[K, V], error) {
+	keys, ok := tree.pager.GetKeySerializer().(*keyCodecSerializer[K])
+	if !ok {
+		return nil, fmt.Errorf("%w: key serializer is %T, expected a serializer of %T", ErrIncompatibleTree, tree.pager.GetKeySerializer(), *new(K))
+	}
+	if _, ok := tree.pager.GetValueSerializer().(*valueCodecSerializer[V]); !ok {
+		return nil, fmt.Errorf("%w: value serializer is %T, expected a serializer of %T", ErrIncompatibleTree, tree.pager.GetValueSerializer(), *new(V))
+	}
+	return &Tree[K, V]{tree: tree, codec: keys.codec}, nil
+}
+
+// BTree returns the untyped tree under the typed tree, it can be used for the methods Tree does not have.
+func (t *Tree[K, V]) BTree() *BTree {
+	return t.tree
+}
+
+func (t *Tree[K, V]) key(key K) Key {
+	return typedKey[K]{key: key, codec: t.codec}
+}
+
+// entry converts a key and a value of the untyped tree, which are nil if there is no such key.
+func (t *Tree[K, V]) entry(key Key, value interface{}) (K, V, bool) {
+	if key == nil {
+		var k K
+		var v V
+		return k, v, false
+	}
+	return key.(typedKey[K]).key, value.(V), true
+}
+
+// Find returns the value of the key and true, or false if the key does not exist. It panics if an error occurs.
+func (t *Tree[K, V]) Find(key K) (V, bool) {
+	value := t.tree.Find(t.key(key))
+	if value == nil {
+		var v V
+		return v, false
+	}
+	return value.(V), true
+}
+
+// TryFind returns the value of the key. It returns ErrKeyNotFound if the key does not exist.
+func (t *Tree[K, V]) TryFind(key K) (V, error) {
+	value, err := t.tree.TryFind(t.key(key))
+	if err != nil {
+		var v V
+		return v, err
+	}
+	return value.(V), nil
+}
+
+// Insert is the same as BTree.Insert.
+func (t *Tree[K, V]) Insert(key K, value V) {
+	t.tree.Insert(t.key(key), value)
+}
+
+// TryInsert is the same as BTree.TryInsert.
+func (t *Tree[K, V]) TryInsert(key K, value V) error {
+	return t.tree.TryInsert(t.key(key), value)
+}
+
+// InsertOrReplace is the same as BTree.InsertOrReplace.
+func (t *Tree[K, V]) InsertOrReplace(key K, value V) (isInserted bool) {
+	return t.tree.InsertOrReplace(t.key(key), value)
+}
+
+// TryInsertOrReplace is the same as BTree.TryInsertOrReplace.
+func (t *Tree[K, V]) TryInsertOrReplace(key K, value V) (isInserted bool, err error) {
+	return t.tree.TryInsertOrReplace(t.key(key), value)
+}
+
+// Delete is the same as BTree.Delete.
+func (t *Tree[K, V]) Delete(key K) bool {
+	return t.tree.Delete(t.key(key))
+}
+
+// TryDelete is the same as BTree.TryDelete.
+func (t *Tree[K, V]) TryDelete(key K) error {
+	return t.tree.TryDelete(t.key(key))
+}
+
+// Len returns the number of keys in the tree.
+func (t *Tree[K, V]) Len() int {
+	return t.tree.Len()
+}
+
+// Rank returns the number of keys in the tree that are less than the key.
+func (t *Tree[K, V]) Rank(key K) int {
+	return t.tree.Rank(t.key(key))
+}
+
+// Select returns the key at the given index in ascending order of keys and its value. It panics if i is out of range.
+func (t *Tree[K, V]) Select(i int) (K, V) {
+	key, value, _ := t.entry(t.tree.Select(i))
+	return key, value
+}
+
+// Min returns the smallest key and its value, or false if the tree is empty.
+func (t *Tree[K, V]) Min() (K, V, bool) {
+	return t.entry(t.tree.Min())
+}
+
+// Max returns the largest key and its value, or false if the tree is empty.
+func (t *Tree[K, V]) Max() (K, V, bool) {
+	return t.entry(t.tree.Max())
+}
+
+// Floor returns the largest key which is less than or equal to the key and its value, or false if there is none.
+func (t *Tree[K, V]) Floor(key K) (K, V, bool) {
+	return t.entry(t.tree.Floor(t.key(key)))
+}
+
+// Ceiling returns the smallest key which is greater than or equal to the key and its value, or false if there is none.
+func (t *Tree[K, V]) Ceiling(key K) (K, V, bool) {
+	return t.entry(t.tree.Ceiling(t.key(key)))
+}
+
+// Lower returns the largest key which is less than the key and its value, or false if there is none.
+func (t *Tree[K, V]) Lower(key K) (K, V, bool) {
+	return t.entry(t.tree.Lower(t.key(key)))
+}
+
+// Higher returns the smallest key which is greater than the key and its value, or false if there is none.
+func (t *Tree[K, V]) Higher(key K) (K, V, bool) {
+	return t.entry(t.tree.Higher(t.key(key)))
+}
@@ -0,0 +1,145 @@
+package btree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reverseCodec orders uint32 keys in descending order.
+type reverseCodec struct {
+	size int
+}
+
+func (c reverseCodec) Encode(v uint32) ([]byte, error) {
+	return binary.BigEndian.AppendUint32(make([]byte, c.size-4), v), nil
+}
+
+func (c reverseCodec) Decode(data []byte) (uint32, error) {
+	return binary.BigEndian.Uint32(data[c.size-4:]), nil
+}
+
+func (c reverseCodec) Size() int {
+	return c.size
+}
+
+func (c reverseCodec) Compare(a, b uint32) int {
+	return int(int64(b) - int64(a))
+}
+
+func TestTree_Should_Insert_Find_And_Delete_Typed_Keys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	newPager := func() *FilePager {
+		pager, err := NewFilePager(path, NewKeySerializer[int64](Int64Codec{}), NewValueSerializer[string](StringCodec{}))
+		assert.NoError(t, err)
+		return pager
+	}
+	pager := newPager()
+	untyped, err := NewBtreeWithMaxDegree(pager)
+	assert.NoError(t, err)
+	tree, err := NewTree[int64, string](untyped)
+	assert.NoError(t, err)
+
+	n := 1000
+	for _, i := range rand.Perm(n) {
+		tree.Insert(int64(i*2), fmt.Sprintf("value_%v", i*2))
+	}
+	assert.ErrorIs(t, tree.TryInsert(10, "duplicate"), ErrKeyExists)
+	assert.False(t, tree.InsertOrReplace(10, "new_10"))
+	assert.True(t, tree.Delete(20))
+	assert.False(t, tree.Delete(21))
+	assert.NoError(t, pager.Close())
+
+	pager = newPager()
+	defer pager.Close()
+	untyped, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	tree, err = NewTree[int64, string](untyped)
+	assert.NoError(t, err)
+
+	assert.Equal(t, n-1, tree.Len())
+	value, ok := tree.Find(10)
+	assert.True(t, ok)
+	assert.Equal(t, "new_10", value)
+	value, ok = tree.Find(20)
+	assert.False(t, ok)
+	assert.Equal(t, "", value)
+	_, err = tree.TryFind(21)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	key, value, ok := tree.Floor(21)
+	assert.True(t, ok)
+	assert.Equal(t, int64(18), key)
+	assert.Equal(t, "value_18", value)
+	key, _, ok = tree.Higher(18)
+	assert.True(t, ok)
+	assert.Equal(t, int64(22), key)
+	_, _, ok = tree.Lower(0)
+	assert.False(t, ok)
+	key, _, _ = tree.Max()
+	assert.Equal(t, int64(2*n-2), key)
+
+	assert.Equal(t, 11, tree.Rank(23))
+	key, value = tree.Select(11)
+	assert.Equal(t, int64(24), key)
+	assert.Equal(t, "value_24", value)
+}
+
+func TestTree_Should_Order_Keys_With_Codec(t *testing.T) {
+	pager := NewInMemoryPager(NewKeySerializer[uint32](reverseCodec{size: 4}), NewValueSerializer[int64](Int64Codec{}))
+	tree, err := NewTree[uint32, int64](NewBtreeWithPager(3, pager))
+	assert.NoError(t, err)
+
+	for _, i := range rand.Perm(100) {
+		tree.Insert(uint32(i), int64(-i))
+	}
+	for i := 0; i < 100; i++ {
+		key, value := tree.Select(i)
+		assert.Equal(t, uint32(99-i), key)
+		assert.Equal(t, int64(i-99), value)
+	}
+	key, _, _ := tree.Min()
+	assert.Equal(t, uint32(99), key)
+}
+
+func TestTree_Should_Return_Error_When_Serializers_Do_Not_Match(t *testing.T) {
+	_, err := NewTree[int64, string](NewBtreeWithPager(3, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10})))
+	assert.ErrorIs(t, err, ErrIncompatibleTree)
+	_, err = NewTree[int64, int64](NewBtreeWithPager(3, NewInMemoryPager(NewKeySerializer[int64](Int64Codec{}), NewValueSerializer[string](StringCodec{}))))
+	assert.ErrorIs(t, err, ErrIncompatibleTree)
+
+	path := filepath.Join(t.TempDir(), "tree.db")
+	pager, err := NewFilePager(path, NewKeySerializer[uint32](reverseCodec{size: 8}), NewValueSerializer[int64](Int64Codec{}))
+	assert.NoError(t, err)
+	NewBtreeWithPager(3, pager)
+	assert.NoError(t, pager.Close())
+
+	// codecs of the same size are still different
+	pager, err = NewFilePager(path, NewKeySerializer[int64](Int64Codec{}), NewValueSerializer[int64](Int64Codec{}))
+	assert.NoError(t, err)
+	defer pager.Close()
+	_, err = OpenBtree(pager)
+	assert.ErrorIs(t, err, ErrIncompatibleTree)
+}
+
+// shortCodec encodes values to 4 bytes although its size is 8.
+type shortCodec struct {
+	Int64Codec
+}
+
+func (shortCodec) Encode(v int64) ([]byte, error) {
+	return binary.BigEndian.AppendUint32(nil, uint32(v)), nil
+}
+
+func TestTree_Should_Reject_Encodings_Of_Wrong_Size(t *testing.T) {
+	pager := NewInMemoryPager(NewKeySerializer[int64](Int64Codec{}), NewValueSerializer[int64](shortCodec{}))
+	tree, err := NewTree[int64, int64](NewBtreeWithPager(3, pager))
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, tree.TryInsert(1, 1), ErrCodecSize)
+	assert.Zero(t, tree.Len())
+}
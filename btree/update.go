@@ -0,0 +1,94 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Action is returned from an UpdateFunc to choose how the value of the key is modified.
+type Action int
+
+const (
+	// ActionKeep leaves the tree as it is.
+	ActionKeep Action = iota
+
+	// ActionReplace replaces the value of the key, which should exist.
+	ActionReplace
+
+	// ActionInsert inserts the key with the value, which should not exist.
+	ActionInsert
+
+	// ActionDelete deletes the key, which should exist.
+	ActionDelete
+)
+
+var ErrInvalidAction = errors.New("invalid update action")
+
+// UpdateFunc is called by Update with the current value of the key, or nil and false if the key does not exist. It
+// returns the new value and the action that is applied to the key.
+type UpdateFunc func(old interface{}, exists bool) (newVal interface{}, action Action)
+
+// Update is the same as TryUpdate, but it panics if an error occurs.
+func (tree *BTree) Update(key Key, fn UpdateFunc) interface{} {
+	val, err := tree.TryUpdate(key, fn)
+	CheckErr(err)
+	return val
+}
+
+// TryUpdate calls fn with the current value of the key and applies the action it returns, in a single descent from
+// the root. It returns the value of the key after the update, which is nil if the key does not exist. ErrKeyNotFound
+// is returned if fn replaces or deletes a key that does not exist and ErrKeyExists is returned if fn inserts a key
+// that exists, as well as errors of serializers and the pager, in which case the tree is not modified.
+func (tree *BTree) TryUpdate(key Key, fn UpdateFunc) (value interface{}, err error) {
+	defer recoverErr(&err)
+	defer tree.unlock(tree.lock(false))
+	tree.unpublishPages()
+	tree.beginTx()
+	defer tree.endTx()
+
+	root := tree.GetRoot()
+	old, stack := tree.findAndGetStack(root, key, []NodeIndexPair{}, Insert)
+	// root is unpinned right away since it could be freed if the tree shrinks
+	tree.pager.Unpin(root, false)
+	exists := old != nil
+
+	newVal, action := fn(old, exists)
+	switch action {
+	case ActionKeep:
+		return old, nil
+	case ActionReplace, ActionDelete:
+		if !exists {
+			return nil, fmt.Errorf("%w: %v", ErrKeyNotFound, key)
+		}
+	case ActionInsert:
+		if exists {
+			return nil, fmt.Errorf("%w: %v", ErrKeyExists, key)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAction, action)
+	}
+
+	if action == ActionDelete {
+		tree.length--
+		defer tree.writeMeta()
+		tree.addCount(stack, -1)
+		tree.deleteAt(key, stack, nil)
+		return nil, nil
+	}
+
+	if err := checkEntrySize(tree.pager, key, newVal); err != nil {
+		return nil, err
+	}
+	top := stack[len(stack)-1]
+	leaf := tree.pager.GetNode(top.Node)
+	if action == ActionReplace {
+		leaf.setValueAt(top.Index, newVal)
+	} else {
+		tree.addCount(stack, 1)
+		leaf.InsertAt(top.Index, key, newVal)
+		tree.length++
+		defer tree.writeMeta()
+	}
+	tree.splitUp(leaf, stack[:len(stack)-1], nil)
+	return newVal, nil
+}
@@ -0,0 +1,115 @@
+package btree
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// increment counts in PageId of a SlotPointer value.
+func increment(old interface{}, exists bool) (interface{}, Action) {
+	if !exists {
+		return SlotPointer{PageId: 1}, ActionInsert
+	}
+	return SlotPointer{PageId: old.(SlotPointer).PageId + 1}, ActionReplace
+}
+
+func TestUpdate_Should_Insert_Replace_Delete_Or_Keep_Value(t *testing.T) {
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	for i := 0; i < 100; i++ {
+		val := tree.Update(PersistentKey(i), func(old interface{}, exists bool) (interface{}, Action) {
+			switch {
+			case i%4 == 0:
+				return nil, ActionDelete
+			case i%4 == 2:
+				assert.True(t, exists)
+				assert.Contains(t, old, "value")
+				return nil, ActionKeep
+			case i%3 == 0:
+				assert.False(t, exists)
+				assert.Nil(t, old)
+				return "inserted", ActionInsert
+			default:
+				return nil, ActionKeep
+			}
+		})
+
+		switch {
+		case i%4 == 0:
+			assert.Nil(t, val)
+		case i%4 == 2:
+			assert.Contains(t, val, "value")
+		case i%3 == 0:
+			assert.Equal(t, "inserted", val)
+		default:
+			assert.Nil(t, val)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		val := tree.Find(PersistentKey(i))
+		switch {
+		case i%4 == 0:
+			assert.Nil(t, val)
+		case i%4 == 2:
+			assert.Contains(t, val, "value")
+		case i%3 == 0:
+			assert.Contains(t, val, "inserted")
+		default:
+			assert.Nil(t, val)
+		}
+	}
+	assert.Equal(t, 25+17, tree.length)
+}
+
+func TestUpdate_Should_Count_With_A_Single_Descent(t *testing.T) {
+	counts := NewBtreeWithPager(10, NewInMemoryPager(&PersistentKeySerializer{}, &SlotPointerValueSerializer{}))
+	pager := &countingPager{Pager: counts.pager, reads: make(map[Pointer]int)}
+	counts.pager = pager
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 100; i++ {
+			pager.reads = make(map[Pointer]int)
+			assert.Equal(t, SlotPointer{PageId: int64(round + 1)}, counts.Update(PersistentKey(i), increment))
+			if round > 0 {
+				assert.Equal(t, 1, pager.reads[counts.Root])
+			}
+		}
+	}
+	assert.Equal(t, 100, counts.length)
+	assert.Equal(t, SlotPointer{PageId: 5}, counts.Find(PersistentKey(99)))
+}
+
+func TestUpdate_Invalid_Action_Should_Return_Error_Without_Modifying_Tree(t *testing.T) {
+	pager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 5})
+	assert.NoError(t, err)
+	defer pager.Close()
+	tree := NewBtreeWithPager(4, pager)
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	_, err = tree.TryUpdate(PersistentKey(1), func(interface{}, bool) (interface{}, Action) { return "value", ActionReplace })
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = tree.TryUpdate(PersistentKey(1), func(interface{}, bool) (interface{}, Action) { return nil, ActionDelete })
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = tree.TryUpdate(PersistentKey(2), func(interface{}, bool) (interface{}, Action) { return "value", ActionInsert })
+	assert.ErrorIs(t, err, ErrKeyExists)
+	_, err = tree.TryUpdate(PersistentKey(2), func(interface{}, bool) (interface{}, Action) { return "too long", ActionReplace })
+	assert.ErrorIs(t, err, ErrValueTooLarge)
+	_, err = tree.TryUpdate(PersistentKey(2), func(interface{}, bool) (interface{}, Action) { return "value", Action(10) })
+	assert.ErrorIs(t, err, ErrInvalidAction)
+
+	// a panic in the callback is returned as an error as well
+	_, err = tree.TryUpdate(PersistentKey(2), func(interface{}, bool) (interface{}, Action) { panic(ErrKeyExists) })
+	assert.ErrorIs(t, err, ErrKeyExists)
+
+	assert.Equal(t, 50, tree.length)
+	assert.Equal(t, "value", tree.Find(PersistentKey(2)))
+	assert.Nil(t, tree.Find(PersistentKey(1)))
+	assert.Zero(t, pager.pool.pinnedCount())
+}
@@ -2,6 +2,6 @@ package btree
 
 func CheckErr(err error) {
 	if err != nil {
-		panic(err.Error())
+		panic(err)
 	}
 }
@@ -0,0 +1,295 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+var ErrTreeInvalid = errors.New("tree is invalid")
+
+// maxViolations is the number of violations after which Verify stops walking the tree.
+const maxViolations = 100
+
+// Violation is the kind of invariant a VerifyError reports to be broken.
+type Violation int
+
+const (
+	// ViolationUnsortedKeys means keys of a node are not in strictly ascending order.
+	ViolationUnsortedKeys Violation = iota + 1
+
+	// ViolationKeyOutOfRange means a key of a node is not between the separator keys of its ancestors.
+	ViolationKeyOutOfRange
+
+	// ViolationLeafDepth means a leaf is not at the same depth as the first leaf.
+	ViolationLeafDepth
+
+	// ViolationUnderflow means a node which has siblings underflows(see Node.IsUnderFlow).
+	ViolationUnderflow
+
+	// ViolationOverflow means a node overflows(see Node.IsOverFlow).
+	ViolationOverflow
+
+	// ViolationLeafChain means Right or Left link of a leaf does not point to its neighbour leaf.
+	ViolationLeafChain
+
+	// ViolationReachableTwice means a page is the child of more than one internal node, or of the same one twice.
+	ViolationReachableTwice
+
+	// ViolationInvalidPointer means a child pointer points to no page or to the metadata page.
+	ViolationInvalidPointer
+
+	// ViolationSubtreeCount means the subtree count of a child is not the number of keys in its subtree.
+	ViolationSubtreeCount
+
+	// ViolationLength means the number of keys in the metadata of the tree is not the number of keys in the tree.
+	ViolationLength
+
+	// ViolationLevelChain means Right or Left link of an internal node does not point to its neighbour on the same
+	// level.
+	ViolationLevelChain
+
+	// ViolationHighKey means the high key of a node is not the separator key between it and the node on its right, or
+	// the last node of a level has a high key.
+	ViolationHighKey
+)
+
+func (v Violation) String() string {
+	switch v {
+	case ViolationUnsortedKeys:
+		return "unsorted keys"
+	case ViolationKeyOutOfRange:
+		return "key out of range"
+	case ViolationLeafDepth:
+		return "leaf depth"
+	case ViolationUnderflow:
+		return "underflow"
+	case ViolationOverflow:
+		return "overflow"
+	case ViolationLeafChain:
+		return "leaf chain"
+	case ViolationReachableTwice:
+		return "reachable twice"
+	case ViolationInvalidPointer:
+		return "invalid pointer"
+	case ViolationSubtreeCount:
+		return "subtree count"
+	case ViolationLength:
+		return "length"
+	case ViolationLevelChain:
+		return "level chain"
+	case ViolationHighKey:
+		return "high key"
+	}
+	return fmt.Sprintf("violation(%d)", int(v))
+}
+
+// VerifyError is a broken invariant of the tree found by Verify in a page. errors.Is(err, ErrTreeInvalid) is true for
+// it.
+type VerifyError struct {
+	PageId    Pointer
+	Violation Violation
+	Message   string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("page %v: %v: %v", e.PageId, e.Violation, e.Message)
+}
+
+func (e *VerifyError) Is(target error) bool {
+	return target == ErrTreeInvalid
+}
+
+/*
+Verify walks every node of the tree and checks that:
+
+  - keys of every node are sorted and are between the separator keys of its ancestors,
+  - every leaf is at the same depth,
+  - no node overflows and no node which has siblings underflows,
+  - Right and Left links of every node point to its neighbours on the same level and the nodes at the edges of a
+    level link to no node,
+  - high key of every node is the separator key between it and the node on its right,
+  - every page is reachable from the root only once,
+  - subtree counts of internal nodes and the number of keys of the tree match the keys in the leaves.
+
+It returns nil if the tree is valid. Otherwise, every violation is returned as a *VerifyError joined in the returned
+error, at most maxViolations of them. Errors of serializers and the pager are returned as they are, in which case the
+tree could not be walked completely.
+
+Verify runs together with the operations that crab latches. It holds shared latches of the path to the node it
+walks, so writers cannot go down to the subtrees it walks, and it waits for the writers that are already there. A
+writer which does not change its leaf takes its deltas back only after it releases its latches(see recountPath),
+hence the tree is walked again if a writer starts to count a path again while it is walked.
+*/
+func (tree *BTree) Verify() (err error) {
+	defer recoverErr(&err)
+	defer tree.unlockRead(tree.lockRead())
+	for {
+		started := tree.recounts.started.Load()
+		if started != tree.recounts.done.Load() {
+			runtime.Gosched()
+			continue
+		}
+		violations := tree.verify()
+		if tree.recounts.started.Load() == started {
+			return errors.Join(violations...)
+		}
+	}
+}
+
+func (tree *BTree) verify() []error {
+	v := &verifier{tree: tree, latches: tree.newHeldLatches(false), visited: make(map[Pointer]bool), leafDepth: -1}
+	defer v.latches.release()
+	v.latches.lockRoot()
+	count := v.walk(tree.Root, 0, nil, nil, false)
+	if !v.isFull() {
+		v.checkLinks()
+	}
+	tree.metaMu.Lock()
+	length := tree.length
+	tree.metaMu.Unlock()
+	if count >= 0 && count != length {
+		v.report(MetaPageId, ViolationLength, "tree has %v keys, its metadata has %v", count, length)
+	}
+	return v.violations
+}
+
+type nodeLinks struct {
+	page, left, right Pointer
+	isLeaf            bool
+}
+
+type verifier struct {
+	tree       *BTree
+	latches    *heldLatches
+	violations []error
+	visited    map[Pointer]bool
+	leafDepth  int
+	levels     [][]nodeLinks // nodes of every depth in ascending order of their keys
+}
+
+func (v *verifier) report(p Pointer, violation Violation, format string, args ...interface{}) {
+	if !v.isFull() {
+		v.violations = append(v.violations, &VerifyError{PageId: p, Violation: violation, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (v *verifier) isFull() bool {
+	return len(v.violations) >= maxViolations
+}
+
+// walk checks the subtree of p, whose keys should not be less than lower and should be less than upper unless they are
+// nil. It returns the number of keys in the subtree, or -1 if it is not known because the subtree is not walked.
+func (v *verifier) walk(p Pointer, depth int, lower, upper Key, hasSiblings bool) int {
+	if p == 0 || p == MetaPageId {
+		v.report(p, ViolationInvalidPointer, "page cannot be a node")
+		return -1
+	}
+	if v.visited[p] {
+		v.report(p, ViolationReachableTwice, "page is already reached from another pointer")
+		return -1
+	}
+	if v.isFull() {
+		return -1
+	}
+	v.visited[p] = true
+
+	// everything needed from the node is read before its children are walked, so that only one node is pinned, but
+	// its latch is held until its subtree is walked
+	v.latches.lock(p)
+	defer v.latches.unlock(p)
+	node := v.tree.pager.GetNode(p)
+	keys := make([]Key, node.Keylen())
+	for i := range keys {
+		keys[i] = node.GetKeyAt(i)
+	}
+	isLeaf, h, highKey := node.IsLeaf(), node.GetHeader(), node.GetHighKey()
+	isOverflow, isUnderflow := node.IsOverFlow(v.tree.degree), node.IsUnderFlow(v.tree.degree)
+	var children []Pointer
+	var counts []int
+	if !isLeaf {
+		for i := 0; i < len(keys)+1; i++ {
+			children = append(children, node.GetValueAt(i).(Pointer))
+			counts = append(counts, node.getCountAt(i))
+		}
+	}
+	v.tree.pager.Unpin(node, false)
+
+	if isOverflow {
+		v.report(p, ViolationOverflow, "node has %v keys", len(keys))
+	}
+	if (highKey == nil) != (upper == nil) || (highKey != nil && (highKey.Less(upper) || upper.Less(highKey))) {
+		v.report(p, ViolationHighKey, "high key is %v, separator key on the right is %v", highKey, upper)
+	}
+	for len(v.levels) <= depth {
+		v.levels = append(v.levels, nil)
+	}
+	v.levels[depth] = append(v.levels[depth], nodeLinks{page: p, left: h.Left, right: h.Right, isLeaf: isLeaf})
+	if isUnderflow && hasSiblings {
+		v.report(p, ViolationUnderflow, "node has %v keys", len(keys))
+	}
+	for i, key := range keys {
+		if i > 0 && !keys[i-1].Less(key) {
+			v.report(p, ViolationUnsortedKeys, "key %v at %v is not greater than key %v before it", key, i, keys[i-1])
+		}
+		if (lower != nil && key.Less(lower)) || (upper != nil && !key.Less(upper)) {
+			v.report(p, ViolationKeyOutOfRange, "key %v at %v is not in [%v, %v)", key, i, lower, upper)
+		}
+	}
+
+	if isLeaf {
+		if v.leafDepth == -1 {
+			v.leafDepth = depth
+		}
+		if depth != v.leafDepth {
+			v.report(p, ViolationLeafDepth, "leaf is at depth %v, first leaf is at depth %v", depth, v.leafDepth)
+		}
+		return len(keys)
+	}
+
+	total := 0
+	for i, child := range children {
+		childLower, childUpper := lower, upper
+		if i > 0 {
+			childLower = keys[i-1]
+		}
+		if i < len(keys) {
+			childUpper = keys[i]
+		}
+		count := v.walk(child, depth+1, childLower, childUpper, len(children) > 1)
+		if count < 0 || total < 0 {
+			total = -1
+			continue
+		}
+		if count != counts[i] {
+			v.report(p, ViolationSubtreeCount, "child %v at %v has %v keys, its count is %v", child, i, count, counts[i])
+		}
+		total += count
+	}
+	return total
+}
+
+// checkLinks checks the links of the nodes of every level, which are in the order they are reached from the root.
+func (v *verifier) checkLinks() {
+	for _, nodes := range v.levels {
+		for i, node := range nodes {
+			var left, right Pointer
+			if i > 0 {
+				left = nodes[i-1].page
+			}
+			if i < len(nodes)-1 {
+				right = nodes[i+1].page
+			}
+			violation := ViolationLevelChain
+			if node.isLeaf {
+				violation = ViolationLeafChain
+			}
+			if node.left != left {
+				v.report(node.page, violation, "left link is %v, node on the left is %v", node.left, left)
+			}
+			if node.right != right {
+				v.report(node.page, violation, "right link is %v, node on the right is %v", node.right, right)
+			}
+		}
+	}
+}
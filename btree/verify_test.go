@@ -0,0 +1,217 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// violations returns the violations in the error returned by Verify.
+func violations(err error) []*VerifyError {
+	var res []*VerifyError
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			var verifyErr *VerifyError
+			if errors.As(e, &verifyErr) {
+				res = append(res, verifyErr)
+			}
+		}
+	}
+	return res
+}
+
+// hasViolation returns true if err has the violation in the page.
+func hasViolation(err error, p Pointer, violation Violation) bool {
+	for _, v := range violations(err) {
+		if v.PageId == p && v.Violation == violation {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVerify_Should_Accept_Valid_Trees(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		degree        int
+		valSerializer ValueSerializer
+	}{
+		{"degree_3", 3, &StringValueSerializer{Len: 10}},
+		{"degree_4", 4, &StringValueSerializer{Len: 10}},
+		{"degree_5", 5, &StringValueSerializer{Len: 10}},
+		{"degree_6", 6, &StringValueSerializer{Len: 10}},
+		{"degree_8", 8, &StringValueSerializer{Len: 10}},
+		{"slotted", 50, &VarStringValueSerializer{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := NewBtreeWithPager(tc.degree, NewInMemoryPager(&PersistentKeySerializer{}, tc.valSerializer))
+			assert.NoError(t, tree.Verify())
+
+			for _, i := range rand.Perm(3000) {
+				tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+			}
+			assert.NoError(t, tree.Verify())
+			for _, i := range rand.Perm(3000)[:2000] {
+				tree.Delete(PersistentKey(i))
+			}
+			assert.NoError(t, tree.Verify())
+			tree.DeleteRange(PersistentKey(500), PersistentKey(2500), RangeBounds{})
+			assert.NoError(t, tree.Verify())
+		})
+	}
+
+	// internal nodes split at even degrees are left with degree/2-1 keys, which is not an underflow
+	for _, degree := range []int{4, 6, 8} {
+		tree := NewBtreeWithPager(degree, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+		for i := 0; i < 100; i++ {
+			tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+			assert.NoError(t, tree.Verify(), "degree %v after %v inserts", degree, i+1)
+		}
+	}
+
+	tree, err := BulkLoad(NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}), persistentKeySource(5000), BulkLoadOptions{Degree: 7})
+	assert.NoError(t, err)
+	assert.NoError(t, tree.Verify())
+}
+
+func TestVerify_Should_Report_Broken_Invariants_With_Their_Pages(t *testing.T) {
+	newTree := func() *BTree {
+		tree, err := BulkLoad(NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}), persistentKeySource(200), BulkLoadOptions{Degree: 5})
+		assert.NoError(t, err)
+		return tree
+	}
+	// modify calls fn with the first leaf, its parent and its grandparent
+	modify := func(tree *BTree, fn func(leaf, parent, grandparent Node)) {
+		stack := tree.descend(nil, func(node Node) int { return 0 })
+		nodes := make([]Node, 3)
+		for i := range nodes {
+			nodes[i] = tree.pager.GetNode(stack[len(stack)-1-i].Node)
+		}
+		fn(nodes[0], nodes[1], nodes[2])
+		for _, node := range nodes {
+			tree.pager.Unpin(node, true)
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		violation Violation
+		corrupt   func(tree *BTree) Pointer
+	}{
+		{"unsorted keys", ViolationUnsortedKeys, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				leaf.setKeyAt(0, leaf.GetKeyAt(1))
+				p = leaf.GetPageId()
+			})
+			return p
+		}},
+		{"key out of range", ViolationKeyOutOfRange, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				leaf.setKeyAt(leaf.Keylen()-1, PersistentKey(1000))
+				p = leaf.GetPageId()
+			})
+			return p
+		}},
+		{"leaf chain", ViolationLeafChain, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				h := leaf.GetHeader()
+				h.Right = 0
+				leaf.SetHeader(h)
+				p = leaf.GetPageId()
+			})
+			return p
+		}},
+		{"level chain", ViolationLevelChain, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				h := parent.GetHeader()
+				h.Left = leaf.GetPageId()
+				parent.SetHeader(h)
+				p = parent.GetPageId()
+			})
+			return p
+		}},
+		{"high key", ViolationHighKey, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				parent.setHighKey(parent.GetHighKey().(PersistentKey) + 1)
+				p = parent.GetPageId()
+			})
+			return p
+		}},
+		{"reachable twice", ViolationReachableTwice, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				parent.setValueAt(1, leaf.GetPageId())
+				p = leaf.GetPageId()
+			})
+			return p
+		}},
+		{"invalid pointer", ViolationInvalidPointer, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				parent.setValueAt(1, MetaPageId)
+				p = MetaPageId
+			})
+			return p
+		}},
+		{"leaf depth", ViolationLeafDepth, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				// the first leaf of the second parent replaces that parent in the grandparent
+				second := tree.pager.GetNode(grandparent.GetValueAt(1).(Pointer))
+				p = second.GetValueAt(0).(Pointer)
+				tree.pager.Unpin(second, false)
+				grandparent.setValueAt(1, p)
+			})
+			return p
+		}},
+		{"underflow", ViolationUnderflow, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				for leaf.Keylen() > 1 {
+					leaf.DeleteAt(0)
+				}
+				p = leaf.GetPageId()
+			})
+			return p
+		}},
+		{"subtree count", ViolationSubtreeCount, func(tree *BTree) (p Pointer) {
+			modify(tree, func(leaf, parent, grandparent Node) {
+				parent.setCountAt(0, parent.getCountAt(0)+1)
+				p = parent.GetPageId()
+			})
+			return p
+		}},
+		{"length", ViolationLength, func(tree *BTree) Pointer {
+			tree.length++
+			return MetaPageId
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := newTree()
+			p := tc.corrupt(tree)
+
+			err := tree.Verify()
+			assert.ErrorIs(t, err, ErrTreeInvalid)
+			assert.True(t, hasViolation(err, p, tc.violation), "%v is not reported for page %v: %v", tc.violation, p, err)
+		})
+	}
+}
+
+func TestVerify_Should_Report_At_Most_Max_Violations(t *testing.T) {
+	tree, err := BulkLoad(NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}), persistentKeySource(5000), BulkLoadOptions{Degree: 3})
+	assert.NoError(t, err)
+
+	// every leaf is linked to no leaf
+	stack := tree.descend(nil, func(node Node) int { return 0 })
+	for p := stack[len(stack)-1].Node; p != 0; {
+		leaf := tree.pager.GetNode(p)
+		h := leaf.GetHeader()
+		p = h.Right
+		h.Left, h.Right = 0, 0
+		leaf.SetHeader(h)
+		tree.pager.Unpin(leaf, true)
+	}
+
+	err = tree.Verify()
+	assert.ErrorIs(t, err, ErrTreeInvalid)
+	assert.Len(t, violations(err), maxViolations)
+}
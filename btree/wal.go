@@ -0,0 +1,205 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// DefaultWALCheckpointSize is the size of the write-ahead log after which a checkpoint is taken.
+	DefaultWALCheckpointSize = 16 << 20
+
+	walSuffix = "-wal"
+
+	walPageRecord   uint8 = 1
+	walCommitRecord uint8 = 2
+)
+
+// walRecordHeader precedes every record in the write-ahead log. Page records are followed by the after image of the
+// page, commit records have no payload. Checksum covers the rest of the header and the payload, so that a record
+// which is not completely written before a crash is recognized as the end of the log.
+type walRecordHeader struct {
+	Checksum   uint32
+	PayloadLen uint32
+	Lsn        uint64
+	TxId       uint64
+	Type       uint8
+	PageId     Pointer
+}
+
+var walRecordHeaderSize = binary.Size(walRecordHeader{})
+
+// wal is a redo-only write-ahead log of page images.
+//
+// Pages that are modified by a transaction are kept in the buffer pool and are never written to the database file
+// before the transaction commits(no-steal). When a transaction commits, after image of every page it modified is
+// appended to the log with a commit record and the log is synced. Only after that pages can be written to the
+// database file. Hence, database file never contains changes of an uncommitted transaction, and a crash can only lose
+// changes of committed transactions that are not yet written to the database file, which are all in the log.
+//
+// Recovery redoes page images of committed transactions in LSN order. Records of a transaction without a commit
+// record are the changes of a transaction that was interrupted by the crash, and they are undone by simply discarding
+// them since none of them reached the database file.
+//
+// Log is truncated by checkpoints after all dirty pages are written to the database file and synced.
+type wal struct {
+	file    storageFile
+	size    int64
+	lastLsn uint64
+	buf     bytes.Buffer
+}
+
+// openWal opens the write-ahead log at the given path and recovers the database file from it.
+func openWal(path string, dbFile storageFile, openFile func(path string) (storageFile, error)) (*wal, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := fileSize(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	w := &wal{file: file, size: size}
+	if err := w.recover(dbFile); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *wal) append(h walRecordHeader, payload []byte) uint64 {
+	w.lastLsn++
+	h.Lsn = w.lastLsn
+	h.PayloadLen = uint32(len(payload))
+
+	record := bytes.Buffer{}
+	err := binary.Write(&record, binary.BigEndian, &h)
+	CheckErr(err)
+	record.Write(payload)
+
+	data := record.Bytes()
+	binary.BigEndian.PutUint32(data, crc32.ChecksumIEEE(data[4:]))
+	w.buf.Write(data)
+	return h.Lsn
+}
+
+// appendPage buffers the after image of a page. Nothing is written to the log file until flush is called.
+func (w *wal) appendPage(txId uint64, pageId Pointer, data []byte) uint64 {
+	return w.append(walRecordHeader{TxId: txId, Type: walPageRecord, PageId: pageId}, data)
+}
+
+// appendCommit buffers a commit record for the transaction.
+func (w *wal) appendCommit(txId uint64) uint64 {
+	return w.append(walRecordHeader{TxId: txId, Type: walCommitRecord}, nil)
+}
+
+// flush writes buffered records to the log file and syncs it. Records are durable once flush returns. If it fails,
+// end of the log is not advanced so that a partially written record is overwritten by the next flush.
+func (w *wal) flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	if _, err := w.file.WriteAt(w.buf.Bytes(), w.size); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.size += int64(w.buf.Len())
+	w.buf.Reset()
+	return nil
+}
+
+// discard drops buffered records which are not flushed yet.
+func (w *wal) discard() {
+	w.buf.Reset()
+}
+
+// truncate empties the log. It should only be called when every page in the log is persisted to the database file.
+func (w *wal) truncate() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.size = 0
+	return w.file.Sync()
+}
+
+// recover redoes page images of committed transactions in the log on to the database file, syncs it and truncates
+// the log. Page size of the database file is the size of page images in the log.
+func (w *wal) recover(dbFile storageFile) error {
+	if w.size == 0 {
+		return nil
+	}
+
+	var offset int64
+	var pending []walRecordHeader
+	var pendingImages [][]byte
+	header := make([]byte, walRecordHeaderSize)
+	for {
+		if _, err := w.file.ReadAt(header, offset); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		h := walRecordHeader{}
+		err := binary.Read(bytes.NewReader(header), binary.BigEndian, &h)
+		CheckErr(err)
+		if int64(h.PayloadLen) > w.size-offset {
+			// length of a torn record cannot be trusted
+			break
+		}
+
+		payload := make([]byte, h.PayloadLen)
+		if _, err := w.file.ReadAt(payload, offset+int64(walRecordHeaderSize)); err != nil && (err != io.EOF || len(payload) > 0) {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(header[4:])
+		crc.Write(payload)
+		if crc.Sum32() != h.Checksum {
+			break
+		}
+		offset += int64(walRecordHeaderSize) + int64(h.PayloadLen)
+		w.lastLsn = h.Lsn
+
+		switch h.Type {
+		case walPageRecord:
+			if len(pending) > 0 && pending[0].TxId != h.TxId {
+				// previous transaction is never committed
+				pending, pendingImages = nil, nil
+			}
+			pending = append(pending, h)
+			pendingImages = append(pendingImages, payload)
+		case walCommitRecord:
+			for i, record := range pending {
+				if record.TxId != h.TxId {
+					continue
+				}
+				setPageChecksum(pendingImages[i])
+				if _, err := dbFile.WriteAt(pendingImages[i], int64(record.PageId)*int64(len(pendingImages[i]))); err != nil {
+					return err
+				}
+			}
+			pending, pendingImages = nil, nil
+		}
+	}
+
+	if err := dbFile.Sync(); err != nil {
+		return err
+	}
+	return w.truncate()
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
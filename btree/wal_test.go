@@ -0,0 +1,323 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errInjectedFault = errors.New("injected fault")
+
+// faultFS is an in memory file system which simulates a process that is killed at its failAt'th write operation.
+// Writes, syncs and truncates are all counted as write operations. When loseUnsynced is set, a crash loses everything
+// written after the last sync of a file, otherwise the write that the process is killed at is torn in half.
+type faultFS struct {
+	files        map[string]*memFile
+	writes       int
+	failAt       int
+	loseUnsynced bool
+	crashed      bool
+}
+
+func newFaultFS() *faultFS {
+	return &faultFS{files: make(map[string]*memFile)}
+}
+
+func (fs *faultFS) open(path string) (storageFile, error) {
+	if f, ok := fs.files[path]; ok {
+		return f, nil
+	}
+	f := &memFile{fs: fs}
+	fs.files[path] = f
+	return f, nil
+}
+
+// write returns false if the process is killed at this write operation.
+func (fs *faultFS) write() bool {
+	if fs.crashed {
+		return false
+	}
+	fs.writes++
+	if fs.failAt != 0 && fs.writes == fs.failAt {
+		fs.crashed = true
+		return false
+	}
+	return true
+}
+
+// restart simulates a new process that opens the files after the crash.
+func (fs *faultFS) restart() {
+	for _, f := range fs.files {
+		if fs.loseUnsynced {
+			f.data = append([]byte{}, f.synced...)
+		}
+	}
+	fs.crashed = false
+	fs.failAt = 0
+	fs.writes = 0
+}
+
+type memFile struct {
+	fs     *faultFS
+	data   []byte
+	synced []byte
+}
+
+func (m *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *memFile) WriteAt(p []byte, off int64) (int, error) {
+	crashed := m.fs.crashed
+	if !m.fs.write() {
+		if !crashed && !m.fs.loseUnsynced {
+			m.writeAt(p[:len(p)/2], off)
+		}
+		return 0, errInjectedFault
+	}
+	m.writeAt(p, off)
+	return len(p), nil
+}
+
+func (m *memFile) writeAt(p []byte, off int64) {
+	if end := off + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	copy(m.data[off:], p)
+}
+
+func (m *memFile) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekEnd || offset != 0 {
+		panic("memFile only supports seeking to the end")
+	}
+	return int64(len(m.data)), nil
+}
+
+func (m *memFile) Sync() error {
+	if !m.fs.write() {
+		return errInjectedFault
+	}
+	m.synced = append([]byte{}, m.data...)
+	return nil
+}
+
+func (m *memFile) Truncate(size int64) error {
+	if !m.fs.write() {
+		return errInjectedFault
+	}
+	m.data = m.data[:size]
+	return nil
+}
+
+func (m *memFile) Close() error {
+	return nil
+}
+
+type walTestOp struct {
+	isDelete bool
+	key      PersistentKey
+	val      string
+}
+
+func walTestOps(n int) []walTestOp {
+	r := rand.New(rand.NewSource(42))
+	ops := make([]walTestOp, 0, n)
+	for i := 0; i < n; i++ {
+		key := PersistentKey(r.Intn(n))
+		ops = append(ops, walTestOp{isDelete: r.Intn(3) == 0, key: key, val: fmt.Sprintf("%04d_%04d", key, i)})
+	}
+	return ops
+}
+
+// walTestModel returns the expected content of the tree after first n ops are applied.
+func walTestModel(ops []walTestOp, n int) map[PersistentKey]string {
+	model := make(map[PersistentKey]string)
+	for _, op := range ops[:n] {
+		if op.isDelete {
+			delete(model, op.key)
+		} else {
+			model[op.key] = op.val
+		}
+	}
+	return model
+}
+
+func walTestOptions(fs *faultFS) FilePagerOptions {
+	return FilePagerOptions{PoolSize: 32, EnableWAL: true, WALCheckpointSize: 64 << 10, openFile: fs.open}
+}
+
+// runWalTestOps applies ops to a new tree until the process is killed and returns the number of ops that are
+// completed. It returns -1 if the process is killed before the tree is created.
+func runWalTestOps(t *testing.T, fs *faultFS, ops []walTestOp) (completed int) {
+	completed = -1
+	defer func() {
+		if r := recover(); r != nil {
+			// internals panic with either the error or its message
+			if err, ok := r.(error); ok && errors.Is(err, errInjectedFault) {
+				return
+			}
+			if r != errInjectedFault.Error() {
+				panic(r)
+			}
+		}
+	}()
+
+	pager, err := NewFilePagerWithOptions("tree.db", &PersistentKeySerializer{}, &StringValueSerializer{Len: 9}, walTestOptions(fs))
+	if err != nil {
+		assert.ErrorIs(t, err, errInjectedFault)
+		return -1
+	}
+	tree := NewBtreeWithPager(4, pager)
+	completed = 0
+	for _, op := range ops {
+		if op.isDelete {
+			tree.Delete(op.key)
+		} else {
+			tree.InsertOrReplace(op.key, op.val)
+		}
+		completed++
+	}
+	return completed
+}
+
+// walTestContent returns the content of the tree by iterating it and checks that it is sorted and every key can be
+// found.
+func walTestContent(t *testing.T, tree *BTree) map[PersistentKey]string {
+	content := make(map[PersistentKey]string)
+	it := NewTreeIterator(tree, tree.GetPager())
+	last := ""
+	for val := it.Next(); val != nil; val = it.Next() {
+		var key PersistentKey
+		var idx int
+		_, err := fmt.Sscanf(val.(string), "%04d_%04d", &key, &idx)
+		assert.NoError(t, err)
+		assert.Less(t, last, val.(string))
+		last = val.(string)
+
+		content[key] = val.(string)
+		assert.Equal(t, val, tree.Find(key))
+	}
+	return content
+}
+
+func TestWAL_Tree_Should_Be_Recovered_After_Crash_At_Every_Write(t *testing.T) {
+	ops := walTestOps(100)
+
+	fs := newFaultFS()
+	assert.Equal(t, len(ops), runWalTestOps(t, fs, ops))
+	totalWrites := fs.writes
+
+	for _, loseUnsynced := range []bool{false, true} {
+		for failAt := 1; failAt <= totalWrites; failAt++ {
+			fs := newFaultFS()
+			fs.failAt, fs.loseUnsynced = failAt, loseUnsynced
+			completed := runWalTestOps(t, fs, ops)
+			assert.True(t, fs.crashed)
+			fs.restart()
+
+			pager, err := NewFilePagerWithOptions("tree.db", &PersistentKeySerializer{}, &StringValueSerializer{Len: 9}, walTestOptions(fs))
+			if completed == -1 && err != nil {
+				continue
+			}
+			assert.NoError(t, err)
+			tree, err := OpenBtree(pager)
+			if completed == -1 && err == ErrTreeNotFound {
+				continue
+			}
+			if !assert.NoError(t, err, "failAt: %v", failAt) {
+				continue
+			}
+
+			// op which process is killed in may or may not be committed
+			content := walTestContent(t, tree)
+			if completed < 0 {
+				completed = 0
+			}
+			before, after := walTestModel(ops, completed), walTestModel(ops, completed+1)
+			if !assert.True(t, assert.ObjectsAreEqual(before, content) || assert.ObjectsAreEqual(after, content), "failAt: %v", failAt) {
+				continue
+			}
+			assert.Equal(t, len(content), tree.length)
+
+			// recovered tree should be usable
+			tree.InsertOrReplace(PersistentKey(1000), "1000_1000")
+			assert.Equal(t, "1000_1000", tree.Find(PersistentKey(1000)))
+			assert.NoError(t, pager.Close())
+		}
+	}
+}
+
+func TestWAL_Committed_Changes_Should_Survive_Without_A_Checkpoint(t *testing.T) {
+	fs := newFaultFS()
+	fs.loseUnsynced = true
+	opts := FilePagerOptions{EnableWAL: true, openFile: fs.open}
+	pager, err := NewFilePagerWithOptions(filepath.Join("dir", "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, opts)
+	assert.NoError(t, err)
+
+	tree := NewBtreeWithPager(4, pager)
+	for i := 0; i < 100; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	// nothing is written to database file since pages are in the pool and log is not checkpointed yet
+	fs.restart()
+	pager, err = NewFilePagerWithOptions(filepath.Join("dir", "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, opts)
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	tree, err = OpenBtree(pager)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, tree.length)
+	for i := 0; i < 100; i++ {
+		assert.Contains(t, tree.Find(PersistentKey(i)), "value")
+	}
+}
+
+func TestTransaction_Should_Be_Aborted_When_Operation_Panics(t *testing.T) {
+	fs := newFaultFS()
+	pager, err := NewFilePagerWithOptions("tree.db", &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, FilePagerOptions{PoolSize: 16, openFile: fs.open})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	tree := NewBtreeWithPager(4, pager)
+	for i := 0; i < 100; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	assert.Panics(t, func() { tree.Insert(PersistentKey(50), "value") })
+	assert.Nil(t, pager.tx)
+	assert.Zero(t, pager.pool.pinnedCount())
+	assert.Equal(t, 100, tree.length)
+
+	// an operation which fails in the middle, here while evicting a page, should not leave any of its changes behind
+	fs.failAt = fs.writes + 1
+	n := 100
+	assert.Panics(t, func() {
+		for ; n < 1000; n++ {
+			tree.Insert(PersistentKey(n), "value")
+		}
+	})
+	fs.restart()
+	assert.Nil(t, pager.tx)
+	assert.Zero(t, pager.pool.pinnedCount())
+	assert.Equal(t, n, tree.length)
+	assert.Nil(t, tree.Find(PersistentKey(n)))
+	for i := 0; i < n; i++ {
+		assert.Contains(t, tree.Find(PersistentKey(i)), "value")
+	}
+
+	tree.Insert(PersistentKey(n), "value")
+	assert.Contains(t, tree.Find(PersistentKey(n)), "value")
+}
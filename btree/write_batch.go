@@ -0,0 +1,217 @@
+package btree
+
+import (
+	"fmt"
+	"sort"
+)
+
+type batchOpType int
+
+const (
+	batchInsert batchOpType = iota
+	batchInsertOrReplace
+	batchDelete
+)
+
+type batchOp struct {
+	opType batchOpType
+	key    Key
+	value  interface{}
+}
+
+// WriteBatch collects Insert, InsertOrReplace and Delete operations which are applied to a tree together by
+// BTree.Apply, either all of them or none of them. Operations on the same key are applied in the order they are added
+// to the batch.
+type WriteBatch struct {
+	ops []batchOp
+}
+
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{}
+}
+
+// Insert adds an insert of the key to the batch, which fails the batch with ErrKeyExists if the key exists when it is
+// applied.
+func (b *WriteBatch) Insert(key Key, value interface{}) {
+	b.ops = append(b.ops, batchOp{opType: batchInsert, key: key, value: value})
+}
+
+// InsertOrReplace adds an insert of the key to the batch, which replaces its value if the key exists.
+func (b *WriteBatch) InsertOrReplace(key Key, value interface{}) {
+	b.ops = append(b.ops, batchOp{opType: batchInsertOrReplace, key: key, value: value})
+}
+
+// Delete adds a delete of the key to the batch, which fails the batch with ErrKeyNotFound if the key does not exist
+// when it is applied.
+func (b *WriteBatch) Delete(key Key) {
+	b.ops = append(b.ops, batchOp{opType: batchDelete, key: key})
+}
+
+// Len returns the number of operations in the batch.
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Reset removes every operation from the batch so that it can be reused.
+func (b *WriteBatch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Apply is the same as TryApply, but it panics if an error occurs.
+func (tree *BTree) Apply(batch *WriteBatch) {
+	CheckErr(tree.TryApply(batch))
+}
+
+/*
+TryApply applies the operations of the batch in ascending order of their keys, so that an operation whose key is in
+the same leaf as the key of the previous operation does not go down from the root again, unless the previous
+operation splits or rebalances the leaf. Every operation is applied in the same transaction, hence the batch is
+applied atomically by a TxPager even if the process crashes.
+
+ErrKeyExists or ErrKeyNotFound is returned if an operation fails, and errors of serializers and the pager, in which
+case none of the operations are applied. Operations are checked before the tree is modified if the pager is not a
+TxPager, since changes of the pages cannot be reverted then.
+*/
+func (tree *BTree) TryApply(batch *WriteBatch) (err error) {
+	defer recoverErr(&err)
+	defer tree.unlock(tree.lock(false))
+	tree.unpublishPages()
+	ops := make([]batchOp, len(batch.ops))
+	copy(ops, batch.ops)
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].key.Less(ops[j].key)
+	})
+
+	for _, op := range ops {
+		if op.opType == batchDelete {
+			continue
+		}
+		if err := checkEntrySize(tree.pager, op.key, op.value); err != nil {
+			return err
+		}
+	}
+	if _, ok := tree.pager.(TxPager); !ok {
+		if err := tree.checkBatch(ops); err != nil {
+			return err
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	tree.beginTx()
+	defer tree.endTx()
+	defer tree.writeMeta()
+
+	path := leafPath{tree: tree}
+	for _, op := range ops {
+		if !tree.applyOp(op, path.get(op.key, Insert)) {
+			path.reset()
+		}
+	}
+	return nil
+}
+
+// leafPath keeps the path to the leaf of the last key, so that it is reused for the next key if it belongs to the
+// same leaf.
+type leafPath struct {
+	tree         *BTree
+	stack        []NodeIndexPair
+	lower, upper Key
+}
+
+// get returns the path from the root to the leaf the key belongs to.
+func (p *leafPath) get(key Key, mode TraverseMode) []NodeIndexPair {
+	if p.stack == nil || (p.lower != nil && key.Less(p.lower)) || (p.upper != nil && !key.Less(p.upper)) {
+		root := p.tree.GetRoot()
+		_, p.stack = p.tree.findAndGetStack(root, key, []NodeIndexPair{}, mode)
+		p.tree.pager.Unpin(root, false)
+		p.lower, p.upper = p.tree.leafBounds(p.stack)
+	}
+	return p.stack
+}
+
+// reset should be called when the leaf is split or rebalanced.
+func (p *leafPath) reset() {
+	p.stack = nil
+}
+
+// checkBatch returns the error of the first operation that would fail. ops should be sorted by their keys.
+func (tree *BTree) checkBatch(ops []batchOp) error {
+	path := leafPath{tree: tree}
+	var exists bool
+	for i, op := range ops {
+		if i == 0 || ops[i-1].key.Less(op.key) {
+			stack := path.get(op.key, Read)
+			leaf := tree.pager.GetNode(stack[len(stack)-1].Node)
+			_, exists = leaf.findKey(op.key)
+			tree.pager.Unpin(leaf, false)
+		}
+
+		switch op.opType {
+		case batchInsert:
+			if exists {
+				return fmt.Errorf("%w: %v", ErrKeyExists, op.key)
+			}
+			exists = true
+		case batchInsertOrReplace:
+			exists = true
+		case batchDelete:
+			if !exists {
+				return fmt.Errorf("%w: %v", ErrKeyNotFound, op.key)
+			}
+			exists = false
+		}
+	}
+	return nil
+}
+
+// applyOp applies the operation to the leaf at the top of the stack, which should be the leaf the key belongs to. It
+// returns false if the leaf is split or rebalanced, in which case the stack is not valid anymore.
+func (tree *BTree) applyOp(op batchOp, stack []NodeIndexPair) bool {
+	top := &stack[len(stack)-1]
+	leaf := tree.pager.GetNode(top.Node)
+	i, found := leaf.findKey(op.key)
+	top.Index = i
+
+	switch {
+	case op.opType == batchDelete:
+		tree.pager.Unpin(leaf, false)
+		if !found {
+			panic(fmt.Errorf("%w: %v", ErrKeyNotFound, op.key))
+		}
+		tree.length--
+		tree.addCount(stack, -1)
+		return !tree.deleteAt(op.key, stack, nil)
+	case found && op.opType == batchInsert:
+		tree.pager.Unpin(leaf, false)
+		panic(fmt.Errorf("%w: %v", ErrKeyExists, op.key))
+	case found:
+		leaf.setValueAt(i, op.value)
+	default:
+		leaf.InsertAt(i, op.key, op.value)
+		tree.addCount(stack, 1)
+		tree.length++
+	}
+
+	isSplit := leaf.IsOverFlow(tree.degree)
+	tree.splitUp(leaf, stack[:len(stack)-1], nil)
+	return !isSplit
+}
+
+// leafBounds returns the separating keys in the ancestors of the leaf at the top of the stack which bound the keys
+// that belong to the leaf. lower is inclusive and upper is exclusive, they are nil if the leaf is the leftmost or the
+// rightmost one.
+func (tree *BTree) leafBounds(stack []NodeIndexPair) (lower, upper Key) {
+	for _, pair := range stack[:len(stack)-1] {
+		node := tree.pager.GetNode(pair.Node)
+		if pair.Index > 0 {
+			lower = node.GetKeyAt(pair.Index - 1)
+		}
+		if pair.Index < node.Keylen() {
+			upper = node.GetKeyAt(pair.Index)
+		}
+		tree.pager.Unpin(node, false)
+	}
+	return lower, upper
+}
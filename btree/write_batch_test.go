@@ -0,0 +1,182 @@
+package btree
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingPager counts how many times each node is read from the pager.
+type countingPager struct {
+	Pager
+	reads map[Pointer]int
+}
+
+func (p *countingPager) GetNode(pointer Pointer) Node {
+	p.reads[pointer]++
+	return p.Pager.GetNode(pointer)
+}
+
+func TestWriteBatch_Should_Apply_Every_Operation(t *testing.T) {
+	filePager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer filePager.Close()
+
+	for _, pager := range []Pager{NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}), filePager} {
+		tree := NewBtreeWithPager(5, pager)
+		for i := 0; i < 1000; i += 2 {
+			tree.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+		}
+
+		batch := NewWriteBatch()
+		for i := 999; i >= 0; i-- {
+			switch {
+			case i%2 == 1:
+				batch.Insert(PersistentKey(i), fmt.Sprintf("value_%v", i))
+			case i%4 == 0:
+				batch.Delete(PersistentKey(i))
+			default:
+				batch.InsertOrReplace(PersistentKey(i), fmt.Sprintf("new_%v", i))
+			}
+		}
+		assert.Equal(t, 1000, batch.Len())
+		assert.NoError(t, tree.TryApply(batch))
+
+		assert.Equal(t, 750, tree.length)
+		for i := 0; i < 1000; i++ {
+			val := tree.Find(PersistentKey(i))
+			switch {
+			case i%2 == 1:
+				assert.Contains(t, val, fmt.Sprintf("value_%v", i))
+			case i%4 == 0:
+				assert.Nil(t, val)
+			default:
+				assert.Contains(t, val, fmt.Sprintf("new_%v", i))
+			}
+		}
+	}
+	assert.Zero(t, filePager.pool.pinnedCount())
+}
+
+func TestWriteBatch_Operations_On_Same_Key_Should_Be_Applied_In_Order(t *testing.T) {
+	tree := NewBtreeWithPager(4, NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}))
+	tree.Insert(PersistentKey(1), "first")
+
+	batch := NewWriteBatch()
+	batch.Delete(PersistentKey(1))
+	batch.Insert(PersistentKey(2), "first")
+	batch.Insert(PersistentKey(1), "second")
+	batch.InsertOrReplace(PersistentKey(2), "second")
+	batch.Delete(PersistentKey(2))
+	batch.InsertOrReplace(PersistentKey(2), "third")
+	tree.Apply(batch)
+
+	assert.Equal(t, 2, tree.length)
+	assert.Contains(t, tree.Find(PersistentKey(1)), "second")
+	assert.Contains(t, tree.Find(PersistentKey(2)), "third")
+
+	// batch can be reused after it is reset
+	batch.Reset()
+	assert.Zero(t, batch.Len())
+	batch.Delete(PersistentKey(1))
+	tree.Apply(batch)
+	assert.Nil(t, tree.Find(PersistentKey(1)))
+}
+
+func TestWriteBatch_Failed_Operation_Should_Roll_Back_The_Batch(t *testing.T) {
+	filePager, err := NewFilePager(filepath.Join(t.TempDir(), "tree.db"), &PersistentKeySerializer{}, &StringValueSerializer{Len: 10})
+	assert.NoError(t, err)
+	defer filePager.Close()
+
+	for _, pager := range []Pager{NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}), filePager} {
+		tree := NewBtreeWithPager(4, pager)
+		for i := 0; i < 100; i += 2 {
+			tree.Insert(PersistentKey(i), "value")
+		}
+		root := tree.Root
+
+		batch := NewWriteBatch()
+		for i := 100; i < 1000; i++ {
+			batch.Insert(PersistentKey(i), "new")
+		}
+		for i := 0; i < 100; i += 2 {
+			batch.Delete(PersistentKey(i))
+		}
+		batch.Insert(PersistentKey(998), "duplicate")
+		assert.ErrorIs(t, tree.TryApply(batch), ErrKeyExists)
+
+		batch.Reset()
+		batch.Delete(PersistentKey(0))
+		batch.Delete(PersistentKey(1))
+		assert.ErrorIs(t, tree.TryApply(batch), ErrKeyNotFound)
+
+		batch.Reset()
+		batch.Insert(PersistentKey(1), "too long value")
+		assert.ErrorIs(t, tree.TryApply(batch), ErrValueTooLarge)
+
+		assert.Equal(t, 50, tree.length)
+		assert.Equal(t, root, tree.Root)
+		for i := 0; i < 1000; i++ {
+			if i < 100 && i%2 == 0 {
+				assert.Contains(t, tree.Find(PersistentKey(i)), "value")
+			} else {
+				assert.Nil(t, tree.Find(PersistentKey(i)))
+			}
+		}
+	}
+	assert.Zero(t, filePager.pool.pinnedCount())
+}
+
+func TestWriteBatch_Pager_Error_Should_Roll_Back_The_Batch(t *testing.T) {
+	fs := newFaultFS()
+	pager, err := NewFilePagerWithOptions("tree.db", &PersistentKeySerializer{}, &StringValueSerializer{Len: 10}, FilePagerOptions{PoolSize: 64, openFile: fs.open})
+	assert.NoError(t, err)
+	defer pager.Close()
+
+	tree := NewBtreeWithPager(4, pager)
+	for i := 0; i < 100; i++ {
+		tree.Insert(PersistentKey(i), "value")
+	}
+
+	// pool is filled with the pages of the batch, which fails when a page is evicted
+	fs.failAt = fs.writes + 1
+	batch := NewWriteBatch()
+	for i := 100; i < 1000; i++ {
+		batch.Insert(PersistentKey(i), "value")
+	}
+	assert.Error(t, tree.TryApply(batch))
+	fs.restart()
+
+	assert.Zero(t, pager.pool.pinnedCount())
+	assert.Equal(t, 100, tree.length)
+	for i := 0; i < 1000; i++ {
+		if i < 100 {
+			assert.NotNil(t, tree.Find(PersistentKey(i)))
+		} else {
+			assert.Nil(t, tree.Find(PersistentKey(i)))
+		}
+	}
+}
+
+func TestWriteBatch_Should_Not_Go_Down_From_Root_For_Keys_In_The_Same_Leaf(t *testing.T) {
+	pager := &countingPager{Pager: NewInMemoryPager(&PersistentKeySerializer{}, &StringValueSerializer{Len: 10}), reads: make(map[Pointer]int)}
+	tree, err := BulkLoad(pager, persistentKeySource(10000), BulkLoadOptions{Degree: 100})
+	assert.NoError(t, err)
+
+	batch := NewWriteBatch()
+	for i := 0; i < 10000; i++ {
+		batch.InsertOrReplace(PersistentKey(i), "new")
+	}
+	pager.reads = make(map[Pointer]int)
+	tree.Apply(batch)
+
+	// every leaf is reached from the root once and its bounds are read from the root once, both when the batch is
+	// checked and when it is applied
+	leaves := (10000 + 89 - 1) / 89
+	assert.LessOrEqual(t, pager.reads[tree.Root], 4*leaves)
+	for i := 0; i < 10000; i++ {
+		assert.Contains(t, tree.Find(PersistentKey(i)), "new")
+	}
+}